@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net"
 	"net/http"
@@ -8,26 +9,90 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/jackc/pgx/v5/pgxpool"
 	"google.golang.org/grpc"
 
+	"github.com/julianstephens/feature-flag-service/internal/audit"
+	"github.com/julianstephens/feature-flag-service/internal/auth"
 	"github.com/julianstephens/feature-flag-service/internal/config"
+	"github.com/julianstephens/feature-flag-service/internal/dynconfig"
 	"github.com/julianstephens/feature-flag-service/internal/flag"
+	"github.com/julianstephens/feature-flag-service/internal/project"
+	"github.com/julianstephens/feature-flag-service/internal/rbac"
+	"github.com/julianstephens/feature-flag-service/internal/segment"
 	"github.com/julianstephens/feature-flag-service/internal/server"
 	"github.com/julianstephens/feature-flag-service/internal/storage"
 )
 
 func main() {
 	conf := config.LoadConfig()
-	etcdClient, err := storage.NewEtcdStore([]string{conf.StorageEndpoint}, "/featureflags/")
+	// RBAC, the audit log and dynamic config live in Postgres. Only in dev
+	// mode may the API run without it, serving projects, segments, flags and
+	// SDK keys alone, which is enough to run against the memory storage
+	// backend with no external services.
+	var pool *pgxpool.Pool
+	if conf.PostgresURL != "" {
+		var err error
+		pool, err = storage.NewPostgresPool(context.Background(), conf.PostgresURL)
+		if err != nil {
+			log.Fatalf("Failed to connect to postgres: %v", err)
+		}
+		defer pool.Close()
+	} else if conf.DevMode {
+		log.Println("Warning: DEV_MODE is on and POSTGRES_URL is unset; serving without RBAC, audit log and dynamic config")
+	} else {
+		log.Fatal("POSTGRES_URL must be set unless DEV_MODE is on")
+	}
+	store, err := storage.Open(conf.StorageBackend, storage.Options{
+		EtcdEndpoints: []string{conf.StorageEndpoint},
+		Pool:          pool,
+		FilePath:      conf.StorageFile,
+	})
+	if err != nil {
+		log.Fatalf("Failed to open %s storage: %v", conf.StorageBackend, err)
+	}
+	defer store.Close()
+	var auditService audit.Service
+	if pool != nil {
+		auditService = audit.NewService(conf, pool)
+	}
+	projectService := project.NewService(conf, store, auditService)
+	segmentService := segment.NewService(conf, store, auditService)
+	flagService := flag.NewService(conf, store, projectService, segmentService, auditService)
+	sdkKeyService := auth.NewService(conf, store, projectService, auditService)
+	authentication, err := auth.NewAuthentication(conf, sdkKeyService)
+	if err != nil {
+		log.Fatalf("Failed to set up authentication: %v", err)
+	}
+	services := []any{flagService, segmentService, projectService, sdkKeyService}
+	var rbacService rbac.Service
+	if pool != nil {
+		rbacService = rbac.NewService(conf, pool, auditService)
+		configService := dynconfig.NewService(conf, pool, auditService)
+		services = append(services, rbacService, auditService, configService)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), server.DEFAULT_TIMEOUT)
+	if _, err := projectService.EnsureProject(ctx, conf.DefaultProject); err != nil {
+		log.Fatalf("Failed to create default project: %v", err)
+	}
+	migrated, err := flagService.MigrateLegacyFlags(ctx)
 	if err != nil {
-		log.Fatalf("Failed to connect to etcd: %v", err)
+		log.Fatalf("Failed to migrate flags into projects: %v", err)
+	}
+	if migrated > 0 {
+		log.Printf("Moved %d flags into project %s", migrated, conf.DefaultProject)
+	}
+	if rbacService != nil && conf.RBACAdminEmail != "" {
+		if err := rbacService.EnsureAdmin(ctx, conf.RBACAdminEmail); err != nil {
+			log.Fatalf("Failed to create admin user: %v", err)
+		}
 	}
-	defer etcdClient.Client.Close()
-	flagService := flag.NewService(conf, etcdClient)
+	cancel()
 
 	go func() {
 		log.Printf("Starting REST API on :%s...", conf.HTTPPort)
-		if err := server.StartREST(":" + conf.HTTPPort, conf, flagService); err != nil && err != http.ErrServerClosed {
+		if err := server.StartREST(":" + conf.HTTPPort, conf, append(services, authentication)...); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("REST server error: %v", err)
 		}
 	}()
@@ -37,8 +102,8 @@ func main() {
 		if err != nil {
 			log.Fatalf("Failed to listen on gRPC port %s: %v", conf.GRPCPort, err)
 		}
-		grpcServer := grpc.NewServer()
-		server.RegisterGRPC(grpcServer, flagService)
+		grpcServer := grpc.NewServer(server.GRPCServerOptions(conf, authentication, rbacService)...)
+		server.RegisterGRPC(grpcServer, services...)
 		log.Printf("Starting gRPC API on :%s...", conf.GRPCPort)
 		if err := grpcServer.Serve(lis); err != nil {
 			log.Fatalf("gRPC server error: %v", err)
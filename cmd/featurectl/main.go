@@ -7,7 +7,6 @@ import (
 	"github.com/alecthomas/kong"
 	"github.com/charmbracelet/log"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 
 	"github.com/julianstephens/feature-flag-service/internal/commands"
 	"github.com/julianstephens/feature-flag-service/internal/config"
@@ -15,16 +14,20 @@ import (
 
 type Globals struct {
 	Version kong.VersionFlag
+	commands.ConnectionFlags
 }
 
 type CLI struct {
 	Globals
 
-	Login struct {
-	} `cmd:"" help:"Login to the feature management system."`
+	Login commands.LoginCommand `cmd:"" help:"Login to the feature management system."`
+	Logout commands.LogoutCommand `cmd:"" help:"Remove the stored token of a profile."`
+	Profile commands.ProfileCommand `cmd:"" help:"Manage the stored server profiles."`
+	Project commands.ProjectCommand `cmd:"" help:"Manage projects and their environments."`
 	Flag commands.FlagCommand `cmd:"" help:"Manage feature flags."`
-	Audit struct {
-	} `cmd:"" help:"Audit log operations."`
+	Segment commands.SegmentCommand `cmd:"" help:"Manage user segments."`
+	Sdkkey commands.SDKKeyCommand `cmd:"" help:"Manage the SDK keys of an environment."`
+	Audit commands.AuditCommand `cmd:"" help:"Inspect the audit log of changes."`
 }
 
 var err error
@@ -36,13 +39,6 @@ func main() {
 
 	conf := config.LoadConfig()
 
-	var conn *grpc.ClientConn
-	conn, err = grpc.NewClient(":"+conf.GRPCPort, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		log.Fatal("Failed to connect to gRPC server:", "error", err)
-	}
-	defer conn.Close()
-
 	kongCtx := kong.Parse(&cli,
 		kong.Name("featurectl"),
 		kong.Description("CLI for Distributed Feature Flag & Config System"),
@@ -54,7 +50,60 @@ func main() {
 	cmd := strings.Split(kongCtx.Command(), " ")
 	switch cmd[0] {
 	case "login":
-		// Implement login functionality here
+		kongCtx.FatalIfErrorf(cli.Login.Login(conf, &cli.ConnectionFlags))
+		return
+	case "logout":
+		kongCtx.FatalIfErrorf(cli.Logout.Logout(conf, &cli.ConnectionFlags))
+		return
+	case "profile":
+		if len(cmd) < 2 {
+			kongCtx.PrintUsage(false)
+			return
+		}
+		switch cmd[1] {
+		case "list":
+			err = cli.Profile.ListProfiles(conf)
+		case "use":
+			err = cli.Profile.UseProfile(conf)
+		default:
+			panic(fmt.Sprintf("unknown profile command: %s", cmd[1]))
+		}
+		kongCtx.FatalIfErrorf(err)
+		return
+	}
+
+	var conn *grpc.ClientConn
+	conn, err = commands.Connect(conf, &cli.ConnectionFlags)
+	if err != nil {
+		log.Fatal("Failed to connect to gRPC server:", "error", err)
+	}
+	defer conn.Close()
+
+	switch cmd[0] {
+	case "project":
+		if len(cmd) < 2 {
+			kongCtx.PrintUsage(false)
+			return
+		}
+		subcmd := cmd[1]
+		switch subcmd {
+		case "list":
+			err = cli.Project.ListProjects(conf, conn)
+		case "get":
+			err = cli.Project.GetProject(conf, conn)
+		case "create":
+			err = cli.Project.CreateProject(conf, conn)
+		case "update":
+			err = cli.Project.UpdateProject(conf, conn)
+		case "delete":
+			err = cli.Project.DeleteProject(conf, conn)
+		case "add-env":
+			err = cli.Project.AddEnvironment(conf, conn)
+		case "remove-env":
+			err = cli.Project.RemoveEnvironment(conf, conn)
+		default:
+			panic(fmt.Sprintf("unknown project command: %s", subcmd))
+		}
 	case "flag":
 		if len(cmd) < 2 {
 			kongCtx.PrintUsage(false)
@@ -72,14 +121,75 @@ func main() {
 			err = cli.Flag.UpdateFlag(conf, conn)
 		case "delete":
 			err = cli.Flag.DeleteFlag(conf, conn)
+		case "reshuffle":
+			err = cli.Flag.ReshuffleFlag(conf, conn)
+		case "deps":
+			err = cli.Flag.FlagDependencies(conf, conn)
+		case "history":
+			err = cli.Flag.FlagHistory(conf, conn)
+		case "rollback":
+			err = cli.Flag.RollbackFlag(conf, conn)
 		default:
 			panic(fmt.Sprintf("unknown flag command: %s", subcmd))
 		}
+	case "segment":
+		if len(cmd) < 2 {
+			kongCtx.PrintUsage(false)
+			return
+		}
+		subcmd := cmd[1]
+		switch subcmd {
+		case "list":
+			err = cli.Segment.ListSegments(conf, conn)
+		case "get":
+			err = cli.Segment.GetSegment(conf, conn)
+		case "create":
+			err = cli.Segment.CreateSegment(conf, conn)
+		case "update":
+			err = cli.Segment.UpdateSegment(conf, conn)
+		case "delete":
+			err = cli.Segment.DeleteSegment(conf, conn)
+		default:
+			panic(fmt.Sprintf("unknown segment command: %s", subcmd))
+		}
+	case "sdkkey":
+		if len(cmd) < 2 {
+			kongCtx.PrintUsage(false)
+			return
+		}
+		subcmd := cmd[1]
+		switch subcmd {
+		case "list":
+			err = cli.Sdkkey.ListSDKKeys(conf, conn)
+		case "create":
+			err = cli.Sdkkey.CreateSDKKey(conf, conn)
+		case "rotate":
+			err = cli.Sdkkey.RotateSDKKeys(conf, conn)
+		case "revoke":
+			err = cli.Sdkkey.RevokeSDKKey(conf, conn)
+		default:
+			panic(fmt.Sprintf("unknown sdkkey command: %s", subcmd))
+		}
 	case "audit":
-		// Implement audit log functionality here
+		if len(cmd) < 2 {
+			kongCtx.PrintUsage(false)
+			return
+		}
+		subcmd := cmd[1]
+		switch subcmd {
+		case "list":
+			err = cli.Audit.ListAuditLogs(conf, conn)
+		case "show":
+			err = cli.Audit.ShowAuditLog(conf, conn)
+		case "diff":
+			err = cli.Audit.DiffAuditLog(conf, conn)
+		default:
+			panic(fmt.Sprintf("unknown audit command: %s", subcmd))
+		}
 	default:
 		panic(fmt.Sprintf("unknown command: %s", kongCtx.Command()))
 
 	}
+	commands.LogErrorDetails(err)
 	kongCtx.FatalIfErrorf(err)
 }
@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+)
+
+// Anonymous is recorded as the actor of changes made without credentials,
+// which the server only allows when authentication is disabled.
+const Anonymous = "anonymous"
+
+// Metadata describes the request making a change. The server attaches it to
+// the context of every call.
+type Metadata struct {
+	UserID    string
+	Reason    string
+	UserAgent string
+	IPAddress string
+}
+
+type metadataKey struct{}
+
+func WithMetadata(ctx context.Context, md Metadata) context.Context {
+	return context.WithValue(ctx, metadataKey{}, md)
+}
+
+// FromContext returns the metadata attached to ctx, or none.
+func FromContext(ctx context.Context) Metadata {
+	md, _ := ctx.Value(metadataKey{}).(Metadata)
+	return md
+}
+
+// Actor returns the user making the request in ctx, or Anonymous.
+func Actor(ctx context.Context) string {
+	if md := FromContext(ctx); md.UserID != "" {
+		return md.UserID
+	}
+	return Anonymous
+}
+
+// Change is a change to one resource. Before is nil for creations and After
+// for deletions.
+type Change struct {
+	Action       string
+	ResourceType string
+	ResourceID   string
+	Project      string
+	Environment  string
+	Before       any
+	After        any
+}
+
+// Snapshot marshals v at the time of the call, for resources that are
+// modified in place before the change is logged.
+func Snapshot(v any) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("error taking audit snapshot: %v", err)
+		return nil
+	}
+	return data
+}
+
+// Log records change on rec with the metadata in ctx. The change has already
+// been made by the time it is logged, so failures are logged rather than
+// returned. A nil rec records nothing.
+func Log(ctx context.Context, rec Recorder, change Change) {
+	if rec == nil {
+		return
+	}
+	md := FromContext(ctx)
+	md.UserID = Actor(ctx)
+	entry := &Entry{
+		UserID:       md.UserID,
+		Action:       change.Action,
+		ResourceType: change.ResourceType,
+		ResourceID:   change.ResourceID,
+		Project:      change.Project,
+		Environment:  change.Environment,
+		Before:       snapshot(change.Before),
+		After:        snapshot(change.After),
+		Reason:       md.Reason,
+		UserAgent:    md.UserAgent,
+		IPAddress:    md.IPAddress,
+	}
+	// Record even when the caller has gone away or timed out.
+	if err := rec.Record(context.WithoutCancel(ctx), entry); err != nil {
+		log.Printf("error recording %s of %s %s by %s: %v", change.Action, change.ResourceType, change.ResourceID, md.UserID, err)
+	}
+}
+
+func snapshot(v any) json.RawMessage {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case json.RawMessage:
+		return v
+	default:
+		return Snapshot(v)
+	}
+}
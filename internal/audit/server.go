@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	ffpb "github.com/julianstephens/feature-flag-service/gen/go/grpc/v1/featureflag.v1"
+)
+
+type AuditGRPCServer struct {
+	ffpb.UnimplementedAuditServiceServer
+	Service Service
+}
+
+func (s *AuditGRPCServer) ListAuditLogs(ctx context.Context, req *ffpb.ListAuditLogsRequest) (*ffpb.ListAuditLogsResponse, error) {
+	filter := Filter{
+		ResourceType: req.ResourceType,
+		ResourceID:   req.ResourceId,
+		UserID:       req.UserId,
+		Action:       req.Action,
+		Project:      req.Project,
+		Environment:  req.Environment,
+		Limit:        int(req.Limit),
+		Offset:       int(req.Offset),
+	}
+	var err error
+	if filter.Since, err = ParseTime(req.Since); err != nil {
+		return nil, grpcError(err)
+	}
+	if filter.Until, err = ParseTime(req.Until); err != nil {
+		return nil, grpcError(err)
+	}
+
+	page, err := s.Service.ListEntries(ctx, filter)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	res := &ffpb.ListAuditLogsResponse{
+		Total:  int32(page.Total),
+		Limit:  int32(page.Limit),
+		Offset: int32(page.Offset),
+	}
+	for _, e := range page.Logs {
+		res.Logs = append(res.Logs, e.ToProto())
+	}
+	return res, nil
+}
+
+func (s *AuditGRPCServer) GetAuditLog(ctx context.Context, req *ffpb.GetAuditLogRequest) (*ffpb.AuditLog, error) {
+	entry, err := s.Service.GetEntry(ctx, req.Id)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return entry.ToProto(), nil
+}
+
+// ParseTime parses an RFC 3339 filter bound. An empty string is no bound.
+func ParseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %q is not an RFC 3339 time", ErrInvalidFilter, s)
+	}
+	return t, nil
+}
+
+func (e *Entry) ToProto() *ffpb.AuditLog {
+	return &ffpb.AuditLog{
+		Id:           e.ID,
+		Timestamp:    e.Timestamp.Format(time.RFC3339Nano),
+		UserId:       e.UserID,
+		Action:       e.Action,
+		ResourceType: e.ResourceType,
+		ResourceId:   e.ResourceID,
+		Project:      e.Project,
+		Environment:  e.Environment,
+		Before:       string(e.Before),
+		After:        string(e.After),
+		Reason:       e.Reason,
+		UserAgent:    e.UserAgent,
+		IpAddress:    e.IPAddress,
+	}
+}
+
+// grpcError maps service errors onto gRPC status codes.
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, ErrEntryNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrInvalidFilter):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return err
+	}
+}
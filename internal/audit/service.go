@@ -0,0 +1,227 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/julianstephens/feature-flag-service/internal/config"
+	"github.com/julianstephens/feature-flag-service/internal/utils"
+)
+
+var (
+	ErrEntryNotFound = errors.New("audit log entry not found")
+	ErrInvalidFilter = errors.New("invalid audit log filter")
+)
+
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+
+	ResourceFlag           = "flag"
+	ResourceRole           = "role"
+	ResourceUser           = "user"
+	ResourceRoleAssignment = "role_assignment"
+	ResourceConfig         = "config"
+	ResourceConfigSchema   = "config_schema"
+	ResourceSegment        = "segment"
+	ResourceProject        = "project"
+	ResourceEnvironment    = "environment"
+	ResourceSDKKey         = "sdk_key"
+
+	// DefaultLimit and MaxLimit bound the entries returned by one List call.
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// Entry records one change: who made it, to what, the resource before and
+// after it, and why.
+type Entry struct {
+	ID           string          `json:"id"`
+	Timestamp    time.Time       `json:"timestamp"`
+	UserID       string          `json:"userId"`
+	Action       string          `json:"action"`
+	ResourceType string          `json:"resourceType"`
+	ResourceID   string          `json:"resourceId"`
+	Project      string          `json:"project,omitempty"`
+	Environment  string          `json:"environment,omitempty"`
+	Before       json.RawMessage `json:"before,omitempty"`
+	After        json.RawMessage `json:"after,omitempty"`
+	Reason       string          `json:"reason,omitempty"`
+	UserAgent    string          `json:"userAgent,omitempty"`
+	IPAddress    string          `json:"ipAddress,omitempty"`
+}
+
+// Filter selects entries. Zero fields match everything. Environment matches
+// changes to that environment and changes not limited to one environment.
+type Filter struct {
+	ResourceType string
+	ResourceID   string
+	UserID       string
+	Action       string
+	Project      string
+	Environment  string
+	Since        time.Time
+	Until        time.Time
+	Limit        int
+	Offset       int
+}
+
+// Page is one page of entries, newest first, with the number of entries
+// matching the filter.
+type Page struct {
+	Logs   []*Entry `json:"logs"`
+	Total  int      `json:"total"`
+	Limit  int      `json:"limit"`
+	Offset int      `json:"offset"`
+}
+
+// Recorder stores audit entries. Services that make changes depend on it
+// rather than on the whole Service.
+type Recorder interface {
+	Record(ctx context.Context, entry *Entry) error
+}
+
+type Service interface {
+	Recorder
+	ListEntries(ctx context.Context, filter Filter) (*Page, error)
+	GetEntry(ctx context.Context, id string) (*Entry, error)
+}
+
+type AuditService struct {
+	conf *config.Config
+	db   *pgxpool.Pool
+}
+
+func NewService(conf *config.Config, db *pgxpool.Pool) Service {
+	return &AuditService{
+		conf: conf,
+		db:   db,
+	}
+}
+
+const entryColumns = `id::text, timestamp, user_id, action, resource_type, resource_id,
+	COALESCE(project, ''), COALESCE(environment, ''), before, after,
+	COALESCE(reason, ''), COALESCE(user_agent, ''), COALESCE(ip_address, '')`
+
+// Record stores entry, assigning its ID and, when unset, its timestamp.
+func (s *AuditService) Record(ctx context.Context, entry *Entry) error {
+	entry.ID = utils.GenerateID()
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+	_, err := s.db.Exec(ctx,
+		`INSERT INTO audit_logs (id, timestamp, user_id, action, resource_type, resource_id,
+			project, environment, before, after, reason, user_agent, ip_address)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), $9, $10, NULLIF($11, ''), NULLIF($12, ''), NULLIF($13, ''))`,
+		entry.ID, entry.Timestamp, entry.UserID, entry.Action, entry.ResourceType, entry.ResourceID,
+		entry.Project, entry.Environment, jsonb(entry.Before), jsonb(entry.After),
+		entry.Reason, entry.UserAgent, entry.IPAddress)
+	return err
+}
+
+func (s *AuditService) ListEntries(ctx context.Context, filter Filter) (*Page, error) {
+	if filter.Limit == 0 {
+		filter.Limit = DefaultLimit
+	}
+	if filter.Limit < 0 || filter.Limit > MaxLimit {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidFilter, MaxLimit)
+	}
+	if filter.Offset < 0 {
+		return nil, fmt.Errorf("%w: offset must not be negative", ErrInvalidFilter)
+	}
+
+	var conds []string
+	var args []any
+	where := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, strings.ReplaceAll(cond, "?", "$"+strconv.Itoa(len(args))))
+	}
+	if filter.ResourceType != "" {
+		where("resource_type = ?", filter.ResourceType)
+	}
+	if filter.ResourceID != "" {
+		where("resource_id = ?", filter.ResourceID)
+	}
+	if filter.UserID != "" {
+		where("user_id = ?", filter.UserID)
+	}
+	if filter.Action != "" {
+		where("action = ?", filter.Action)
+	}
+	if filter.Project != "" {
+		where("project = ?", filter.Project)
+	}
+	if filter.Environment != "" {
+		where("(environment = ? OR environment IS NULL)", filter.Environment)
+	}
+	if !filter.Since.IsZero() {
+		where("timestamp >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		where("timestamp < ?", filter.Until)
+	}
+	clause := ""
+	if len(conds) > 0 {
+		clause = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	page := &Page{Limit: filter.Limit, Offset: filter.Offset}
+	if err := s.db.QueryRow(ctx, "SELECT count(*) FROM audit_logs"+clause, args...).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	rows, err := s.db.Query(ctx,
+		fmt.Sprintf("SELECT %s FROM audit_logs%s ORDER BY timestamp DESC, id LIMIT $%d OFFSET $%d", entryColumns, clause, len(args)-1, len(args)),
+		args...)
+	if err != nil {
+		return nil, err
+	}
+	page.Logs, err = pgx.CollectRows(rows, scanEntry)
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func (s *AuditService) GetEntry(ctx context.Context, id string) (*Entry, error) {
+	rows, err := s.db.Query(ctx, "SELECT "+entryColumns+" FROM audit_logs WHERE id::text = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := pgx.CollectExactlyOneRow(rows, scanEntry)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrEntryNotFound, id)
+	}
+	return entry, err
+}
+
+func scanEntry(row pgx.CollectableRow) (*Entry, error) {
+	var e Entry
+	var before, after []byte
+	err := row.Scan(&e.ID, &e.Timestamp, &e.UserID, &e.Action, &e.ResourceType, &e.ResourceID,
+		&e.Project, &e.Environment, &before, &after, &e.Reason, &e.UserAgent, &e.IPAddress)
+	if err != nil {
+		return nil, err
+	}
+	e.Before = before
+	e.After = after
+	return &e, nil
+}
+
+// jsonb passes a snapshot to Postgres, storing NULL for a missing one.
+func jsonb(snapshot json.RawMessage) any {
+	if len(snapshot) == 0 {
+		return nil
+	}
+	return string(snapshot)
+}
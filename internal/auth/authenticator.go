@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/julianstephens/feature-flag-service/internal/config"
+)
+
+// ErrUnsupportedToken is returned by an Authenticator for tokens of a kind
+// it does not handle, letting the next one in a Chain try.
+var ErrUnsupportedToken = errors.New("unsupported token")
+
+// Authenticator verifies a bearer token and returns the caller it belongs to.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*Principal, error)
+}
+
+// Chain tries each authenticator in turn until one handles the token.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	for _, a := range c {
+		p, err := a.Authenticate(ctx, token)
+		if errors.Is(err, ErrUnsupportedToken) {
+			continue
+		}
+		return p, err
+	}
+	return nil, fmt.Errorf("%w: unrecognized bearer token", ErrUnauthenticated)
+}
+
+// SDKKeys authenticates SDK keys against keys.
+func SDKKeys(keys Service) Authenticator {
+	return sdkKeyAuthenticator{keys: keys}
+}
+
+type sdkKeyAuthenticator struct {
+	keys Service
+}
+
+func (a sdkKeyAuthenticator) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	if !IsSDKKey(token) {
+		return nil, ErrUnsupportedToken
+	}
+	return a.keys.ResolveSDKKey(ctx, token)
+}
+
+// Authentication is the credential check the REST and gRPC servers apply to
+// every request.
+type Authentication struct {
+	Authenticator Authenticator
+	// Required refuses requests that carry no credentials. Without it they
+	// are let through with no principal.
+	Required bool
+}
+
+// NewAuthentication accepts SDK keys and JWTs, which need JWT_SECRET or
+// JWT_JWKS. Only in DEV_MODE may both be unset, and requests without
+// credentials are then let through.
+func NewAuthentication(conf *config.Config, keys Service) (*Authentication, error) {
+	chain := Chain{SDKKeys(keys)}
+	if conf.JWTSecret == "" && conf.JWTJWKS == "" {
+		if !conf.DevMode {
+			return nil, errors.New("JWT_SECRET or JWT_JWKS must be set unless DEV_MODE is on")
+		}
+		log.Printf("Warning: DEV_MODE is on and JWT_SECRET and JWT_JWKS are unset; requests without credentials are not authenticated")
+		return &Authentication{Authenticator: chain}, nil
+	}
+
+	jwtAuth, err := NewJWTAuthenticator(conf)
+	if err != nil {
+		return nil, err
+	}
+	return &Authentication{Authenticator: append(chain, jwtAuth), Required: true}, nil
+}
@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/julianstephens/feature-flag-service/internal/config"
+)
+
+const (
+	// jwtLeeway absorbs clock skew between the issuer and this service.
+	jwtLeeway = 30 * time.Second
+	// jwksMinRefresh limits how often an unknown key ID triggers a refetch.
+	jwksMinRefresh = time.Minute
+)
+
+// userClaims are the JWT claims a user principal is built from.
+type userClaims struct {
+	jwt.RegisteredClaims
+	Email string `json:"email,omitempty"`
+}
+
+// JWTAuthenticator verifies HS256 JWTs signed with JWT_SECRET and RS256 JWTs
+// signed with a key from the JWT_JWKS key set.
+type JWTAuthenticator struct {
+	secret []byte
+	jwks   *jwks
+	parser *jwt.Parser
+}
+
+func NewJWTAuthenticator(conf *config.Config) (*JWTAuthenticator, error) {
+	a := &JWTAuthenticator{}
+	var methods []string
+	if conf.JWTSecret != "" {
+		a.secret = []byte(conf.JWTSecret)
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if conf.JWTJWKS != "" {
+		a.jwks = &jwks{source: conf.JWTJWKS, refresh: conf.JWTJWKSRefresh, client: &http.Client{Timeout: 10 * time.Second}}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := a.jwks.load(ctx); err != nil {
+			return nil, fmt.Errorf("loading JWKS from %s: %w", conf.JWTJWKS, err)
+		}
+		methods = append(methods, jwt.SigningMethodRS256.Alg())
+	}
+	if len(methods) == 0 {
+		return nil, errors.New("JWT_SECRET or JWT_JWKS must be set")
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(jwtLeeway),
+	}
+	if conf.JWTIssuer != "" {
+		opts = append(opts, jwt.WithIssuer(conf.JWTIssuer))
+	}
+	if conf.JWTAudience != "" {
+		opts = append(opts, jwt.WithAudience(conf.JWTAudience))
+	}
+	a.parser = jwt.NewParser(opts...)
+	return a, nil
+}
+
+func (a *JWTAuthenticator) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	var claims userClaims
+	_, err := a.parser.ParseWithClaims(token, &claims, func(t *jwt.Token) (any, error) {
+		switch t.Method.Alg() {
+		case jwt.SigningMethodHS256.Alg():
+			return a.secret, nil
+		case jwt.SigningMethodRS256.Alg():
+			kid, _ := t.Header["kid"].(string)
+			return a.jwks.key(ctx, kid)
+		default:
+			return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: token has no subject", ErrUnauthenticated)
+	}
+	return &Principal{Kind: KindUser, Subject: claims.Subject, Email: claims.Email}, nil
+}
+
+// jwks is an RSA key set read from a file or URL. It is reloaded every
+// refresh interval and whenever a token names a key it does not hold.
+type jwks struct {
+	source  string
+	refresh time.Duration
+	client  *http.Client
+
+	mu     sync.Mutex
+	keys   map[string]*rsa.PublicKey
+	loaded time.Time
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func (k *jwks) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	_, known := k.keys[kid]
+	age := time.Since(k.loaded)
+	if (k.refresh > 0 && age > k.refresh) || (!known && age > jwksMinRefresh) {
+		// Keep serving the keys we have if the source is unavailable.
+		if err := k.load(ctx); err != nil {
+			log.Printf("error reloading JWKS from %s: %v", k.source, err)
+		}
+	}
+
+	if kid == "" && len(k.keys) == 1 {
+		for _, key := range k.keys {
+			return key, nil
+		}
+	}
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// load replaces the key set. Callers other than the constructor hold mu.
+func (k *jwks) load(ctx context.Context) error {
+	data, err := k.read(ctx)
+	if err != nil {
+		return err
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		key, err := jwk.rsaKey()
+		if err != nil {
+			log.Printf("error parsing JWKS key %q: %v", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return errors.New("no RSA signing keys found")
+	}
+	k.keys = keys
+	k.loaded = time.Now()
+	return nil
+}
+
+func (k *jwks) read(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(k.source, "http://") && !strings.HasPrefix(k.source, "https://") {
+		return os.ReadFile(k.source)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (jwk *jsonWebKey) rsaKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %w", err)
+	}
+	exp := new(big.Int).SetBytes(e)
+	if !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid exponent")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+}
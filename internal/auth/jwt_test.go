@@ -0,0 +1,279 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/julianstephens/feature-flag-service/internal/config"
+)
+
+const (
+	testSecret   = "s3cr3t-for-tests-only"
+	testIssuer   = "https://idp.example.com/"
+	testAudience = "feature-flag-service"
+)
+
+var (
+	rsaFixtureOnce sync.Once
+	rsaFixtures    [2]*rsa.PrivateKey
+)
+
+// rsaKeys returns two RSA keys shared by the tests of this package.
+func rsaKeys(t *testing.T) (*rsa.PrivateKey, *rsa.PrivateKey) {
+	t.Helper()
+	rsaFixtureOnce.Do(func() {
+		for i := range rsaFixtures {
+			key, err := rsa.GenerateKey(rand.Reader, 2048)
+			if err != nil {
+				panic(err)
+			}
+			rsaFixtures[i] = key
+		}
+	})
+	return rsaFixtures[0], rsaFixtures[1]
+}
+
+// keySet is a JWKS document served by an httptest server; set swaps the
+// keys it serves and fail makes it answer 500.
+type keySet struct {
+	mu    sync.Mutex
+	keys  map[string]*rsa.PublicKey
+	fail  bool
+	reads int
+}
+
+func (s *keySet) set(keys map[string]*rsa.PublicKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+func (s *keySet) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reads++
+	if s.fail {
+		http.Error(w, "unavailable", http.StatusInternalServerError)
+		return
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	for kid, key := range s.keys {
+		set.Keys = append(set.Keys, jsonWebKey{
+			Kid: kid,
+			Kty: "RSA",
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	json.NewEncoder(w).Encode(set)
+}
+
+func validClaims() userClaims {
+	now := time.Now()
+	return userClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "ada",
+			Issuer:    testIssuer,
+			Audience:  jwt.ClaimStrings{testAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+		Email: "ada@example.com",
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key any, claims userClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func newTestJWTAuthenticator(t *testing.T, conf config.Config) *JWTAuthenticator {
+	t.Helper()
+	conf.JWTIssuer = testIssuer
+	conf.JWTAudience = testAudience
+	a, err := NewJWTAuthenticator(&conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestJWTAuthenticatorHS256(t *testing.T) {
+	a := newTestJWTAuthenticator(t, config.Config{JWTSecret: testSecret})
+
+	p, err := a.Authenticate(context.Background(), sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), validClaims()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Kind != KindUser || p.Subject != "ada" || p.Email != "ada@example.com" {
+		t.Errorf("principal = %+v; want user ada", p)
+	}
+
+	forged := sign(t, jwt.SigningMethodHS256, "", []byte("another secret"), validClaims())
+	if _, err := a.Authenticate(context.Background(), forged); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("token signed with another secret: err = %v; want ErrUnauthenticated", err)
+	}
+}
+
+func TestJWTAuthenticatorRS256(t *testing.T) {
+	key, other := rsaKeys(t)
+	server := httptest.NewServer(&keySet{keys: map[string]*rsa.PublicKey{"k1": &key.PublicKey}})
+	defer server.Close()
+	a := newTestJWTAuthenticator(t, config.Config{JWTJWKS: server.URL})
+
+	p, err := a.Authenticate(context.Background(), sign(t, jwt.SigningMethodRS256, "k1", key, validClaims()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Subject != "ada" {
+		t.Errorf("principal = %+v; want ada", p)
+	}
+	// A set holding a single key also verifies tokens naming no key.
+	if _, err := a.Authenticate(context.Background(), sign(t, jwt.SigningMethodRS256, "", key, validClaims())); err != nil {
+		t.Errorf("token without kid: %v", err)
+	}
+
+	forged := sign(t, jwt.SigningMethodRS256, "k1", other, validClaims())
+	if _, err := a.Authenticate(context.Background(), forged); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("token signed with a key outside the set: err = %v; want ErrUnauthenticated", err)
+	}
+	unknown := sign(t, jwt.SigningMethodRS256, "k9", key, validClaims())
+	if _, err := a.Authenticate(context.Background(), unknown); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("token naming an unknown key: err = %v; want ErrUnauthenticated", err)
+	}
+}
+
+func TestJWTAuthenticatorJWKSRefresh(t *testing.T) {
+	ctx := context.Background()
+	first, second := rsaKeys(t)
+	keys := &keySet{keys: map[string]*rsa.PublicKey{"k1": &first.PublicKey}}
+	server := httptest.NewServer(keys)
+	defer server.Close()
+	a := newTestJWTAuthenticator(t, config.Config{JWTJWKS: server.URL, JWTJWKSRefresh: time.Hour})
+
+	// The issuer rotates to k2. A token naming it is refused until the set
+	// is old enough to be refetched for an unknown key.
+	keys.set(map[string]*rsa.PublicKey{"k2": &second.PublicKey})
+	rotated := sign(t, jwt.SigningMethodRS256, "k2", second, validClaims())
+	if _, err := a.Authenticate(ctx, rotated); !errors.Is(err, ErrUnauthenticated) {
+		t.Fatalf("token naming a key fetched moments ago: err = %v; want ErrUnauthenticated", err)
+	}
+	if keys.reads != 1 {
+		t.Errorf("JWKS read %d times; want once, the unknown key within jwksMinRefresh", keys.reads)
+	}
+	a.jwks.loaded = time.Now().Add(-2 * jwksMinRefresh)
+	if _, err := a.Authenticate(ctx, rotated); err != nil {
+		t.Fatalf("token naming the rotated key: %v", err)
+	}
+	if _, err := a.Authenticate(ctx, sign(t, jwt.SigningMethodRS256, "k1", first, validClaims())); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("token naming the retired key: err = %v; want ErrUnauthenticated", err)
+	}
+
+	// Past the refresh interval the set is reloaded even for known keys, and
+	// an unavailable source leaves the keys in place.
+	keys.fail = true
+	a.jwks.loaded = time.Now().Add(-2 * time.Hour)
+	if _, err := a.Authenticate(ctx, rotated); err != nil {
+		t.Errorf("token while the JWKS is unavailable: %v", err)
+	}
+	if keys.reads != 3 {
+		t.Errorf("JWKS read %d times; want 3", keys.reads)
+	}
+}
+
+func TestJWTAuthenticatorRejects(t *testing.T) {
+	key, _ := rsaKeys(t)
+	server := httptest.NewServer(&keySet{keys: map[string]*rsa.PublicKey{"k1": &key.PublicKey}})
+	defer server.Close()
+	hs := newTestJWTAuthenticator(t, config.Config{JWTSecret: testSecret})
+	rs := newTestJWTAuthenticator(t, config.Config{JWTJWKS: server.URL})
+
+	with := func(edit func(*userClaims)) userClaims {
+		c := validClaims()
+		edit(&c)
+		return c
+	}
+	none, err := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The public key as an HMAC secret: the classic algorithm confusion.
+	publicKey := key.PublicKey.N.Bytes()
+
+	tests := []struct {
+		name  string
+		authn *JWTAuthenticator
+		token string
+	}{
+		{"RS256 without a key set", hs, sign(t, jwt.SigningMethodRS256, "k1", key, validClaims())},
+		{"HS256 without a secret", rs, sign(t, jwt.SigningMethodHS256, "k1", publicKey, validClaims())},
+		{"HS384", hs, sign(t, jwt.SigningMethodHS384, "", []byte(testSecret), validClaims())},
+		{"RS512", rs, sign(t, jwt.SigningMethodRS512, "k1", key, validClaims())},
+		{"unsigned", hs, none},
+		{"wrong audience", hs, sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), with(func(c *userClaims) {
+			c.Audience = jwt.ClaimStrings{"another-service"}
+		}))},
+		{"no audience", rs, sign(t, jwt.SigningMethodRS256, "k1", key, with(func(c *userClaims) { c.Audience = nil }))},
+		{"wrong issuer", rs, sign(t, jwt.SigningMethodRS256, "k1", key, with(func(c *userClaims) {
+			c.Issuer = "https://evil.example.com/"
+		}))},
+		{"expired", hs, sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), with(func(c *userClaims) {
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-jwtLeeway - time.Minute))
+		}))},
+		{"no expiry", hs, sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), with(func(c *userClaims) { c.ExpiresAt = nil }))},
+		{"not yet valid", rs, sign(t, jwt.SigningMethodRS256, "k1", key, with(func(c *userClaims) {
+			c.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Hour))
+		}))},
+		{"no subject", hs, sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), with(func(c *userClaims) { c.Subject = "" }))},
+		{"malformed", hs, "not.a.jwt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if p, err := tt.authn.Authenticate(context.Background(), tt.token); !errors.Is(err, ErrUnauthenticated) {
+				t.Errorf("Authenticate = %+v, %v; want ErrUnauthenticated", p, err)
+			}
+		})
+	}
+
+	// Clock skew within the leeway is tolerated.
+	late := sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), with(func(c *userClaims) {
+		c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-jwtLeeway / 2))
+	}))
+	if _, err := hs.Authenticate(context.Background(), late); err != nil {
+		t.Errorf("token expired within the leeway: %v", err)
+	}
+}
+
+func TestNewJWTAuthenticatorRequiresKeys(t *testing.T) {
+	if _, err := NewJWTAuthenticator(&config.Config{}); err == nil {
+		t.Error("NewJWTAuthenticator without a secret or key set succeeded")
+	}
+	server := httptest.NewServer(&keySet{fail: true})
+	defer server.Close()
+	if _, err := NewJWTAuthenticator(&config.Config{JWTJWKS: server.URL}); err == nil {
+		t.Error("NewJWTAuthenticator with an unavailable key set succeeded")
+	}
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrUnauthenticated = errors.New("unauthenticated")
+	ErrForbidden       = errors.New("forbidden")
+)
+
+const (
+	// KindSDK principals authenticated with an SDK key. They may only
+	// evaluate and stream the flags of their own environment.
+	KindSDK = "sdk"
+	// KindUser principals authenticated with a JWT.
+	KindUser = "user"
+)
+
+// Principal is the caller a request was authenticated as.
+type Principal struct {
+	Kind string `json:"kind"`
+	// Subject and Email identify a user.
+	Subject string `json:"subject,omitempty"`
+	Email   string `json:"email,omitempty"`
+	// Project and Environment pin an SDK key.
+	Project     string `json:"project,omitempty"`
+	Environment string `json:"environment,omitempty"`
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal of the request, or nil when the request
+// carried no credentials.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// IsSDK reports whether p was authenticated with an SDK key.
+func (p *Principal) IsSDK() bool {
+	return p != nil && p.Kind == KindSDK
+}
+
+// IsUser reports whether p was authenticated with a JWT.
+func (p *Principal) IsUser() bool {
+	return p != nil && p.Kind == KindUser
+}
+
+// Scope resolves the project and environment a request acts on. SDK
+// principals are pinned to their own environment: empty values are filled
+// in and any other project or environment is refused.
+func (p *Principal) Scope(project, env string) (string, string, error) {
+	if !p.IsSDK() {
+		return project, env, nil
+	}
+	if project != "" && project != p.Project {
+		return "", "", fmt.Errorf("%w: SDK key is not valid for project %s", ErrForbidden, project)
+	}
+	if env != "" && env != p.Environment {
+		return "", "", fmt.Errorf("%w: SDK key is not valid for environment %s", ErrForbidden, env)
+	}
+	return p.Project, p.Environment, nil
+}
@@ -0,0 +1,270 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/julianstephens/feature-flag-service/internal/audit"
+	"github.com/julianstephens/feature-flag-service/internal/config"
+	"github.com/julianstephens/feature-flag-service/internal/project"
+	"github.com/julianstephens/feature-flag-service/internal/storage"
+	"github.com/julianstephens/feature-flag-service/internal/utils"
+)
+
+var ErrSDKKeyNotFound = errors.New("sdk key not found")
+
+// SDKKeyPrefix starts every SDK key, telling them apart from other bearer
+// credentials.
+const SDKKeyPrefix = "sdk-"
+
+// IsSDKKey reports whether a bearer token is an SDK key.
+func IsSDKKey(token string) bool {
+	return strings.HasPrefix(token, SDKKeyPrefix)
+}
+
+// SDKKey grants evaluation access to one environment of a project. Only a
+// hash of the key is stored; Key is set once, when the key is issued.
+type SDKKey struct {
+	ID          string    `json:"id"`
+	Key         string    `json:"key,omitempty"`
+	Hint        string    `json:"hint"`
+	Project     string    `json:"project"`
+	Environment string    `json:"environment"`
+	CreatedAt   time.Time `json:"createdAt"`
+	// ExpiresAt is set on keys replaced by a rotation. They keep working
+	// until then.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+type Service interface {
+	CreateSDKKey(ctx context.Context, projectKey, env string) (*SDKKey, error)
+	RotateSDKKeys(ctx context.Context, projectKey, env string, grace *time.Duration) (*SDKKey, error)
+	RevokeSDKKey(ctx context.Context, projectKey, env, id string) error
+	ListSDKKeys(ctx context.Context, projectKey, env string) ([]*SDKKey, error)
+	ResolveSDKKey(ctx context.Context, key string) (*Principal, error)
+}
+
+type SDKKeyService struct {
+	conf     *config.Config
+	store    storage.Store
+	prefix   string
+	projects project.Service
+	audit    audit.Recorder
+}
+
+func NewService(conf *config.Config, store storage.Store, projects project.Service, recorder audit.Recorder) Service {
+	return &SDKKeyService{
+		conf:     conf,
+		store:    store,
+		prefix:   conf.SDKKeyServicePrefix,
+		projects: projects,
+		audit:    recorder,
+	}
+}
+
+// GetKey returns the store key of an SDK key, indexed by its hash.
+func (s *SDKKeyService) GetKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return s.prefix + hex.EncodeToString(sum[:])
+}
+
+// CreateSDKKey issues an additional key for an environment.
+func (s *SDKKeyService) CreateSDKKey(ctx context.Context, projectKey, env string) (*SDKKey, error) {
+	if _, err := s.projects.GetEnvironment(ctx, projectKey, env); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	raw := SDKKeyPrefix + hex.EncodeToString(buf)
+	key := &SDKKey{
+		ID:          utils.GenerateID(),
+		Hint:        raw[len(raw)-4:],
+		Project:     projectKey,
+		Environment: env,
+		CreatedAt:   time.Now(),
+	}
+
+	data, err := json.Marshal(key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.store.Put(ctx, s.GetKey(raw), string(data)); err != nil {
+		return nil, err
+	}
+	// Logged before Key is set: the log only ever sees the hint.
+	audit.Log(ctx, s.audit, s.change(audit.ActionCreate, key, nil, key))
+	key.Key = raw
+	return key, nil
+}
+
+// RotateSDKKeys issues a new key for an environment. Existing keys keep
+// working for the grace period, SDK_KEY_GRACE_PERIOD when nil, and are then
+// removed; with a zero grace period they are revoked straight away.
+func (s *SDKKeyService) RotateSDKKeys(ctx context.Context, projectKey, env string, gracePeriod *time.Duration) (*SDKKey, error) {
+	grace := s.conf.SDKKeyGracePeriod
+	if gracePeriod != nil {
+		grace = *gracePeriod
+	}
+	old, err := s.keys(ctx, projectKey, env)
+	if err != nil {
+		return nil, err
+	}
+	key, err := s.CreateSDKKey(ctx, projectKey, env)
+	if err != nil {
+		return nil, err
+	}
+
+	if grace <= 0 {
+		for storeKey, k := range old {
+			if err := s.store.Delete(ctx, storeKey); err != nil && !errors.Is(err, storage.ErrKeyNotFound) {
+				return nil, err
+			}
+			audit.Log(ctx, s.audit, s.change(audit.ActionDelete, k, k, nil))
+		}
+		return key, nil
+	}
+
+	expiresAt := time.Now().Add(grace)
+	var ops []storage.Op
+	var changes []audit.Change
+	for storeKey, k := range old {
+		if k.ExpiresAt != nil && k.ExpiresAt.Before(expiresAt) {
+			continue
+		}
+		before := audit.Snapshot(k)
+		k.ExpiresAt = &expiresAt
+		data, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, storage.Put(storeKey, string(data), storage.WithTTL(grace)))
+		changes = append(changes, s.change(audit.ActionUpdate, k, before, k))
+	}
+	if len(ops) > 0 {
+		if _, err := s.store.Txn(ctx, nil, ops...); err != nil {
+			return nil, err
+		}
+	}
+	for _, change := range changes {
+		audit.Log(ctx, s.audit, change)
+	}
+	return key, nil
+}
+
+func (s *SDKKeyService) RevokeSDKKey(ctx context.Context, projectKey, env, id string) error {
+	keys, err := s.keys(ctx, projectKey, env)
+	if err != nil {
+		return err
+	}
+	for storeKey, k := range keys {
+		if k.ID == id {
+			if err := s.store.Delete(ctx, storeKey); err != nil {
+				return err
+			}
+			audit.Log(ctx, s.audit, s.change(audit.ActionDelete, k, k, nil))
+			return nil
+		}
+	}
+	return ErrSDKKeyNotFound
+}
+
+// change describes a change to key for the audit log.
+func (s *SDKKeyService) change(action string, key *SDKKey, before, after any) audit.Change {
+	return audit.Change{
+		Action:       action,
+		ResourceType: audit.ResourceSDKKey,
+		ResourceID:   key.ID,
+		Project:      key.Project,
+		Environment:  key.Environment,
+		Before:       before,
+		After:        after,
+	}
+}
+
+func (s *SDKKeyService) ListSDKKeys(ctx context.Context, projectKey, env string) ([]*SDKKey, error) {
+	if _, err := s.projects.GetEnvironment(ctx, projectKey, env); err != nil {
+		return nil, err
+	}
+	keys, err := s.keys(ctx, projectKey, env)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*SDKKey, 0, len(keys))
+	for _, k := range keys {
+		list = append(list, k)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list, nil
+}
+
+// ResolveSDKKey returns the principal an SDK key authenticates as. Keys of
+// environments that no longer exist are rejected.
+func (s *SDKKeyService) ResolveSDKKey(ctx context.Context, key string) (*Principal, error) {
+	if !IsSDKKey(key) {
+		return nil, fmt.Errorf("%w: not an SDK key", ErrUnauthenticated)
+	}
+	resp, err := s.store.Get(ctx, s.GetKey(key))
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		return nil, fmt.Errorf("%w: unknown SDK key", ErrUnauthenticated)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var k SDKKey
+	if err := json.Unmarshal([]byte(resp.Value), &k); err != nil {
+		return nil, err
+	}
+	// The store removes expired keys, but not necessarily right away.
+	if k.ExpiresAt != nil && time.Now().After(*k.ExpiresAt) {
+		return nil, fmt.Errorf("%w: SDK key has expired", ErrUnauthenticated)
+	}
+	// Keys are deleted with their environment; these checks cover keys issued
+	// while it was being deleted, which would otherwise come back to life if
+	// an environment with the same key is created again.
+	env, err := s.projects.GetEnvironment(ctx, k.Project, k.Environment)
+	if errors.Is(err, project.ErrProjectNotFound) || errors.Is(err, project.ErrEnvironmentNotFound) {
+		return nil, fmt.Errorf("%w: SDK key's environment no longer exists", ErrUnauthenticated)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if k.CreatedAt.Before(env.CreatedAt) {
+		return nil, fmt.Errorf("%w: SDK key was issued for a deleted environment", ErrUnauthenticated)
+	}
+	return &Principal{Kind: KindSDK, Project: k.Project, Environment: k.Environment}, nil
+}
+
+// keys returns the keys of an environment by store key.
+func (s *SDKKeyService) keys(ctx context.Context, projectKey, env string) (map[string]*SDKKey, error) {
+	res, err := s.store.List(ctx, s.prefix, storage.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*SDKKey)
+	for _, kv := range res.KVs {
+		storeKey := kv.Key
+		var k SDKKey
+		if err := json.Unmarshal([]byte(kv.Value), &k); err != nil {
+			log.Printf("error unmarshaling sdk key: %v", err)
+			continue
+		}
+		if k.Project == projectKey && k.Environment == env {
+			keys[storeKey] = &k
+		}
+	}
+	return keys, nil
+}
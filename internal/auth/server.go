@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	ffpb "github.com/julianstephens/feature-flag-service/gen/go/grpc/v1/featureflag.v1"
+	"github.com/julianstephens/feature-flag-service/internal/project"
+)
+
+type SDKKeyGRPCServer struct {
+	ffpb.UnimplementedSDKKeyServiceServer
+	Service Service
+}
+
+func (s *SDKKeyGRPCServer) ListSDKKeys(ctx context.Context, req *ffpb.ListSDKKeysRequest) (*ffpb.ListSDKKeysResponse, error) {
+	keys, err := s.Service.ListSDKKeys(ctx, req.Project, req.Environment)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	var protoKeys []*ffpb.SDKKey
+	for _, k := range keys {
+		protoKeys = append(protoKeys, k.ToProto())
+	}
+	return &ffpb.ListSDKKeysResponse{Keys: protoKeys}, nil
+}
+
+func (s *SDKKeyGRPCServer) CreateSDKKey(ctx context.Context, req *ffpb.CreateSDKKeyRequest) (*ffpb.SDKKey, error) {
+	key, err := s.Service.CreateSDKKey(ctx, req.Project, req.Environment)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return key.ToProto(), nil
+}
+
+func (s *SDKKeyGRPCServer) RotateSDKKeys(ctx context.Context, req *ffpb.RotateSDKKeysRequest) (*ffpb.SDKKey, error) {
+	var grace *time.Duration
+	if req.GracePeriodSeconds != nil {
+		d := time.Duration(*req.GracePeriodSeconds) * time.Second
+		grace = &d
+	}
+	key, err := s.Service.RotateSDKKeys(ctx, req.Project, req.Environment, grace)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return key.ToProto(), nil
+}
+
+func (s *SDKKeyGRPCServer) RevokeSDKKey(ctx context.Context, req *ffpb.RevokeSDKKeyRequest) (*ffpb.RevokeSDKKeyResponse, error) {
+	if err := s.Service.RevokeSDKKey(ctx, req.Project, req.Environment, req.Id); err != nil {
+		return nil, grpcError(err)
+	}
+	return &ffpb.RevokeSDKKeyResponse{}, nil
+}
+
+func (k *SDKKey) ToProto() *ffpb.SDKKey {
+	key := &ffpb.SDKKey{
+		Id:          k.ID,
+		Key:         k.Key,
+		Hint:        k.Hint,
+		Project:     k.Project,
+		Environment: k.Environment,
+		CreatedAt:   k.CreatedAt.Format(time.RFC3339),
+	}
+	if k.ExpiresAt != nil {
+		key.ExpiresAt = k.ExpiresAt.Format(time.RFC3339)
+	}
+	return key
+}
+
+// grpcError maps service errors onto gRPC status codes.
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, ErrSDKKeyNotFound), errors.Is(err, project.ErrProjectNotFound), errors.Is(err, project.ErrEnvironmentNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrUnauthenticated):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, ErrForbidden):
+		return status.Error(codes.PermissionDenied, err.Error())
+	default:
+		return err
+	}
+}
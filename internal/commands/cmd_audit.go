@@ -0,0 +1,336 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	ffpb "github.com/julianstephens/feature-flag-service/gen/go/grpc/v1/featureflag.v1"
+	"github.com/julianstephens/feature-flag-service/internal/config"
+	"github.com/julianstephens/feature-flag-service/internal/utils"
+)
+
+var (
+	removedStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+	addedStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	changedStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("3"))
+)
+
+type AuditCommand struct {
+	List struct {
+		Flag     string        `help:"Only changes to this flag, by key or ID. Keys are looked up in --project."`
+		User     string        `help:"Only changes made by this user (email or token subject)."`
+		Action   string        `enum:",create,update,delete" default:"" help:"Only changes of this kind (create, update, delete)."`
+		Project  string        `short:"p" help:"Only changes in this project."`
+		Env      string        `short:"e" help:"Only changes to this environment, including changes to whole flags."`
+		Since    string        `help:"Only changes at or after this time, as RFC 3339 or a duration ago (e.g. 24h)."`
+		Until    string        `help:"Only changes before this time, as RFC 3339 or a duration ago."`
+		Limit    int           `default:"50" help:"Maximum number of entries to show."`
+		Follow   bool          `short:"f" help:"Keep printing new entries as they are recorded."`
+		Interval time.Duration `default:"2s" help:"How often --follow polls for new entries."`
+	} `cmd:"" help:"List audit log entries, newest first."`
+	Show struct {
+		ID string `arg:"" help:"ID of the audit log entry."`
+	} `cmd:"" help:"Show an audit log entry and the change it records."`
+	Diff struct {
+		ID string `arg:"" help:"ID of the audit log entry."`
+	} `cmd:"" help:"Show the before/after difference of an audit log entry."`
+}
+
+// resolveFlagID returns the ID of the flag with the given key or ID. Flags
+// that no longer exist can only be named by ID, which is returned as is.
+func resolveFlagID(conn *grpc.ClientConn, project, ref string) (string, error) {
+	flag, err := ffpb.NewFlagServiceClient(conn).GetFlag(context.Background(), &ffpb.GetFlagRequest{Id: ref, Project: project})
+	if status.Code(err) == codes.NotFound {
+		return ref, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return flag.Id, nil
+}
+
+func (c *AuditCommand) ListAuditLogs(conf *config.Config, conn *grpc.ClientConn) error {
+	client := ffpb.NewAuditServiceClient(conn)
+	req := &ffpb.ListAuditLogsRequest{
+		UserId:      c.List.User,
+		Action:      c.List.Action,
+		Project:     c.List.Project,
+		Environment: c.List.Env,
+		Limit:       int32(c.List.Limit),
+	}
+	if c.List.Flag != "" {
+		id, err := resolveFlagID(conn, c.List.Project, c.List.Flag)
+		if err != nil {
+			log.Error("Failed to look up flag", "flag", c.List.Flag)
+			return err
+		}
+		req.ResourceType = "flag"
+		req.ResourceId = id
+	}
+	var err error
+	if req.Since, err = parseTimeFlag(c.List.Since); err != nil {
+		log.Error("Invalid --since", "since", c.List.Since)
+		return err
+	}
+	if req.Until, err = parseTimeFlag(c.List.Until); err != nil {
+		log.Error("Invalid --until", "until", c.List.Until)
+		return err
+	}
+
+	res, err := client.ListAuditLogs(context.Background(), req)
+	if err != nil {
+		log.Error("Failed to list audit logs")
+		return err
+	}
+
+	if !c.List.Follow {
+		if len(res.Logs) == 0 {
+			log.Info("No audit log entries found")
+			return nil
+		}
+		var rows [][]string
+		for _, e := range res.Logs {
+			rows = append(rows, []string{e.Id, e.Timestamp, e.UserId, e.Action, e.ResourceType, e.ResourceId, e.Environment, e.Reason})
+		}
+		utils.PrintTable([]string{"ID", "Time", "User", "Action", "Resource", "Resource ID", "Environment", "Reason"}, rows)
+		if int(res.Total) > len(res.Logs) {
+			log.Info(fmt.Sprintf("Showing %d of %d entries", len(res.Logs), res.Total))
+		}
+		return nil
+	}
+
+	return c.follow(client, req, res.Logs)
+}
+
+// follow prints the entries already found oldest first, then polls for
+// entries recorded since the newest one printed. Entries sharing that
+// timestamp are remembered so they are not printed twice.
+func (c *AuditCommand) follow(client ffpb.AuditServiceClient, req *ffpb.ListAuditLogsRequest, logs []*ffpb.AuditLog) error {
+	seen := make(map[string]bool)
+	var last time.Time
+	printNew := func(logs []*ffpb.AuditLog) {
+		for _, e := range slices.Backward(logs) {
+			if seen[e.Id] {
+				continue
+			}
+			ts, err := time.Parse(time.RFC3339Nano, e.Timestamp)
+			if err != nil {
+				log.Warn("Skipping entry with invalid timestamp", "id", e.Id, "timestamp", e.Timestamp)
+				continue
+			}
+			if ts.After(last) {
+				last = ts
+				clear(seen)
+			}
+			seen[e.Id] = true
+			fmt.Printf("%s  %s  %s %s %s  %s  %s\n", e.Timestamp, e.UserId, e.Action, e.ResourceType, e.ResourceId, e.Environment, e.Reason)
+		}
+	}
+	printNew(logs)
+
+	req.Limit = 1000
+	req.Until = ""
+	for range time.Tick(c.List.Interval) {
+		if !last.IsZero() {
+			req.Since = last.Format(time.RFC3339Nano)
+		}
+		res, err := client.ListAuditLogs(context.Background(), req)
+		if err != nil {
+			log.Error("Failed to poll audit logs")
+			return err
+		}
+		printNew(res.Logs)
+	}
+	return nil
+}
+
+func (c *AuditCommand) ShowAuditLog(conf *config.Config, conn *grpc.ClientConn) error {
+	client := ffpb.NewAuditServiceClient(conn)
+
+	entry, err := client.GetAuditLog(context.Background(), &ffpb.GetAuditLogRequest{Id: c.Show.ID})
+	if err != nil {
+		log.Error("Failed to get audit log entry")
+		return err
+	}
+
+	fmt.Printf("ID: %s\n", entry.Id)
+	fmt.Printf("Time: %s\n", entry.Timestamp)
+	fmt.Printf("User: %s\n", entry.UserId)
+	fmt.Printf("Action: %s\n", entry.Action)
+	fmt.Printf("Resource: %s %s\n", entry.ResourceType, entry.ResourceId)
+	if entry.Project != "" {
+		fmt.Printf("Project: %s\n", entry.Project)
+	}
+	if entry.Environment != "" {
+		fmt.Printf("Environment: %s\n", entry.Environment)
+	}
+	if entry.Reason != "" {
+		fmt.Printf("Reason: %s\n", entry.Reason)
+	}
+	if entry.UserAgent != "" || entry.IpAddress != "" {
+		fmt.Printf("Client: %s %s\n", entry.IpAddress, entry.UserAgent)
+	}
+	fmt.Println("Changes:")
+	return printDiff(entry)
+}
+
+func (c *AuditCommand) DiffAuditLog(conf *config.Config, conn *grpc.ClientConn) error {
+	client := ffpb.NewAuditServiceClient(conn)
+
+	entry, err := client.GetAuditLog(context.Background(), &ffpb.GetAuditLogRequest{Id: c.Diff.ID})
+	if err != nil {
+		log.Error("Failed to get audit log entry")
+		return err
+	}
+	return printDiff(entry)
+}
+
+// parseTimeFlag accepts an RFC 3339 time or a duration before now.
+func parseTimeFlag(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d).Format(time.RFC3339Nano), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(time.RFC3339Nano), nil
+}
+
+// diffLine is one changed value: Op is '+' for added, '-' for removed and
+// '~' for changed.
+type diffLine struct {
+	Op     byte
+	Path   string
+	Before any
+	After  any
+}
+
+func printDiff(entry *ffpb.AuditLog) error {
+	var before, after any
+	if entry.Before != "" {
+		if err := json.Unmarshal([]byte(entry.Before), &before); err != nil {
+			log.Error("Invalid before snapshot")
+			return err
+		}
+	}
+	if entry.After != "" {
+		if err := json.Unmarshal([]byte(entry.After), &after); err != nil {
+			log.Error("Invalid after snapshot")
+			return err
+		}
+	}
+
+	// List the fields of created and deleted resources one per line.
+	if before == nil {
+		if _, ok := after.(map[string]any); ok {
+			before = map[string]any{}
+		}
+	}
+	if after == nil {
+		if _, ok := before.(map[string]any); ok {
+			after = map[string]any{}
+		}
+	}
+
+	var lines []diffLine
+	diffJSON("", before, after, &lines)
+	if len(lines) == 0 {
+		fmt.Println("  (no changes)")
+		return nil
+	}
+	for _, l := range lines {
+		path := l.Path
+		if path == "" {
+			path = "."
+		}
+		switch l.Op {
+		case '+':
+			fmt.Println(addedStyle.Render(fmt.Sprintf("+ %s: %s", path, formatJSON(l.After))))
+		case '-':
+			fmt.Println(removedStyle.Render(fmt.Sprintf("- %s: %s", path, formatJSON(l.Before))))
+		default:
+			fmt.Println(changedStyle.Render(fmt.Sprintf("~ %s: %s → %s", path, formatJSON(l.Before), formatJSON(l.After))))
+		}
+	}
+	return nil
+}
+
+// diffJSON appends the differences between two decoded JSON values to out,
+// descending into objects and arrays so only the changed leaves are listed.
+func diffJSON(path string, before, after any, out *[]diffLine) {
+	switch {
+	case before == nil && after != nil:
+		*out = append(*out, diffLine{Op: '+', Path: path, After: after})
+		return
+	case before != nil && after == nil:
+		*out = append(*out, diffLine{Op: '-', Path: path, Before: before})
+		return
+	}
+
+	beforeObj, ok1 := before.(map[string]any)
+	afterObj, ok2 := after.(map[string]any)
+	if ok1 && ok2 {
+		keys := make([]string, 0, len(beforeObj)+len(afterObj))
+		for k := range beforeObj {
+			keys = append(keys, k)
+		}
+		for k := range afterObj {
+			if _, ok := beforeObj[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := k
+			if path != "" {
+				child = path + "." + k
+			}
+			diffJSON(child, beforeObj[k], afterObj[k], out)
+		}
+		return
+	}
+
+	beforeArr, ok1 := before.([]any)
+	afterArr, ok2 := after.([]any)
+	if ok1 && ok2 {
+		for i := 0; i < max(len(beforeArr), len(afterArr)); i++ {
+			var b, a any
+			if i < len(beforeArr) {
+				b = beforeArr[i]
+			}
+			if i < len(afterArr) {
+				a = afterArr[i]
+			}
+			diffJSON(path+"["+strconv.Itoa(i)+"]", b, a, out)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(before, after) {
+		*out = append(*out, diffLine{Op: '~', Path: path, Before: before, After: after})
+	}
+}
+
+func formatJSON(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
@@ -2,40 +2,94 @@ package commands
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/charmbracelet/log"
 	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
 
 	ffpb "github.com/julianstephens/feature-flag-service/gen/go/grpc/v1/featureflag.v1"
 	"github.com/julianstephens/feature-flag-service/internal/config"
 	"github.com/julianstephens/feature-flag-service/internal/utils"
 )
 
+var variationNamePattern = regexp.MustCompile(`^([A-Za-z0-9_-]+)=(.*)$`)
+var rolloutPattern = regexp.MustCompile(`^(\d+)=(\d+(?:\.\d+)?)%?$`)
+var prerequisitePattern = regexp.MustCompile(`^(.+)=(\d+)$`)
+
 type FlagCommand struct {
+	Project string `short:"p" help:"Project of the feature flags. Defaults to the server's default project."`
+	Env     string `short:"e" help:"Environment whose state is shown or changed. Defaults to DEFAULT_ENVIRONMENT."`
+
 	List struct {} `cmd:"" help:"List all feature flags."`
 	Get struct {
-		ID string `arg:"" help:"ID of the feature flag to retrieve."`
-	} `cmd:"" help:"Get details of a specific feature flag by ID."`
+		ID string `arg:"" help:"ID or key of the feature flag to retrieve."`
+	} `cmd:"" help:"Get details of a specific feature flag by ID or key."`
 	Create struct {
+		Key         string `help:"Unique, immutable key of the feature flag (e.g. checkout.new-payment-flow). Derived from the name when omitted."`
 		Name		string `help:"Name of the feature flag."`
 		Description string `help:"Description of the feature flag."`
-		Enabled     bool   `negatable:"disabled" help:"Initial state of the feature flag."`
+		Enabled     bool   `negatable:"disabled" help:"Initial state of the feature flag in the environment."`
+		Tags        []string `help:"Tags to attach to the feature flag."`
+		Type         string   `enum:"boolean,string,number,json" default:"boolean" help:"Type of the flag's variations (boolean, string, number, json)."`
+		Variations   []string `name:"variation" sep:"none" help:"Variation value, optionally prefixed with a name (e.g. blue=#00f). Repeat for each variation. Defaults to true/false."`
+		OnVariation  int      `default:"0" help:"Index of the variation served when the flag is enabled."`
+		OffVariation int      `default:"1" help:"Index of the variation served when the flag is disabled."`
+		Schema       string   `help:"JSON Schema the variations of a json flag must match, inline or as @file."`
+		Rollout      []string `help:"Percentage of contexts served a variation, as index=percent (e.g. 0=10,1=90). Replaces the on variation."`
+		BucketBy     string   `help:"Context attribute used to bucket rollouts. Defaults to the context key."`
+		Prerequisites []string `name:"prerequisite" help:"Flag that must serve a variation first, as flag=variation, by ID or key. Repeat for each prerequisite."`
 	} `cmd:"" help:"Create a new feature flag."`
 	Update struct {
-		ID          string `arg:"" help:"ID of the feature flag to update."`
+		ID          string `arg:"" help:"ID or key of the feature flag to update."`
+		Key         string `optional:"" help:"Key of a feature flag created without one. Keys cannot be changed."`
 		Name        string `optional:"" help:"New name of the feature flag."`
 		Description string `optional:"" help:"New description of the feature flag."`
-		Enabled     bool   `negatable:"disabled" help:"New state of the feature flag."`
-	} `cmd:"" help:"Update an existing feature flag by ID."`
+		Enabled     bool   `negatable:"disabled" help:"New state of the feature flag in the environment."`
+		Tags        []string `optional:"" help:"New tags of the feature flag."`
+		Type         string   `optional:"" help:"New type of the flag's variations (boolean, string, number, json)."`
+		Variations   []string `name:"variation" sep:"none" optional:"" help:"Replace the variations. Repeat for each variation."`
+		OnVariation  *int     `optional:"" help:"New index of the variation served when the flag is enabled."`
+		OffVariation *int     `optional:"" help:"New index of the variation served when the flag is disabled."`
+		Schema       string   `optional:"" help:"New JSON Schema of a json flag, inline or as @file."`
+		NoSchema     bool     `help:"Remove the JSON Schema of a json flag."`
+		Rollout      []string `optional:"" help:"Replace the rollout, as index=percent pairs (e.g. 0=10,1=90)."`
+		BucketBy     string   `optional:"" help:"New context attribute used to bucket rollouts."`
+		NoRollout    bool     `help:"Remove the rollout and serve the on variation again."`
+		Prerequisites   []string `name:"prerequisite" optional:"" help:"Replace the prerequisites, as flag=variation, by ID or key. Repeat for each prerequisite."`
+		NoPrerequisites bool     `help:"Remove all prerequisites."`
+	} `cmd:"" help:"Update an existing feature flag by ID or key. Targeting options apply to the environment only."`
+	Deps struct {
+		ID string `arg:"" help:"ID or key of the feature flag to inspect."`
+	} `cmd:"" help:"Show a flag's prerequisites and the flags that depend on it."`
+	Reshuffle struct {
+		ID string `arg:"" help:"ID or key of the feature flag to reshuffle."`
+	} `cmd:"" help:"Reset a flag's bucketing salt so rollouts pick a new set of contexts."`
 	Delete struct {
-		ID string `arg:"" help:"ID of the feature flag to delete."`
-	} `cmd:"" help:"Delete a feature flag by ID."`
+		ID string `arg:"" help:"ID or key of the feature flag to delete."`
+	} `cmd:"" help:"Delete a feature flag by ID or key."`
+	History struct {
+		ID      string `arg:"" help:"ID or key of the feature flag."`
+		Version int64  `name:"at-version" help:"Show this version in full instead of listing every version."`
+	} `cmd:"" help:"List the versions of a feature flag, newest first."`
+	Rollback struct {
+		ID        string `arg:"" help:"ID or key of the feature flag to roll back."`
+		ToVersion int64  `required:"" help:"Version whose definition is restored as a new version."`
+	} `cmd:"" help:"Restore a previous version of a feature flag."`
 }
 
 func (c *FlagCommand) ListFlags(conf *config.Config, conn *grpc.ClientConn) error {
 	client := ffpb.NewFlagServiceClient(conn)
-	req := &ffpb.ListFlagsRequest{}
+	req := &ffpb.ListFlagsRequest{
+		Project: c.Project,
+	}
 	
 	res, err := client.ListFlags(context.Background(), req)
 	if err != nil {
@@ -48,12 +102,13 @@ func (c *FlagCommand) ListFlags(conf *config.Config, conn *grpc.ClientConn) erro
 		return nil
 	}
 
+	env := c.env(conf)
 	var rows [][]string
 	for _, flag := range res.Flags {
-		rows = append(rows, []string{flag.Id, flag.Name, flag.Description, fmt.Sprintf("%v", flag.Enabled), flag.CreatedAt, flag.UpdatedAt})
+		rows = append(rows, []string{flag.Id, flag.Key, flag.Name, flag.Description, fmt.Sprintf("%v", flag.Environments[env].GetEnabled()), strings.Join(flag.Tags, ","), flag.CreatedAt, flag.UpdatedAt})
 	}
 
-	utils.PrintTable([]string{"ID", "Name", "Description", "Enabled", "Created At", "Updated At"}, rows)
+	utils.PrintTable([]string{"ID", "Key", "Name", "Description", "Enabled (" + env + ")", "Tags", "Created At", "Updated At"}, rows)
 
 	return nil
 }
@@ -61,7 +116,8 @@ func (c *FlagCommand) ListFlags(conf *config.Config, conn *grpc.ClientConn) erro
 func (c *FlagCommand) GetFlag(conf *config.Config, conn *grpc.ClientConn) error {
 	client := ffpb.NewFlagServiceClient(conn)
 	req := &ffpb.GetFlagRequest{
-		Id: c.Get.ID,
+		Id:      c.Get.ID,
+		Project: c.Project,
 	}
 
 	flag, err := client.GetFlag(context.Background(), req)
@@ -70,17 +126,54 @@ func (c *FlagCommand) GetFlag(conf *config.Config, conn *grpc.ClientConn) error
 		return err
 	}
 
-	pprintFlag(flag)
+	pprintFlag(flag, c.env(conf))
 
 	return nil
 }
 
 func (c *FlagCommand) CreateFlag(conf *config.Config, conn *grpc.ClientConn) error {
 	client := ffpb.NewFlagServiceClient(conn)
+	state := &ffpb.FlagEnvironment{
+		Enabled: c.Create.Enabled,
+	}
 	req := &ffpb.CreateFlagRequest{
-		Name:        c.Create.Name,
-		Description: c.Create.Description,
-		Enabled:     c.Create.Enabled,
+		Project:      c.Project,
+		Key:          c.Create.Key,
+		Name:         c.Create.Name,
+		Description:  c.Create.Description,
+		Tags:         c.Create.Tags,
+		Environments: map[string]*ffpb.FlagEnvironment{c.env(conf): state},
+	}
+	if len(c.Create.Variations) > 0 {
+		variations, err := parseVariations(c.Create.Type, c.Create.Variations)
+		if err != nil {
+			return err
+		}
+		req.Type = c.Create.Type
+		req.Variations = variations
+		state.OnVariation = proto.Int32(int32(c.Create.OnVariation))
+		state.OffVariation = proto.Int32(int32(c.Create.OffVariation))
+	}
+	if c.Create.Schema != "" {
+		schema, err := readJSONArg(c.Create.Schema)
+		if err != nil {
+			return err
+		}
+		req.Schema = schema
+	}
+	if len(c.Create.Rollout) > 0 {
+		rollout, err := parseRollout(c.Create.Rollout, c.Create.BucketBy)
+		if err != nil {
+			return err
+		}
+		state.Rollout = rollout
+	}
+	if len(c.Create.Prerequisites) > 0 {
+		prerequisites, err := parsePrerequisites(c.Create.Prerequisites)
+		if err != nil {
+			return err
+		}
+		state.Prerequisites = prerequisites
 	}
 
 	flag, err := client.CreateFlag(context.Background(), req)
@@ -89,7 +182,7 @@ func (c *FlagCommand) CreateFlag(conf *config.Config, conn *grpc.ClientConn) err
 		return err
 	}
 
-	pprintFlag(flag)
+	pprintFlag(flag, c.env(conf))
 
 	return nil
 }
@@ -98,14 +191,17 @@ func (c *FlagCommand) UpdateFlag(conf *config.Config, conn *grpc.ClientConn) err
 	client := ffpb.NewFlagServiceClient(conn)
 	req := &ffpb.UpdateFlagRequest{
 		Id:          c.Update.ID,
-		Enabled:    c.Update.Enabled,
+		Project:     c.Project,
 	}
 
-    flag, err := client.GetFlag(context.Background(), &ffpb.GetFlagRequest{Id: c.Update.ID})
+    flag, err := client.GetFlag(context.Background(), &ffpb.GetFlagRequest{Id: c.Update.ID, Project: c.Project})
 	if err != nil {
 		log.Error("Failed to get existing flag")
 		return err
 	}
+	// Fail rather than overwrite changes made since the flag was read.
+	req.Revision = flag.Revision
+	req.Key = c.Update.Key
 	
 	// Only update fields that were provided
 	if c.Update.Name != flag.Name && c.Update.Name != "" {
@@ -118,6 +214,82 @@ func (c *FlagCommand) UpdateFlag(conf *config.Config, conn *grpc.ClientConn) err
 	} else {
 		req.Description = flag.Description
 	}
+	if len(c.Update.Tags) > 0 {
+		req.Tags = c.Update.Tags
+	} else {
+		req.Tags = flag.Tags
+	}
+
+	// Only the selected environment is sent; the server keeps the others.
+	env := c.env(conf)
+	current := flag.Environments[env]
+	if current == nil {
+		// Unset variations get the server's defaults.
+		current = &ffpb.FlagEnvironment{}
+	}
+	state := &ffpb.FlagEnvironment{
+		Enabled:      c.Update.Enabled,
+		OnVariation:  current.OnVariation,
+		OffVariation: current.OffVariation,
+		Targets:      current.Targets,
+		Rules:        current.Rules,
+	}
+	req.Environments = map[string]*ffpb.FlagEnvironment{env: state}
+	switch {
+	case c.Update.NoRollout:
+	case len(c.Update.Rollout) > 0:
+		state.Rollout, err = parseRollout(c.Update.Rollout, c.Update.BucketBy)
+		if err != nil {
+			return err
+		}
+	default:
+		state.Rollout = current.Rollout
+		if state.Rollout != nil && c.Update.BucketBy != "" {
+			state.Rollout.BucketBy = c.Update.BucketBy
+		}
+	}
+	switch {
+	case c.Update.NoPrerequisites:
+	case len(c.Update.Prerequisites) > 0:
+		state.Prerequisites, err = parsePrerequisites(c.Update.Prerequisites)
+		if err != nil {
+			return err
+		}
+	default:
+		state.Prerequisites = current.Prerequisites
+	}
+	if len(c.Update.Variations) > 0 {
+		req.Type = flag.Type
+		if c.Update.Type != "" {
+			req.Type = c.Update.Type
+		}
+		req.Variations, err = parseVariations(req.Type, c.Update.Variations)
+		if err != nil {
+			return err
+		}
+		req.Schema = flag.Schema
+	}
+	// The schema is part of the variation settings, which are only replaced
+	// together.
+	if c.Update.Schema != "" || c.Update.NoSchema {
+		if len(req.Variations) == 0 {
+			req.Type = flag.Type
+			req.Variations = flag.Variations
+		}
+		req.Schema = ""
+		if !c.Update.NoSchema {
+			req.Schema, err = readJSONArg(c.Update.Schema)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if c.Update.OnVariation != nil {
+		state.OnVariation = proto.Int32(int32(*c.Update.OnVariation))
+	}
+	if c.Update.OffVariation != nil {
+		state.OffVariation = proto.Int32(int32(*c.Update.OffVariation))
+	}
 	
 	flag, err = client.UpdateFlag(context.Background(), req)
 	if err != nil {
@@ -125,7 +297,7 @@ func (c *FlagCommand) UpdateFlag(conf *config.Config, conn *grpc.ClientConn) err
 		return err
 	}
 	
-	pprintFlag(flag)
+	pprintFlag(flag, env)
 	return nil
 }
 
@@ -133,7 +305,8 @@ func (c *FlagCommand) UpdateFlag(conf *config.Config, conn *grpc.ClientConn) err
 func (c *FlagCommand) DeleteFlag(conf *config.Config, conn *grpc.ClientConn) error {
 	client := ffpb.NewFlagServiceClient(conn)
 	req := &ffpb.DeleteFlagRequest{
-		Id: c.Delete.ID,
+		Id:      c.Delete.ID,
+		Project: c.Project,
 	}
 	
 	_, err := client.DeleteFlag(context.Background(), req)
@@ -146,12 +319,327 @@ func (c *FlagCommand) DeleteFlag(conf *config.Config, conn *grpc.ClientConn) err
 	return nil
 }
 
+func (c *FlagCommand) ReshuffleFlag(conf *config.Config, conn *grpc.ClientConn) error {
+	client := ffpb.NewFlagServiceClient(conn)
+	req := &ffpb.ResetFlagSaltRequest{
+		Id:      c.Reshuffle.ID,
+		Project: c.Project,
+	}
+
+	flag, err := client.ResetFlagSalt(context.Background(), req)
+	if err != nil {
+		log.Error("Failed to reshuffle flag")
+		return err
+	}
+
+	pprintFlag(flag, c.env(conf))
+	return nil
+}
+
+func (c *FlagCommand) FlagHistory(conf *config.Config, conn *grpc.ClientConn) error {
+	client := ffpb.NewFlagServiceClient(conn)
+	env := c.env(conf)
+
+	if c.History.Version > 0 {
+		version, err := client.GetFlagVersion(context.Background(), &ffpb.GetFlagVersionRequest{
+			Id:      c.History.ID,
+			Project: c.Project,
+			Version: c.History.Version,
+		})
+		if err != nil {
+			log.Error("Failed to get flag version")
+			return err
+		}
+		fmt.Printf("Version: %d\n", version.Version)
+		fmt.Printf("Author: %s\n", version.Author)
+		pprintFlag(version.Flag, env)
+		return nil
+	}
+
+	res, err := client.ListFlagVersions(context.Background(), &ffpb.ListFlagVersionsRequest{
+		Id:      c.History.ID,
+		Project: c.Project,
+	})
+	if err != nil {
+		log.Error("Failed to list flag versions")
+		return err
+	}
+
+	if len(res.Versions) == 0 {
+		log.Info("No versions found")
+		return nil
+	}
+
+	var rows [][]string
+	for _, v := range res.Versions {
+		rows = append(rows, []string{strconv.FormatInt(v.Version, 10), v.Author, v.CreatedAt, v.Flag.GetName(), fmt.Sprintf("%v", v.Flag.GetEnvironments()[env].GetEnabled()), strconv.Itoa(len(v.Flag.GetVariations()))})
+	}
+
+	utils.PrintTable([]string{"Version", "Author", "Created At", "Name", "Enabled (" + env + ")", "Variations"}, rows)
+
+	return nil
+}
+
+func (c *FlagCommand) RollbackFlag(conf *config.Config, conn *grpc.ClientConn) error {
+	client := ffpb.NewFlagServiceClient(conn)
+	req := &ffpb.RollbackFlagRequest{
+		Id:      c.Rollback.ID,
+		Project: c.Project,
+		Version: c.Rollback.ToVersion,
+	}
+
+	flag, err := client.RollbackFlag(context.Background(), req)
+	if err != nil {
+		log.Error("Failed to roll back flag")
+		return err
+	}
+
+	log.Info("Flag rolled back", "restored", c.Rollback.ToVersion, "version", flag.Version)
+	pprintFlag(flag, c.env(conf))
+	return nil
+}
+
+func (c *FlagCommand) FlagDependencies(conf *config.Config, conn *grpc.ClientConn) error {
+	client := ffpb.NewFlagServiceClient(conn)
+	req := &ffpb.GetFlagDependenciesRequest{
+		Id:          c.Deps.ID,
+		Project:     c.Project,
+		Environment: c.env(conf),
+	}
+
+	deps, err := client.GetFlagDependencies(context.Background(), req)
+	if err != nil {
+		log.Error("Failed to get flag dependencies")
+		return err
+	}
+
+	fmt.Printf("Flag: %s\n", deps.FlagId)
+	fmt.Printf("Environment: %s\n", deps.Environment)
+	fmt.Println("Prerequisites:")
+	for _, p := range deps.Prerequisites {
+		fmt.Printf("  %s must serve [%d]\n", p.FlagId, p.Variation)
+	}
+	fmt.Printf("Dependents: %s\n", strings.Join(deps.Dependents, ", "))
+	fmt.Printf("Affected when disabled: %s\n", strings.Join(deps.Affected, ", "))
+	return nil
+}
+
+// env returns the environment selected with --env, or the configured
+// default.
+func (c *FlagCommand) env(conf *config.Config) string {
+	if c.Env != "" {
+		return c.Env
+	}
+	return conf.DefaultEnvironment
+}
+
+// pprintFlag prints a flag's definition and its state in env.
+func pprintFlag(flag *ffpb.Flag, env string) {
+	state := flag.Environments[env]
+	if state == nil {
+		state = &ffpb.FlagEnvironment{OffVariation: proto.Int32(int32(len(flag.Variations) - 1))}
+	}
 
-func pprintFlag(flag *ffpb.Flag) {
 	fmt.Printf("ID: %s\n", flag.Id)
+	fmt.Printf("Key: %s\n", flag.Key)
+	fmt.Printf("Project: %s\n", flag.Project)
 	fmt.Printf("Name: %s\n", flag.Name)
 	fmt.Printf("Description: %s\n", flag.Description)
-	fmt.Printf("Enabled: %v\n", flag.Enabled)
+	fmt.Printf("Tags: %s\n", strings.Join(flag.Tags, ", "))
+	fmt.Printf("Type: %s\n", flag.Type)
+	if flag.Schema != "" {
+		fmt.Printf("Schema: %s\n", flag.Schema)
+	}
+	var envs []string
+	for key, s := range flag.Environments {
+		if s.Enabled {
+			envs = append(envs, key+" (on)")
+		} else {
+			envs = append(envs, key+" (off)")
+		}
+	}
+	sort.Strings(envs)
+	fmt.Printf("Environments: %s\n", strings.Join(envs, ", "))
+	fmt.Printf("Environment: %s\n", env)
+	fmt.Printf("Enabled: %v\n", state.Enabled)
+	fmt.Println("Variations:")
+	for i, v := range flag.Variations {
+		var marks []string
+		if int32(i) == state.GetOnVariation() {
+			marks = append(marks, "on")
+		}
+		if int32(i) == state.GetOffVariation() {
+			marks = append(marks, "off")
+		}
+		line := fmt.Sprintf("  [%d] %s", i, v.Value)
+		if v.Name != "" {
+			line += " (" + v.Name + ")"
+		}
+		if len(marks) > 0 {
+			line += " <- " + strings.Join(marks, ", ")
+		}
+		fmt.Println(line)
+	}
+	if len(state.Prerequisites) > 0 {
+		fmt.Println("Prerequisites:")
+		for _, p := range state.Prerequisites {
+			fmt.Printf("  %s -> [%d]\n", p.FlagId, p.Variation)
+		}
+	}
+	if len(state.Targets) > 0 {
+		fmt.Println("Targets:")
+		for _, t := range state.Targets {
+			fmt.Printf("  %s -> [%d]\n", strings.Join(t.Values, ", "), t.Variation)
+		}
+	}
+	if len(state.Rules) > 0 {
+		fmt.Println("Rules:")
+		for _, r := range state.Rules {
+			serve := fmt.Sprintf("[%d]", r.Variation)
+			if r.Rollout != nil {
+				serve = formatRollout(r.Rollout)
+			}
+			fmt.Printf("  %s: %s -> %s\n", r.Id, formatClauses(r.Clauses), serve)
+		}
+	}
+	if state.Rollout != nil {
+		fmt.Printf("Rollout: %s\n", formatRollout(state.Rollout))
+	}
+	fmt.Printf("Salt: %s\n", flag.Salt)
+	if flag.Version > 0 {
+		fmt.Printf("Version: %d\n", flag.Version)
+	}
+	if flag.Revision > 0 {
+		fmt.Printf("Revision: %d\n", flag.Revision)
+	}
 	fmt.Printf("Created At: %s\n", flag.CreatedAt)
 	fmt.Printf("Updated At: %s\n", flag.UpdatedAt)
-}
\ No newline at end of file
+}
+
+func formatClauses(clauses []*ffpb.Clause) string {
+	var parts []string
+	for _, c := range clauses {
+		op := c.Operator
+		if c.Negate {
+			op = "not " + op
+		}
+		if op == "segmentMatch" || op == "not segmentMatch" {
+			parts = append(parts, fmt.Sprintf("%s [%s]", op, strings.Join(c.Values, ", ")))
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s %s [%s]", c.Attribute, op, strings.Join(c.Values, ", ")))
+	}
+	return strings.Join(parts, " and ")
+}
+
+// parseVariations turns CLI variation arguments into variations of the given
+// type. Each argument is a value, optionally prefixed with "name=".
+// readJSONArg returns a JSON flag value, reading it from a file when it
+// starts with @.
+func readJSONArg(arg string) (string, error) {
+	data := []byte(arg)
+	if path, ok := strings.CutPrefix(arg, "@"); ok {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return "", err
+		}
+	}
+	if !json.Valid(data) {
+		return "", fmt.Errorf("invalid JSON %q", arg)
+	}
+	return string(data), nil
+}
+
+func parseVariations(variationType string, args []string) ([]*ffpb.Variation, error) {
+	var variations []*ffpb.Variation
+	for _, arg := range args {
+		name, raw := "", arg
+		if m := variationNamePattern.FindStringSubmatch(arg); m != nil {
+			name, raw = m[1], m[2]
+		}
+
+		var value string
+		switch variationType {
+		case "boolean":
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return nil, fmt.Errorf("invalid boolean variation %q", raw)
+			}
+			value = strconv.FormatBool(b)
+		case "number":
+			if _, err := strconv.ParseFloat(raw, 64); err != nil {
+				return nil, fmt.Errorf("invalid number variation %q", raw)
+			}
+			value = raw
+		case "string":
+			data, err := json.Marshal(raw)
+			if err != nil {
+				return nil, err
+			}
+			value = string(data)
+		case "json":
+			if !json.Valid([]byte(raw)) {
+				return nil, fmt.Errorf("invalid JSON variation %q", raw)
+			}
+			value = raw
+		default:
+			return nil, fmt.Errorf("unknown variation type %q", variationType)
+		}
+		variations = append(variations, &ffpb.Variation{Name: name, Value: value})
+	}
+	return variations, nil
+}
+
+// parseRollout turns index=percent arguments into a rollout. Percentages may
+// have up to three decimal places.
+func parseRollout(args []string, bucketBy string) (*ffpb.Rollout, error) {
+	rollout := &ffpb.Rollout{BucketBy: bucketBy}
+	for _, arg := range args {
+		m := rolloutPattern.FindStringSubmatch(arg)
+		if m == nil {
+			return nil, fmt.Errorf("invalid rollout %q, expected index=percent", arg)
+		}
+		variation, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid rollout variation %q", m[1])
+		}
+		percent, err := strconv.ParseFloat(m[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rollout percentage %q", m[2])
+		}
+		rollout.Variations = append(rollout.Variations, &ffpb.WeightedVariation{
+			Variation: int32(variation),
+			Weight:    int32(math.Round(percent * 1000)),
+		})
+	}
+	return rollout, nil
+}
+
+// parsePrerequisites turns flag=variation arguments into prerequisites.
+func parsePrerequisites(args []string) ([]*ffpb.Prerequisite, error) {
+	var prerequisites []*ffpb.Prerequisite
+	for _, arg := range args {
+		m := prerequisitePattern.FindStringSubmatch(arg)
+		if m == nil {
+			return nil, fmt.Errorf("invalid prerequisite %q, expected flag=variation", arg)
+		}
+		variation, err := strconv.Atoi(m[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid prerequisite variation %q", m[2])
+		}
+		prerequisites = append(prerequisites, &ffpb.Prerequisite{FlagId: m[1], Variation: int32(variation)})
+	}
+	return prerequisites, nil
+}
+
+func formatRollout(rollout *ffpb.Rollout) string {
+	var parts []string
+	for _, wv := range rollout.Variations {
+		parts = append(parts, fmt.Sprintf("[%d] %s%%", wv.Variation, strconv.FormatFloat(float64(wv.Weight)/1000, 'f', -1, 64)))
+	}
+	s := strings.Join(parts, ", ")
+	if rollout.BucketBy != "" {
+		s += " by " + rollout.BucketBy
+	}
+	return s
+}
@@ -0,0 +1,251 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/x/term"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/julianstephens/feature-flag-service/internal/config"
+)
+
+// deviceCodeGrant is the OAuth 2.0 device authorization grant type (RFC 8628).
+const deviceCodeGrant = "urn:ietf:params:oauth:grant-type:device_code"
+
+type LoginCommand struct {
+	Token    string `help:"Token to store. Read from stdin when neither --token nor --device is given."`
+	Device   bool   `help:"Sign in with the OAuth device flow of --issuer."`
+	Issuer   string `help:"OpenID Connect issuer URL for --device, e.g. http://localhost:8180/realms/dev. Remembered by the profile."`
+	ClientID string `help:"OAuth client ID for --device. Remembered by the profile."`
+	Scope    string `default:"openid email" help:"Scopes requested by --device."`
+}
+
+type LogoutCommand struct{}
+
+// Login stores a token in the selected profile, along with the --server and
+// --tls flags, and makes it the current profile.
+func (c *LoginCommand) Login(conf *config.Config, flags *ConnectionFlags) error {
+	profiles, err := LoadProfiles()
+	if err != nil {
+		log.Error("Failed to read profiles")
+		return err
+	}
+	name := profiles.Name(flags)
+	profile := profiles.Get(name)
+	if flags.Server != "" {
+		profile.Server = flags.Server
+	}
+	if flags.TLS != nil {
+		profile.TLS = *flags.TLS
+	}
+
+	var token string
+	switch {
+	case c.Token != "":
+		token = c.Token
+	case c.Device:
+		if c.Issuer != "" {
+			profile.Issuer = c.Issuer
+		}
+		if c.ClientID != "" {
+			profile.ClientID = c.ClientID
+		}
+		if profile.Issuer == "" || profile.ClientID == "" {
+			return errors.New("--device needs --issuer and --client-id")
+		}
+		token, err = deviceLogin(profile.Issuer, profile.ClientID, c.Scope)
+	default:
+		token, err = readToken()
+	}
+	if err != nil {
+		log.Error("Failed to log in")
+		return err
+	}
+
+	profile.Token = token
+	profile.ExpiresAt = time.Time{}
+	var claims jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(token, &claims); err == nil && claims.ExpiresAt != nil {
+		profile.ExpiresAt = claims.ExpiresAt.Time
+	}
+	profiles.Current = name
+	if err := profiles.Save(); err != nil {
+		log.Error("Failed to save profiles")
+		return err
+	}
+
+	args := []any{"profile", name}
+	if claims.Subject != "" {
+		args = append(args, "subject", claims.Subject)
+	}
+	if !profile.ExpiresAt.IsZero() {
+		args = append(args, "expires", profile.ExpiresAt.Format(time.RFC3339))
+	}
+	log.Info("Logged in", args...)
+	return nil
+}
+
+// Logout removes the token of the selected profile.
+func (c *LogoutCommand) Logout(conf *config.Config, flags *ConnectionFlags) error {
+	profiles, err := LoadProfiles()
+	if err != nil {
+		log.Error("Failed to read profiles")
+		return err
+	}
+	name := profiles.Name(flags)
+	profile, ok := profiles.Profiles[name]
+	if !ok || profile.Token == "" {
+		log.Info("Not logged in", "profile", name)
+		return nil
+	}
+	profile.Token = ""
+	profile.ExpiresAt = time.Time{}
+	if err := profiles.Save(); err != nil {
+		log.Error("Failed to save profiles")
+		return err
+	}
+	log.Info("Logged out", "profile", name)
+	return nil
+}
+
+// readToken reads a pasted token from stdin, without echoing it when stdin
+// is a terminal.
+func readToken() (string, error) {
+	var token string
+	if term.IsTerminal(os.Stdin.Fd()) {
+		fmt.Fprint(os.Stderr, "Paste a token: ")
+		data, err := term.ReadPassword(os.Stdin.Fd())
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		token = string(data)
+	} else {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		token = line
+	}
+	token = strings.TrimPrefix(strings.TrimSpace(token), "Bearer ")
+	if token == "" {
+		return "", errors.New("no token given")
+	}
+	return token, nil
+}
+
+type deviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// deviceLogin runs the OAuth 2.0 device authorization grant against the
+// endpoints the issuer advertises: the user approves the login in a browser
+// while featurectl polls for the token.
+func deviceLogin(issuer, clientID, scope string) (string, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	var discovery struct {
+		DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+		TokenEndpoint               string `json:"token_endpoint"`
+	}
+	if err := getJSON(client, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return "", fmt.Errorf("discovering endpoints of %s: %w", issuer, err)
+	}
+	if discovery.DeviceAuthorizationEndpoint == "" || discovery.TokenEndpoint == "" {
+		return "", fmt.Errorf("%s does not support the device flow", issuer)
+	}
+
+	var auth deviceAuthorization
+	res, err := client.PostForm(discovery.DeviceAuthorizationEndpoint, url.Values{"client_id": {clientID}, "scope": {scope}})
+	if err != nil {
+		return "", err
+	}
+	if err := decodeJSON(res, &auth); err != nil {
+		return "", fmt.Errorf("requesting a device code: %w", err)
+	}
+
+	verification := auth.VerificationURIComplete
+	if verification == "" {
+		verification = auth.VerificationURI
+	}
+	fmt.Fprintf(os.Stderr, "Open %s and enter the code %s\n", verification, auth.UserCode)
+
+	interval := time.Duration(max(auth.Interval, 5)) * time.Second
+	deadline := time.Now().Add(time.Duration(auth.ExpiresIn) * time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+
+		res, err := client.PostForm(discovery.TokenEndpoint, url.Values{
+			"grant_type":  {deviceCodeGrant},
+			"device_code": {auth.DeviceCode},
+			"client_id":   {clientID},
+		})
+		if err != nil {
+			return "", err
+		}
+		var token tokenResponse
+		err = json.NewDecoder(res.Body).Decode(&token)
+		res.Body.Close()
+		if err != nil {
+			return "", fmt.Errorf("reading token response: %w", err)
+		}
+
+		switch token.Error {
+		case "":
+			if token.AccessToken == "" {
+				return "", errors.New("token response has no access token")
+			}
+			return token.AccessToken, nil
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * time.Second
+		default:
+			if token.ErrorDescription != "" {
+				return "", fmt.Errorf("%s: %s", token.Error, token.ErrorDescription)
+			}
+			return "", errors.New(token.Error)
+		}
+	}
+	return "", errors.New("the device code expired before the login was approved")
+}
+
+func getJSON(client *http.Client, u string, v any) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	return decodeJSON(res, v)
+}
+
+func decodeJSON(res *http.Response, v any) error {
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
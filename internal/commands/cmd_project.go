@@ -0,0 +1,204 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"google.golang.org/grpc"
+
+	ffpb "github.com/julianstephens/feature-flag-service/gen/go/grpc/v1/featureflag.v1"
+	"github.com/julianstephens/feature-flag-service/internal/config"
+	"github.com/julianstephens/feature-flag-service/internal/utils"
+)
+
+type ProjectCommand struct {
+	List struct{} `cmd:"" help:"List all projects."`
+	Get  struct {
+		Key string `arg:"" help:"Key of the project to retrieve."`
+	} `cmd:"" help:"Get details of a project by key."`
+	Create struct {
+		Key         string   `arg:"" help:"Key of the project."`
+		Name        string   `help:"Name of the project."`
+		Description string   `help:"Description of the project."`
+		Envs        []string `name:"env" help:"Environment keys of the project. Defaults to development, staging and production."`
+	} `cmd:"" help:"Create a new project."`
+	Update struct {
+		Key         string `arg:"" help:"Key of the project to update."`
+		Name        string `optional:"" help:"New name of the project."`
+		Description string `optional:"" help:"New description of the project."`
+	} `cmd:"" help:"Update an existing project by key."`
+	Delete struct {
+		Key string `arg:"" help:"Key of the project to delete."`
+	} `cmd:"" help:"Delete a project that has no flags."`
+	AddEnv struct {
+		Project string `arg:"" help:"Key of the project."`
+		Key     string `arg:"" help:"Key of the new environment."`
+		Name    string `help:"Name of the environment."`
+	} `cmd:"" help:"Add an environment to a project. Flags start out off in it."`
+	RemoveEnv struct {
+		Project string `arg:"" help:"Key of the project."`
+		Key     string `arg:"" help:"Key of the environment to remove."`
+	} `cmd:"" help:"Remove an environment from a project."`
+}
+
+func (c *ProjectCommand) ListProjects(conf *config.Config, conn *grpc.ClientConn) error {
+	client := ffpb.NewProjectServiceClient(conn)
+
+	res, err := client.ListProjects(context.Background(), &ffpb.ListProjectsRequest{})
+	if err != nil {
+		log.Error("Failed to list projects")
+		return err
+	}
+
+	if len(res.Projects) == 0 {
+		log.Info("No projects found")
+		return nil
+	}
+
+	var rows [][]string
+	for _, p := range res.Projects {
+		rows = append(rows, []string{p.Key, p.Name, p.Description, environmentKeys(p), p.UpdatedAt})
+	}
+
+	utils.PrintTable([]string{"Key", "Name", "Description", "Environments", "Updated At"}, rows)
+
+	return nil
+}
+
+func (c *ProjectCommand) GetProject(conf *config.Config, conn *grpc.ClientConn) error {
+	client := ffpb.NewProjectServiceClient(conn)
+
+	project, err := client.GetProject(context.Background(), &ffpb.GetProjectRequest{Key: c.Get.Key})
+	if err != nil {
+		log.Error("Failed to get project")
+		return err
+	}
+
+	pprintProject(project)
+	return nil
+}
+
+func (c *ProjectCommand) CreateProject(conf *config.Config, conn *grpc.ClientConn) error {
+	client := ffpb.NewProjectServiceClient(conn)
+	req := &ffpb.CreateProjectRequest{
+		Key:         c.Create.Key,
+		Name:        c.Create.Name,
+		Description: c.Create.Description,
+	}
+	for _, key := range c.Create.Envs {
+		req.Environments = append(req.Environments, &ffpb.Environment{Key: key, Name: key})
+	}
+
+	project, err := client.CreateProject(context.Background(), req)
+	if err != nil {
+		log.Error("Failed to create project")
+		return err
+	}
+
+	pprintProject(project)
+	return nil
+}
+
+func (c *ProjectCommand) UpdateProject(conf *config.Config, conn *grpc.ClientConn) error {
+	client := ffpb.NewProjectServiceClient(conn)
+
+	project, err := client.GetProject(context.Background(), &ffpb.GetProjectRequest{Key: c.Update.Key})
+	if err != nil {
+		log.Error("Failed to get existing project")
+		return err
+	}
+
+	// Only update fields that were provided.
+	req := &ffpb.UpdateProjectRequest{
+		Key:         project.Key,
+		Name:        project.Name,
+		Description: project.Description,
+	}
+	if c.Update.Name != "" {
+		req.Name = c.Update.Name
+	}
+	if c.Update.Description != "" {
+		req.Description = c.Update.Description
+	}
+
+	project, err = client.UpdateProject(context.Background(), req)
+	if err != nil {
+		log.Error("Failed to update project")
+		return err
+	}
+
+	pprintProject(project)
+	return nil
+}
+
+func (c *ProjectCommand) DeleteProject(conf *config.Config, conn *grpc.ClientConn) error {
+	client := ffpb.NewProjectServiceClient(conn)
+
+	_, err := client.DeleteProject(context.Background(), &ffpb.DeleteProjectRequest{Key: c.Delete.Key})
+	if err != nil {
+		log.Error("Failed to delete project")
+		return err
+	}
+
+	log.Info("Project deleted successfully")
+	return nil
+}
+
+func (c *ProjectCommand) AddEnvironment(conf *config.Config, conn *grpc.ClientConn) error {
+	client := ffpb.NewProjectServiceClient(conn)
+	name := c.AddEnv.Name
+	if name == "" {
+		name = c.AddEnv.Key
+	}
+
+	env, err := client.CreateEnvironment(context.Background(), &ffpb.CreateEnvironmentRequest{
+		Project: c.AddEnv.Project,
+		Key:     c.AddEnv.Key,
+		Name:    name,
+	})
+	if err != nil {
+		log.Error("Failed to add environment")
+		return err
+	}
+
+	log.Info("Environment added", "key", env.Key)
+	return nil
+}
+
+func (c *ProjectCommand) RemoveEnvironment(conf *config.Config, conn *grpc.ClientConn) error {
+	client := ffpb.NewProjectServiceClient(conn)
+
+	_, err := client.DeleteEnvironment(context.Background(), &ffpb.DeleteEnvironmentRequest{
+		Project: c.RemoveEnv.Project,
+		Key:     c.RemoveEnv.Key,
+	})
+	if err != nil {
+		log.Error("Failed to remove environment")
+		return err
+	}
+
+	log.Info("Environment removed successfully")
+	return nil
+}
+
+func environmentKeys(project *ffpb.Project) string {
+	var keys []string
+	for _, env := range project.Environments {
+		keys = append(keys, env.Key)
+	}
+	return strings.Join(keys, ", ")
+}
+
+func pprintProject(project *ffpb.Project) {
+	fmt.Printf("Key: %s\n", project.Key)
+	fmt.Printf("Name: %s\n", project.Name)
+	fmt.Printf("Description: %s\n", project.Description)
+	fmt.Println("Environments:")
+	for _, env := range project.Environments {
+		fmt.Printf("  %s: %s\n", env.Key, env.Name)
+	}
+	fmt.Printf("Created At: %s\n", project.CreatedAt)
+	fmt.Printf("Updated At: %s\n", project.UpdatedAt)
+}
@@ -0,0 +1,130 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"google.golang.org/grpc"
+
+	ffpb "github.com/julianstephens/feature-flag-service/gen/go/grpc/v1/featureflag.v1"
+	"github.com/julianstephens/feature-flag-service/internal/config"
+	"github.com/julianstephens/feature-flag-service/internal/utils"
+)
+
+type SDKKeyCommand struct {
+	List struct {
+		Project string `arg:"" help:"Key of the project."`
+		Env     string `arg:"" help:"Key of the environment."`
+	} `cmd:"" help:"List the SDK keys of an environment."`
+	Create struct {
+		Project string `arg:"" help:"Key of the project."`
+		Env     string `arg:"" help:"Key of the environment."`
+	} `cmd:"" help:"Issue an additional SDK key for an environment."`
+	Rotate struct {
+		Project string `arg:"" help:"Key of the project."`
+		Env     string `arg:"" help:"Key of the environment."`
+		Grace   string `optional:"" help:"How long the replaced keys keep working, e.g. 1h. Defaults to the server's grace period; 0 revokes them immediately."`
+	} `cmd:"" help:"Issue a new SDK key and retire the existing ones."`
+	Revoke struct {
+		Project string `arg:"" help:"Key of the project."`
+		Env     string `arg:"" help:"Key of the environment."`
+		ID      string `arg:"" help:"ID of the SDK key to revoke."`
+	} `cmd:"" help:"Revoke an SDK key immediately."`
+}
+
+func (c *SDKKeyCommand) ListSDKKeys(conf *config.Config, conn *grpc.ClientConn) error {
+	client := ffpb.NewSDKKeyServiceClient(conn)
+
+	res, err := client.ListSDKKeys(context.Background(), &ffpb.ListSDKKeysRequest{
+		Project:     c.List.Project,
+		Environment: c.List.Env,
+	})
+	if err != nil {
+		log.Error("Failed to list SDK keys")
+		return err
+	}
+
+	if len(res.Keys) == 0 {
+		log.Info("No SDK keys found")
+		return nil
+	}
+
+	var rows [][]string
+	for _, k := range res.Keys {
+		rows = append(rows, []string{k.Id, "..." + k.Hint, k.CreatedAt, k.ExpiresAt})
+	}
+
+	utils.PrintTable([]string{"ID", "Key", "Created At", "Expires At"}, rows)
+
+	return nil
+}
+
+func (c *SDKKeyCommand) CreateSDKKey(conf *config.Config, conn *grpc.ClientConn) error {
+	client := ffpb.NewSDKKeyServiceClient(conn)
+
+	key, err := client.CreateSDKKey(context.Background(), &ffpb.CreateSDKKeyRequest{
+		Project:     c.Create.Project,
+		Environment: c.Create.Env,
+	})
+	if err != nil {
+		log.Error("Failed to create SDK key")
+		return err
+	}
+
+	pprintSDKKey(key)
+	return nil
+}
+
+func (c *SDKKeyCommand) RotateSDKKeys(conf *config.Config, conn *grpc.ClientConn) error {
+	client := ffpb.NewSDKKeyServiceClient(conn)
+	req := &ffpb.RotateSDKKeysRequest{
+		Project:     c.Rotate.Project,
+		Environment: c.Rotate.Env,
+	}
+	if c.Rotate.Grace != "" {
+		grace, err := time.ParseDuration(c.Rotate.Grace)
+		if err != nil {
+			log.Error("Invalid grace period", "grace", c.Rotate.Grace)
+			return err
+		}
+		seconds := int64(grace.Seconds())
+		req.GracePeriodSeconds = &seconds
+	}
+
+	key, err := client.RotateSDKKeys(context.Background(), req)
+	if err != nil {
+		log.Error("Failed to rotate SDK keys")
+		return err
+	}
+
+	pprintSDKKey(key)
+	return nil
+}
+
+func (c *SDKKeyCommand) RevokeSDKKey(conf *config.Config, conn *grpc.ClientConn) error {
+	client := ffpb.NewSDKKeyServiceClient(conn)
+
+	_, err := client.RevokeSDKKey(context.Background(), &ffpb.RevokeSDKKeyRequest{
+		Project:     c.Revoke.Project,
+		Environment: c.Revoke.Env,
+		Id:          c.Revoke.ID,
+	})
+	if err != nil {
+		log.Error("Failed to revoke SDK key")
+		return err
+	}
+
+	log.Info("SDK key revoked successfully")
+	return nil
+}
+
+func pprintSDKKey(key *ffpb.SDKKey) {
+	fmt.Printf("ID: %s\n", key.Id)
+	fmt.Printf("Key: %s\n", key.Key)
+	fmt.Printf("Project: %s\n", key.Project)
+	fmt.Printf("Environment: %s\n", key.Environment)
+	fmt.Printf("Created At: %s\n", key.CreatedAt)
+	fmt.Println("Store the key now; it cannot be shown again.")
+}
@@ -0,0 +1,165 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"google.golang.org/grpc"
+
+	ffpb "github.com/julianstephens/feature-flag-service/gen/go/grpc/v1/featureflag.v1"
+	"github.com/julianstephens/feature-flag-service/internal/config"
+	"github.com/julianstephens/feature-flag-service/internal/utils"
+)
+
+type SegmentCommand struct {
+	List struct{} `cmd:"" help:"List all segments."`
+	Get  struct {
+		Key string `arg:"" help:"Key of the segment to retrieve."`
+	} `cmd:"" help:"Get details of a segment by key."`
+	Create struct {
+		Key         string   `arg:"" help:"Key flag rules use to reference the segment."`
+		Name        string   `help:"Name of the segment."`
+		Description string   `help:"Description of the segment."`
+		Include     []string `help:"Context keys always in the segment."`
+		Exclude     []string `help:"Context keys never in the segment."`
+	} `cmd:"" help:"Create a new segment."`
+	Update struct {
+		Key         string   `arg:"" help:"Key of the segment to update."`
+		Name        string   `optional:"" help:"New name of the segment."`
+		Description string   `optional:"" help:"New description of the segment."`
+		Include     []string `optional:"" help:"Replace the included context keys."`
+		Exclude     []string `optional:"" help:"Replace the excluded context keys."`
+	} `cmd:"" help:"Update an existing segment by key."`
+	Delete struct {
+		Key string `arg:"" help:"Key of the segment to delete."`
+	} `cmd:"" help:"Delete a segment no flag references."`
+}
+
+func (c *SegmentCommand) ListSegments(conf *config.Config, conn *grpc.ClientConn) error {
+	client := ffpb.NewSegmentServiceClient(conn)
+
+	res, err := client.ListSegments(context.Background(), &ffpb.ListSegmentsRequest{})
+	if err != nil {
+		log.Error("Failed to list segments")
+		return err
+	}
+
+	if len(res.Segments) == 0 {
+		log.Info("No segments found")
+		return nil
+	}
+
+	var rows [][]string
+	for _, seg := range res.Segments {
+		rows = append(rows, []string{seg.Key, seg.Name, seg.Description, fmt.Sprint(len(seg.Included)), fmt.Sprint(len(seg.Excluded)), fmt.Sprint(len(seg.Rules)), seg.UpdatedAt})
+	}
+
+	utils.PrintTable([]string{"Key", "Name", "Description", "Included", "Excluded", "Rules", "Updated At"}, rows)
+
+	return nil
+}
+
+func (c *SegmentCommand) GetSegment(conf *config.Config, conn *grpc.ClientConn) error {
+	client := ffpb.NewSegmentServiceClient(conn)
+
+	seg, err := client.GetSegment(context.Background(), &ffpb.GetSegmentRequest{Key: c.Get.Key})
+	if err != nil {
+		log.Error("Failed to get segment")
+		return err
+	}
+
+	pprintSegment(seg)
+	return nil
+}
+
+func (c *SegmentCommand) CreateSegment(conf *config.Config, conn *grpc.ClientConn) error {
+	client := ffpb.NewSegmentServiceClient(conn)
+	req := &ffpb.CreateSegmentRequest{
+		Key:         c.Create.Key,
+		Name:        c.Create.Name,
+		Description: c.Create.Description,
+		Included:    c.Create.Include,
+		Excluded:    c.Create.Exclude,
+	}
+
+	seg, err := client.CreateSegment(context.Background(), req)
+	if err != nil {
+		log.Error("Failed to create segment")
+		return err
+	}
+
+	pprintSegment(seg)
+	return nil
+}
+
+func (c *SegmentCommand) UpdateSegment(conf *config.Config, conn *grpc.ClientConn) error {
+	client := ffpb.NewSegmentServiceClient(conn)
+
+	seg, err := client.GetSegment(context.Background(), &ffpb.GetSegmentRequest{Key: c.Update.Key})
+	if err != nil {
+		log.Error("Failed to get existing segment")
+		return err
+	}
+
+	// Only update fields that were provided; rules are carried over.
+	req := &ffpb.UpdateSegmentRequest{
+		Key:         seg.Key,
+		Name:        seg.Name,
+		Description: seg.Description,
+		Included:    seg.Included,
+		Excluded:    seg.Excluded,
+		Rules:       seg.Rules,
+	}
+	if c.Update.Name != "" {
+		req.Name = c.Update.Name
+	}
+	if c.Update.Description != "" {
+		req.Description = c.Update.Description
+	}
+	if len(c.Update.Include) > 0 {
+		req.Included = c.Update.Include
+	}
+	if len(c.Update.Exclude) > 0 {
+		req.Excluded = c.Update.Exclude
+	}
+
+	seg, err = client.UpdateSegment(context.Background(), req)
+	if err != nil {
+		log.Error("Failed to update segment")
+		return err
+	}
+
+	pprintSegment(seg)
+	return nil
+}
+
+func (c *SegmentCommand) DeleteSegment(conf *config.Config, conn *grpc.ClientConn) error {
+	client := ffpb.NewSegmentServiceClient(conn)
+
+	_, err := client.DeleteSegment(context.Background(), &ffpb.DeleteSegmentRequest{Key: c.Delete.Key})
+	if err != nil {
+		log.Error("Failed to delete segment")
+		return err
+	}
+
+	log.Info("Segment deleted successfully")
+	return nil
+}
+
+func pprintSegment(seg *ffpb.Segment) {
+	fmt.Printf("Key: %s\n", seg.Key)
+	fmt.Printf("Name: %s\n", seg.Name)
+	fmt.Printf("Description: %s\n", seg.Description)
+	fmt.Printf("Included: %s\n", strings.Join(seg.Included, ", "))
+	fmt.Printf("Excluded: %s\n", strings.Join(seg.Excluded, ", "))
+	if len(seg.Rules) > 0 {
+		fmt.Println("Rules:")
+		for _, r := range seg.Rules {
+			fmt.Printf("  %s: %s\n", r.Id, formatClauses(r.Clauses))
+		}
+	}
+	fmt.Printf("Created At: %s\n", seg.CreatedAt)
+	fmt.Printf("Updated At: %s\n", seg.UpdatedAt)
+}
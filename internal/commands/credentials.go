@@ -0,0 +1,36 @@
+package commands
+
+import (
+	"context"
+	"net"
+)
+
+// TokenCredentials sends a bearer token with every gRPC call.
+type TokenCredentials struct {
+	Token string
+	// Plaintext allows the token over a connection without TLS. Connect only
+	// sets it for servers on the loopback interface.
+	Plaintext bool
+}
+
+func (t TokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + t.Token}, nil
+}
+
+func (t TokenCredentials) RequireTransportSecurity() bool {
+	return !t.Plaintext
+}
+
+// isLoopback reports whether a host:port address names this machine. An
+// address without a host, like ":9090", does.
+func isLoopback(server string) bool {
+	host, _, err := net.SplitHostPort(server)
+	if err != nil {
+		host = server
+	}
+	if host == "" || host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,23 @@
+package commands
+
+import (
+	"github.com/charmbracelet/log"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+)
+
+// LogErrorDetails logs the field violations the server attached to a
+// rejected request, one per line.
+func LogErrorDetails(err error) {
+	st, ok := status.FromError(err)
+	if !ok {
+		return
+	}
+	for _, detail := range st.Details() {
+		if br, ok := detail.(*errdetails.BadRequest); ok {
+			for _, v := range br.FieldViolations {
+				log.Error(v.Description, "field", v.Field)
+			}
+		}
+	}
+}
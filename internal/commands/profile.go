@@ -0,0 +1,244 @@
+package commands
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/julianstephens/feature-flag-service/internal/config"
+	"github.com/julianstephens/feature-flag-service/internal/utils"
+)
+
+// DefaultProfile is used until another profile is selected.
+const DefaultProfile = "default"
+
+// ConnectionFlags choose the server featurectl talks to and the credentials
+// it sends. Flags override the selected profile.
+type ConnectionFlags struct {
+	Profile string `short:"P" env:"FEATURECTL_PROFILE" help:"Profile to use. Defaults to the current profile."`
+	Server  string `env:"FEATURECTL_SERVER" help:"gRPC address of the server as host:port. Defaults to the profile's server."`
+	TLS     *bool  `negatable:"" help:"Connect over TLS. Defaults to the profile's setting."`
+}
+
+// Profile is a server and the credentials stored for it by login.
+type Profile struct {
+	Server    string    `json:"server,omitempty"`
+	TLS       bool      `json:"tls,omitempty"`
+	Token     string    `json:"token,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+	// Issuer and ClientID are remembered for the next device login.
+	Issuer   string `json:"issuer,omitempty"`
+	ClientID string `json:"clientId,omitempty"`
+}
+
+// Profiles is the featurectl config file.
+type Profiles struct {
+	Current  string              `json:"current,omitempty"`
+	Profiles map[string]*Profile `json:"profiles"`
+
+	path string
+}
+
+// ProfilesPath is $FEATURECTL_CONFIG, or config.json in the featurectl
+// directory of the user's config dir.
+func ProfilesPath() (string, error) {
+	if path := os.Getenv("FEATURECTL_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "featurectl", "config.json"), nil
+}
+
+// LoadProfiles reads the config file. A missing file holds no profiles.
+func LoadProfiles() (*Profiles, error) {
+	path, err := ProfilesPath()
+	if err != nil {
+		return nil, err
+	}
+	p := &Profiles{Profiles: make(map[string]*Profile), path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if p.Profiles == nil {
+		p.Profiles = make(map[string]*Profile)
+	}
+	return p, nil
+}
+
+// Save writes the config file, readable only by the user as it holds
+// tokens.
+func (p *Profiles) Save() error {
+	if err := os.MkdirAll(filepath.Dir(p.path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := p.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.path)
+}
+
+// Name resolves the profile selected by flags.
+func (p *Profiles) Name(flags *ConnectionFlags) string {
+	switch {
+	case flags.Profile != "":
+		return flags.Profile
+	case p.Current != "":
+		return p.Current
+	default:
+		return DefaultProfile
+	}
+}
+
+// Get returns the named profile, adding an empty one if there is none.
+func (p *Profiles) Get(name string) *Profile {
+	profile, ok := p.Profiles[name]
+	if !ok {
+		profile = &Profile{}
+		p.Profiles[name] = profile
+	}
+	return profile
+}
+
+// Connect dials the server selected by flags and the profile, sending the
+// profile's token, or $FEATURECTL_TOKEN when set. Tokens are only sent in
+// plaintext to servers on the loopback interface.
+func Connect(conf *config.Config, flags *ConnectionFlags) (*grpc.ClientConn, error) {
+	profiles, err := LoadProfiles()
+	if err != nil {
+		return nil, err
+	}
+	name := profiles.Name(flags)
+	profile := profiles.Profiles[name]
+	if profile == nil {
+		if flags.Profile != "" {
+			return nil, fmt.Errorf("unknown profile %q", name)
+		}
+		profile = &Profile{}
+	}
+
+	server := ":" + conf.GRPCPort
+	switch {
+	case flags.Server != "":
+		server = flags.Server
+	case profile.Server != "":
+		server = profile.Server
+	}
+	useTLS := profile.TLS
+	if flags.TLS != nil {
+		useTLS = *flags.TLS
+	}
+
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	if useTLS {
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12}))}
+	}
+	token := os.Getenv("FEATURECTL_TOKEN")
+	if token == "" {
+		token = profile.Token
+		if token != "" && !profile.ExpiresAt.IsZero() && time.Now().After(profile.ExpiresAt) {
+			log.Warn("The stored token has expired; run featurectl login", "profile", name)
+		}
+	}
+	if token != "" {
+		if !useTLS && !isLoopback(server) {
+			return nil, fmt.Errorf("refusing to send credentials to %s without TLS; pass --tls", server)
+		}
+		opts = append(opts, grpc.WithPerRPCCredentials(TokenCredentials{Token: token, Plaintext: !useTLS}))
+	}
+	return grpc.NewClient(server, opts...)
+}
+
+type ProfileCommand struct {
+	List struct{} `cmd:"" help:"List the stored profiles."`
+	Use  struct {
+		Name string `arg:"" help:"Name of the profile."`
+	} `cmd:"" help:"Make a profile the current one."`
+}
+
+func (c *ProfileCommand) ListProfiles(conf *config.Config) error {
+	profiles, err := LoadProfiles()
+	if err != nil {
+		log.Error("Failed to read profiles")
+		return err
+	}
+	if len(profiles.Profiles) == 0 {
+		log.Info("No profiles found; run featurectl login")
+		return nil
+	}
+
+	current := profiles.Name(&ConnectionFlags{})
+	names := make([]string, 0, len(profiles.Profiles))
+	for name := range profiles.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var rows [][]string
+	for _, name := range names {
+		p := profiles.Profiles[name]
+		marker := ""
+		if name == current {
+			marker = "*"
+		}
+		server := p.Server
+		if server == "" {
+			server = ":" + conf.GRPCPort
+		}
+		status := "logged out"
+		switch {
+		case p.Token == "":
+		case !p.ExpiresAt.IsZero() && time.Now().After(p.ExpiresAt):
+			status = "expired"
+		case !p.ExpiresAt.IsZero():
+			status = "until " + p.ExpiresAt.Format(time.RFC3339)
+		default:
+			status = "logged in"
+		}
+		rows = append(rows, []string{marker, name, server, fmt.Sprint(p.TLS), status})
+	}
+	utils.PrintTable([]string{"", "Profile", "Server", "TLS", "Token"}, rows)
+	return nil
+}
+
+func (c *ProfileCommand) UseProfile(conf *config.Config) error {
+	profiles, err := LoadProfiles()
+	if err != nil {
+		log.Error("Failed to read profiles")
+		return err
+	}
+	if _, ok := profiles.Profiles[c.Use.Name]; !ok {
+		return fmt.Errorf("unknown profile %q", c.Use.Name)
+	}
+	profiles.Current = c.Use.Name
+	if err := profiles.Save(); err != nil {
+		log.Error("Failed to save profiles")
+		return err
+	}
+	log.Info("Switched profile", "profile", c.Use.Name)
+	return nil
+}
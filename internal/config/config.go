@@ -2,17 +2,38 @@ package config
 
 import (
 	"log"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
 )
 
 type Config struct {
-	HTTPPort          string `envconfig:"HTTP_PORT" default:"8080"`
-	GRPCPort          string `envconfig:"GRPC_PORT" default:"9090"`
-	StorageEndpoint   string `envconfig:"STORAGE_URL" default:"localhost:2379"`
-	PostgresURL       string `envconfig:"POSTGRES_URL"`
-	FlagServicePrefix string `envconfig:"FLAG_SERVICE_PREFIX" default:"/featureflags/"`
-	APIVersion        string `envconfig:"API_VERSION" default:"v1"`
+	HTTPPort             string        `envconfig:"HTTP_PORT" default:"8080"`
+	GRPCPort             string        `envconfig:"GRPC_PORT" default:"9090"`
+	StorageBackend       string        `envconfig:"STORAGE_BACKEND" default:"etcd"`
+	StorageEndpoint      string        `envconfig:"STORAGE_URL" default:"localhost:2379"`
+	StorageFile          string        `envconfig:"STORAGE_FILE" default:"featureflags.json"`
+	PostgresURL          string        `envconfig:"POSTGRES_URL"`
+	FlagServicePrefix    string        `envconfig:"FLAG_SERVICE_PREFIX" default:"/featureflags/"`
+	FlagHistoryPrefix    string        `envconfig:"FLAG_HISTORY_PREFIX" default:"/featureflag-history/"`
+	FlagKeyIndexPrefix   string        `envconfig:"FLAG_KEY_INDEX_PREFIX" default:"/featureflag-keys/"`
+	SegmentServicePrefix string        `envconfig:"SEGMENT_SERVICE_PREFIX" default:"/segments/"`
+	ProjectServicePrefix string        `envconfig:"PROJECT_SERVICE_PREFIX" default:"/projects/"`
+	SDKKeyServicePrefix  string        `envconfig:"SDK_KEY_SERVICE_PREFIX" default:"/sdkkeys/"`
+	SDKKeyGracePeriod    time.Duration `envconfig:"SDK_KEY_GRACE_PERIOD" default:"24h"`
+	JWTSecret            string        `envconfig:"JWT_SECRET"`
+	JWTJWKS              string        `envconfig:"JWT_JWKS"`
+	JWTJWKSRefresh       time.Duration `envconfig:"JWT_JWKS_REFRESH" default:"15m"`
+	JWTIssuer            string        `envconfig:"JWT_ISSUER"`
+	JWTAudience          string        `envconfig:"JWT_AUDIENCE"`
+	RBACAdminEmail       string        `envconfig:"RBAC_ADMIN_EMAIL"`
+	// DevMode lets the API run without JWT verification or RBAC, serving
+	// every request without credentials. Never set it in production.
+	DevMode              bool          `envconfig:"DEV_MODE"`
+	DefaultProject       string        `envconfig:"DEFAULT_PROJECT" default:"default"`
+	DefaultEnvironment   string        `envconfig:"DEFAULT_ENVIRONMENT" default:"production"`
+	APIVersion           string        `envconfig:"API_VERSION" default:"v1"`
+	StreamHeartbeat      time.Duration `envconfig:"STREAM_HEARTBEAT_INTERVAL" default:"15s"`
 }
 
 func LoadConfig() *Config {
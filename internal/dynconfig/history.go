@@ -0,0 +1,83 @@
+package dynconfig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/julianstephens/feature-flag-service/internal/audit"
+)
+
+var ErrEntryVersionNotFound = errors.New("config entry version not found")
+
+// EntryVersion is an immutable snapshot of an entry as one write left it.
+type EntryVersion struct {
+	Key         string          `json:"key"`
+	Version     int64           `json:"version"`
+	Value       json.RawMessage `json:"value"`
+	Type        string          `json:"type"`
+	Description string          `json:"description,omitempty"`
+	Author      string          `json:"author"`
+	CreatedAt   time.Time       `json:"createdAt"`
+}
+
+const versionColumns = "key, version, value, COALESCE(description, ''), author, created_at"
+
+// ListEntryVersions returns the history of a key, newest first. History is
+// kept after the entry is deleted.
+func (s *ConfigService) ListEntryVersions(ctx context.Context, key string) ([]*EntryVersion, error) {
+	rows, err := s.db.Query(ctx, "SELECT "+versionColumns+" FROM config_entry_versions WHERE key = $1 ORDER BY version DESC", key)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := pgx.CollectRows(rows, scanVersion)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrEntryNotFound, key)
+	}
+	return versions, nil
+}
+
+// RollbackEntry restores the value and description a key had at version as
+// a new version, recreating the entry if it has since been deleted. The
+// value must still match the schemas of the key.
+func (s *ConfigService) RollbackEntry(ctx context.Context, key string, version int64) (*Entry, error) {
+	rows, err := s.db.Query(ctx, "SELECT "+versionColumns+" FROM config_entry_versions WHERE key = $1 AND version = $2", key, version)
+	if err != nil {
+		return nil, err
+	}
+	target, err := pgx.CollectExactlyOneRow(rows, scanVersion)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s version %d", ErrEntryVersionNotFound, key, version)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.SetEntry(ctx, key, &EntryUpdate{Value: target.Value, Description: &target.Description})
+}
+
+// recordVersion adds an entry, as just written by tx, to the history of its
+// key.
+func recordVersion(ctx context.Context, tx pgx.Tx, entry *Entry) error {
+	_, err := tx.Exec(ctx,
+		"INSERT INTO config_entry_versions (key, version, value, description, author, created_at) VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6)",
+		entry.Key, entry.Version, string(entry.Value), entry.Description, audit.Actor(ctx), entry.UpdatedAt)
+	return err
+}
+
+func scanVersion(row pgx.CollectableRow) (*EntryVersion, error) {
+	var v EntryVersion
+	var value []byte
+	if err := row.Scan(&v.Key, &v.Version, &value, &v.Description, &v.Author, &v.CreatedAt); err != nil {
+		return nil, err
+	}
+	v.Value = value
+	v.Type = valueType(v.Value)
+	return &v, nil
+}
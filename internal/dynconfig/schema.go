@@ -0,0 +1,185 @@
+package dynconfig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/julianstephens/feature-flag-service/internal/audit"
+	"github.com/julianstephens/feature-flag-service/internal/schema"
+)
+
+var ErrSchemaNotFound = errors.New("config schema not found")
+
+// prefixPattern allows key prefixes such as "checkout/" or "checkout/pay".
+var prefixPattern = regexp.MustCompile(`^[A-Za-z0-9_./-]+$`)
+
+// Schema is a JSON Schema the value of every entry whose key starts with
+// Prefix must match. A key matching several prefixes must match every one
+// of their schemas.
+type Schema struct {
+	Prefix      string          `json:"prefix"`
+	Schema      json.RawMessage `json:"schema"`
+	Description string          `json:"description,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	UpdatedAt   time.Time       `json:"updatedAt"`
+}
+
+// SchemaUpdate sets the schema of a prefix, creating it if needed. The
+// description is kept when nil.
+type SchemaUpdate struct {
+	Schema      json.RawMessage `json:"schema"`
+	Description *string         `json:"description,omitempty"`
+}
+
+// querier is the part of a pool or transaction the schema checks use.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+const schemaColumns = "prefix, schema, COALESCE(description, ''), created_at, updated_at"
+
+func (s *ConfigService) ListSchemas(ctx context.Context) ([]*Schema, error) {
+	rows, err := s.db.Query(ctx, "SELECT "+schemaColumns+" FROM config_schemas ORDER BY prefix")
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanSchema)
+}
+
+func (s *ConfigService) GetSchema(ctx context.Context, prefix string) (*Schema, error) {
+	rows, err := s.db.Query(ctx, "SELECT "+schemaColumns+" FROM config_schemas WHERE prefix = $1", prefix)
+	if err != nil {
+		return nil, err
+	}
+	sch, err := pgx.CollectExactlyOneRow(rows, scanSchema)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrSchemaNotFound, prefix)
+	}
+	return sch, err
+}
+
+// SetSchema attaches a schema to a prefix, or replaces it. It fails if an
+// existing entry under the prefix does not match the new schema.
+func (s *ConfigService) SetSchema(ctx context.Context, prefix string, update *SchemaUpdate) (*Schema, error) {
+	if len(prefix) > maxKeyLength || !prefixPattern.MatchString(prefix) {
+		return nil, fmt.Errorf("%w: prefix %q must be letters, digits, '/', '.', '_' or '-'", schema.ErrInvalidSchema, prefix)
+	}
+	compiled, err := schema.Compile(update.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, "SELECT "+schemaColumns+" FROM config_schemas WHERE prefix = $1 FOR UPDATE", prefix)
+	if err != nil {
+		return nil, err
+	}
+	before, err := pgx.CollectExactlyOneRow(rows, scanSchema)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	rows, err = tx.Query(ctx, "SELECT key, value FROM config_entries WHERE starts_with(key, $1) ORDER BY key", prefix)
+	if err != nil {
+		return nil, err
+	}
+	var key string
+	var value []byte
+	_, err = pgx.ForEachRow(rows, []any{&key, &value}, func() error {
+		if err := compiled.Validate("value", value); err != nil {
+			return fmt.Errorf("%w: entry %s: %w", schema.ErrInvalidSchema, key, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.Query(ctx,
+		`INSERT INTO config_schemas (prefix, schema, description) VALUES ($1, $2, $3)
+		ON CONFLICT (prefix) DO UPDATE SET
+			schema = EXCLUDED.schema,
+			description = CASE WHEN $4 THEN EXCLUDED.description ELSE config_schemas.description END,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING `+schemaColumns,
+		prefix, string(update.Schema), update.Description, update.Description != nil)
+	if err != nil {
+		return nil, err
+	}
+	after, err := pgx.CollectExactlyOneRow(rows, scanSchema)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	change := audit.Change{Action: audit.ActionUpdate, ResourceType: audit.ResourceConfigSchema, ResourceID: prefix, After: after}
+	if before == nil {
+		change.Action = audit.ActionCreate
+	} else {
+		change.Before = before
+	}
+	audit.Log(ctx, s.audit, change)
+	return after, nil
+}
+
+func (s *ConfigService) DeleteSchema(ctx context.Context, prefix string) error {
+	rows, err := s.db.Query(ctx, "DELETE FROM config_schemas WHERE prefix = $1 RETURNING "+schemaColumns, prefix)
+	if err != nil {
+		return err
+	}
+	deleted, err := pgx.CollectExactlyOneRow(rows, scanSchema)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%w: %s", ErrSchemaNotFound, prefix)
+	}
+	if err != nil {
+		return err
+	}
+	audit.Log(ctx, s.audit, audit.Change{Action: audit.ActionDelete, ResourceType: audit.ResourceConfigSchema, ResourceID: prefix, Before: deleted})
+	return nil
+}
+
+// checkSchemas validates a value against the schemas of every prefix of
+// key.
+func checkSchemas(ctx context.Context, q querier, key string, value json.RawMessage) error {
+	rows, err := q.Query(ctx, "SELECT "+schemaColumns+" FROM config_schemas WHERE starts_with($1, prefix) ORDER BY prefix", key)
+	if err != nil {
+		return err
+	}
+	schemas, err := pgx.CollectRows(rows, scanSchema)
+	if err != nil {
+		return err
+	}
+	for _, sch := range schemas {
+		compiled, err := schema.Compile(sch.Schema)
+		if err != nil {
+			return fmt.Errorf("schema of %s: %w", sch.Prefix, err)
+		}
+		if err := compiled.Validate("value", value); err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrInvalidEntry, key, err)
+		}
+	}
+	return nil
+}
+
+func scanSchema(row pgx.CollectableRow) (*Schema, error) {
+	var sch Schema
+	var raw []byte
+	if err := row.Scan(&sch.Prefix, &raw, &sch.Description, &sch.CreatedAt, &sch.UpdatedAt); err != nil {
+		return nil, err
+	}
+	sch.Schema = raw
+	return &sch, nil
+}
@@ -0,0 +1,208 @@
+package dynconfig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	ffpb "github.com/julianstephens/feature-flag-service/gen/go/grpc/v1/featureflag.v1"
+	"github.com/julianstephens/feature-flag-service/internal/schema"
+)
+
+type ConfigGRPCServer struct {
+	ffpb.UnimplementedConfigServiceServer
+	Service Service
+}
+
+func (s *ConfigGRPCServer) ListConfigEntries(ctx context.Context, req *ffpb.ListConfigEntriesRequest) (*ffpb.ListConfigEntriesResponse, error) {
+	entries, err := s.Service.ListEntries(ctx, req.Prefix)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	res := &ffpb.ListConfigEntriesResponse{}
+	for _, e := range entries {
+		res.Entries = append(res.Entries, e.ToProto())
+	}
+	return res, nil
+}
+
+func (s *ConfigGRPCServer) GetConfigEntry(ctx context.Context, req *ffpb.GetConfigEntryRequest) (*ffpb.ConfigEntry, error) {
+	entry, err := s.Service.GetEntry(ctx, req.Key)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return entry.ToProto(), nil
+}
+
+func (s *ConfigGRPCServer) CreateConfigEntry(ctx context.Context, req *ffpb.CreateConfigEntryRequest) (*ffpb.ConfigEntry, error) {
+	entry, err := s.Service.CreateEntry(ctx, &Entry{
+		Key:         req.Key,
+		Value:       json.RawMessage(req.Value),
+		Description: req.Description,
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return entry.ToProto(), nil
+}
+
+func (s *ConfigGRPCServer) SetConfigEntry(ctx context.Context, req *ffpb.SetConfigEntryRequest) (*ffpb.ConfigEntry, error) {
+	entry, err := s.Service.SetEntry(ctx, req.Key, &EntryUpdate{
+		Value:       json.RawMessage(req.Value),
+		Description: req.Description,
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return entry.ToProto(), nil
+}
+
+func (s *ConfigGRPCServer) DeleteConfigEntry(ctx context.Context, req *ffpb.DeleteConfigEntryRequest) (*ffpb.DeleteConfigEntryResponse, error) {
+	if err := s.Service.DeleteEntry(ctx, req.Key); err != nil {
+		return nil, grpcError(err)
+	}
+	return &ffpb.DeleteConfigEntryResponse{}, nil
+}
+
+func (s *ConfigGRPCServer) WatchConfigEntries(req *ffpb.WatchConfigEntriesRequest, stream ffpb.ConfigService_WatchConfigEntriesServer) error {
+	events, err := s.Service.WatchEntries(stream.Context(), req.Prefix)
+	if err != nil {
+		return grpcError(err)
+	}
+	for ev := range events {
+		if err := stream.Send(ev.ToProto()); err != nil {
+			return err
+		}
+	}
+	if err := stream.Context().Err(); err != nil {
+		return err
+	}
+	return status.Error(codes.Unavailable, "config watch fell behind; watch again")
+}
+
+func (s *ConfigGRPCServer) ListConfigSchemas(ctx context.Context, req *ffpb.ListConfigSchemasRequest) (*ffpb.ListConfigSchemasResponse, error) {
+	schemas, err := s.Service.ListSchemas(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	res := &ffpb.ListConfigSchemasResponse{}
+	for _, sch := range schemas {
+		res.Schemas = append(res.Schemas, sch.ToProto())
+	}
+	return res, nil
+}
+
+func (s *ConfigGRPCServer) GetConfigSchema(ctx context.Context, req *ffpb.GetConfigSchemaRequest) (*ffpb.ConfigSchema, error) {
+	sch, err := s.Service.GetSchema(ctx, req.Prefix)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return sch.ToProto(), nil
+}
+
+func (s *ConfigGRPCServer) SetConfigSchema(ctx context.Context, req *ffpb.SetConfigSchemaRequest) (*ffpb.ConfigSchema, error) {
+	sch, err := s.Service.SetSchema(ctx, req.Prefix, &SchemaUpdate{
+		Schema:      json.RawMessage(req.Schema),
+		Description: req.Description,
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return sch.ToProto(), nil
+}
+
+func (s *ConfigGRPCServer) DeleteConfigSchema(ctx context.Context, req *ffpb.DeleteConfigSchemaRequest) (*ffpb.DeleteConfigSchemaResponse, error) {
+	if err := s.Service.DeleteSchema(ctx, req.Prefix); err != nil {
+		return nil, grpcError(err)
+	}
+	return &ffpb.DeleteConfigSchemaResponse{}, nil
+}
+
+func (s *ConfigGRPCServer) ListConfigEntryVersions(ctx context.Context, req *ffpb.ListConfigEntryVersionsRequest) (*ffpb.ListConfigEntryVersionsResponse, error) {
+	versions, err := s.Service.ListEntryVersions(ctx, req.Key)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	res := &ffpb.ListConfigEntryVersionsResponse{}
+	for _, v := range versions {
+		res.Versions = append(res.Versions, v.ToProto())
+	}
+	return res, nil
+}
+
+func (s *ConfigGRPCServer) RollbackConfigEntry(ctx context.Context, req *ffpb.RollbackConfigEntryRequest) (*ffpb.ConfigEntry, error) {
+	entry, err := s.Service.RollbackEntry(ctx, req.Key, req.Version)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return entry.ToProto(), nil
+}
+
+func (e *Entry) ToProto() *ffpb.ConfigEntry {
+	entry := &ffpb.ConfigEntry{
+		Id:          e.ID,
+		Key:         e.Key,
+		Value:       string(e.Value),
+		Type:        e.Type,
+		Description: e.Description,
+		Version:     e.Version,
+	}
+	if !e.CreatedAt.IsZero() {
+		entry.CreatedAt = e.CreatedAt.Format(time.RFC3339)
+	}
+	if !e.UpdatedAt.IsZero() {
+		entry.UpdatedAt = e.UpdatedAt.Format(time.RFC3339)
+	}
+	return entry
+}
+
+func (e *Event) ToProto() *ffpb.ConfigEvent {
+	ev := &ffpb.ConfigEvent{Action: e.Action}
+	if e.Entry != nil {
+		ev.Entry = e.Entry.ToProto()
+	}
+	return ev
+}
+
+func (v *EntryVersion) ToProto() *ffpb.ConfigEntryVersion {
+	return &ffpb.ConfigEntryVersion{
+		Key:         v.Key,
+		Version:     v.Version,
+		Value:       string(v.Value),
+		Type:        v.Type,
+		Description: v.Description,
+		Author:      v.Author,
+		CreatedAt:   v.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func (s *Schema) ToProto() *ffpb.ConfigSchema {
+	return &ffpb.ConfigSchema{
+		Prefix:      s.Prefix,
+		Schema:      string(s.Schema),
+		Description: s.Description,
+		CreatedAt:   s.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:   s.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// grpcError maps service errors onto gRPC status codes.
+func grpcError(err error) error {
+	var verr *schema.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		return verr.Status(err.Error()).Err()
+	case errors.Is(err, ErrEntryNotFound), errors.Is(err, ErrEntryVersionNotFound), errors.Is(err, ErrSchemaNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrEntryExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, ErrInvalidEntry), errors.Is(err, schema.ErrInvalidSchema):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return err
+	}
+}
@@ -0,0 +1,253 @@
+package dynconfig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/julianstephens/feature-flag-service/internal/audit"
+	"github.com/julianstephens/feature-flag-service/internal/config"
+	"github.com/julianstephens/feature-flag-service/internal/utils"
+)
+
+var (
+	ErrEntryNotFound = errors.New("config entry not found")
+	ErrEntryExists   = errors.New("config entry already exists")
+	ErrInvalidEntry  = errors.New("invalid config entry")
+)
+
+// keyPattern allows keys made of "/"-separated segments, e.g.
+// checkout/payments/timeout.
+var keyPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+(/[A-Za-z0-9_.-]+)*$`)
+
+const maxKeyLength = 255
+
+// pgUniqueViolation is the Postgres error code for a duplicate key.
+const pgUniqueViolation = "23505"
+
+// Entry is a JSON configuration value stored under a hierarchical key.
+type Entry struct {
+	ID          string          `json:"id"`
+	Key         string          `json:"key"`
+	Value       json.RawMessage `json:"value"`
+	Type        string          `json:"type"`
+	Description string          `json:"description,omitempty"`
+	// Version is incremented by every write; each version is kept in the
+	// key's history.
+	Version   int64     `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// EntryUpdate sets the value of an entry, creating it if needed. The
+// description is kept when nil.
+type EntryUpdate struct {
+	Value       json.RawMessage `json:"value"`
+	Description *string         `json:"description,omitempty"`
+}
+
+// Service manages configuration entries. A prefix of "" lists or watches
+// every entry; "checkout/" only the entries below checkout.
+type Service interface {
+	ListEntries(ctx context.Context, prefix string) ([]*Entry, error)
+	GetEntry(ctx context.Context, key string) (*Entry, error)
+	CreateEntry(ctx context.Context, entry *Entry) (*Entry, error)
+	SetEntry(ctx context.Context, key string, update *EntryUpdate) (*Entry, error)
+	DeleteEntry(ctx context.Context, key string) error
+	WatchEntries(ctx context.Context, prefix string) (<-chan *Event, error)
+	ListSchemas(ctx context.Context) ([]*Schema, error)
+	GetSchema(ctx context.Context, prefix string) (*Schema, error)
+	SetSchema(ctx context.Context, prefix string, update *SchemaUpdate) (*Schema, error)
+	DeleteSchema(ctx context.Context, prefix string) error
+	ListEntryVersions(ctx context.Context, key string) ([]*EntryVersion, error)
+	RollbackEntry(ctx context.Context, key string, version int64) (*Entry, error)
+}
+
+type ConfigService struct {
+	conf  *config.Config
+	db    *pgxpool.Pool
+	audit audit.Recorder
+
+	mu        sync.Mutex
+	watchers  map[*entryWatcher]struct{}
+	listening bool
+}
+
+func NewService(conf *config.Config, db *pgxpool.Pool, recorder audit.Recorder) Service {
+	return &ConfigService{
+		conf:     conf,
+		db:       db,
+		audit:    recorder,
+		watchers: make(map[*entryWatcher]struct{}),
+	}
+}
+
+const entryColumns = "id::text, key, value, COALESCE(description, ''), version, created_at, updated_at"
+
+// nextVersion is the version of a key's first write, continuing the history
+// of a key that was deleted.
+const nextVersion = "(SELECT COALESCE(MAX(version), 0) + 1 FROM config_entry_versions WHERE key = $2)"
+
+func (s *ConfigService) ListEntries(ctx context.Context, prefix string) ([]*Entry, error) {
+	rows, err := s.db.Query(ctx, "SELECT "+entryColumns+" FROM config_entries WHERE starts_with(key, $1) ORDER BY key", prefix)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanEntry)
+}
+
+func (s *ConfigService) GetEntry(ctx context.Context, key string) (*Entry, error) {
+	rows, err := s.db.Query(ctx, "SELECT "+entryColumns+" FROM config_entries WHERE key = $1", key)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := pgx.CollectExactlyOneRow(rows, scanEntry)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrEntryNotFound, key)
+	}
+	return entry, err
+}
+
+func (s *ConfigService) CreateEntry(ctx context.Context, input *Entry) (*Entry, error) {
+	if err := validate(input.Key, input.Value); err != nil {
+		return nil, err
+	}
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	if err := checkSchemas(ctx, tx, input.Key, input.Value); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx,
+		"INSERT INTO config_entries (id, key, value, description, version) VALUES ($1, $2, $3, NULLIF($4, ''), "+nextVersion+") RETURNING "+entryColumns,
+		utils.GenerateID(), input.Key, string(input.Value), input.Description)
+	if err != nil {
+		return nil, err
+	}
+	created, err := pgx.CollectExactlyOneRow(rows, scanEntry)
+	if isUniqueViolation(err) {
+		return nil, fmt.Errorf("%w: %s", ErrEntryExists, input.Key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := recordVersion(ctx, tx, created); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	audit.Log(ctx, s.audit, audit.Change{Action: audit.ActionCreate, ResourceType: audit.ResourceConfig, ResourceID: created.Key, After: created})
+	return created, nil
+}
+
+// SetEntry creates the entry or replaces its value. The upsert means
+// concurrent writers cannot both create it; the row lock keeps the audited
+// before snapshot accurate.
+func (s *ConfigService) SetEntry(ctx context.Context, key string, update *EntryUpdate) (*Entry, error) {
+	if err := validate(key, update.Value); err != nil {
+		return nil, err
+	}
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	if err := checkSchemas(ctx, tx, key, update.Value); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, "SELECT "+entryColumns+" FROM config_entries WHERE key = $1 FOR UPDATE", key)
+	if err != nil {
+		return nil, err
+	}
+	before, err := pgx.CollectExactlyOneRow(rows, scanEntry)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	rows, err = tx.Query(ctx,
+		`INSERT INTO config_entries (id, key, value, description, version) VALUES ($1, $2, $3, $4, `+nextVersion+`)
+		ON CONFLICT (key) DO UPDATE SET
+			value = EXCLUDED.value,
+			description = CASE WHEN $5 THEN EXCLUDED.description ELSE config_entries.description END,
+			version = config_entries.version + 1,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING `+entryColumns,
+		utils.GenerateID(), key, string(update.Value), update.Description, update.Description != nil)
+	if err != nil {
+		return nil, err
+	}
+	after, err := pgx.CollectExactlyOneRow(rows, scanEntry)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordVersion(ctx, tx, after); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	change := audit.Change{Action: audit.ActionUpdate, ResourceType: audit.ResourceConfig, ResourceID: key, After: after}
+	if before == nil {
+		change.Action = audit.ActionCreate
+	} else {
+		change.Before = before
+	}
+	audit.Log(ctx, s.audit, change)
+	return after, nil
+}
+
+func (s *ConfigService) DeleteEntry(ctx context.Context, key string) error {
+	rows, err := s.db.Query(ctx, "DELETE FROM config_entries WHERE key = $1 RETURNING "+entryColumns, key)
+	if err != nil {
+		return err
+	}
+	deleted, err := pgx.CollectExactlyOneRow(rows, scanEntry)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%w: %s", ErrEntryNotFound, key)
+	}
+	if err != nil {
+		return err
+	}
+	audit.Log(ctx, s.audit, audit.Change{Action: audit.ActionDelete, ResourceType: audit.ResourceConfig, ResourceID: key, Before: deleted})
+	return nil
+}
+
+func validate(key string, value json.RawMessage) error {
+	if len(key) > maxKeyLength || !keyPattern.MatchString(key) {
+		return fmt.Errorf("%w: key %q must be \"/\"-separated segments of letters, digits, '.', '_' or '-'", ErrInvalidEntry, key)
+	}
+	if len(value) == 0 || !json.Valid(value) {
+		return fmt.Errorf("%w: value of %s must be valid JSON", ErrInvalidEntry, key)
+	}
+	return nil
+}
+
+func scanEntry(row pgx.CollectableRow) (*Entry, error) {
+	var e Entry
+	var value []byte
+	if err := row.Scan(&e.ID, &e.Key, &value, &e.Description, &e.Version, &e.CreatedAt, &e.UpdatedAt); err != nil {
+		return nil, err
+	}
+	e.Value = value
+	e.Type = valueType(e.Value)
+	return &e, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation
+}
@@ -0,0 +1,124 @@
+package dynconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrTypeMismatch = errors.New("config value has a different type")
+
+// Value types reported by Entry.Type.
+const (
+	TypeString  = "string"
+	TypeNumber  = "number"
+	TypeBoolean = "boolean"
+	TypeObject  = "object"
+	TypeArray   = "array"
+	TypeNull    = "null"
+)
+
+// valueType names the JSON type of a value from its first byte.
+func valueType(value json.RawMessage) string {
+	value = bytes.TrimSpace(value)
+	if len(value) == 0 {
+		return ""
+	}
+	switch value[0] {
+	case '"':
+		return TypeString
+	case 't', 'f':
+		return TypeBoolean
+	case 'n':
+		return TypeNull
+	case '{':
+		return TypeObject
+	case '[':
+		return TypeArray
+	default:
+		return TypeNumber
+	}
+}
+
+// Decode unmarshals the value into v.
+func (e *Entry) Decode(v any) error {
+	if err := json.Unmarshal(e.Value, v); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrTypeMismatch, e.Key, err)
+	}
+	return nil
+}
+
+func (e *Entry) AsString() (string, error) {
+	var s string
+	if err := e.expect(TypeString); err != nil {
+		return "", err
+	}
+	if err := e.Decode(&s); err != nil {
+		return "", err
+	}
+	return s, nil
+}
+
+func (e *Entry) AsBool() (bool, error) {
+	var b bool
+	if err := e.expect(TypeBoolean); err != nil {
+		return false, err
+	}
+	if err := e.Decode(&b); err != nil {
+		return false, err
+	}
+	return b, nil
+}
+
+func (e *Entry) AsFloat() (float64, error) {
+	var f float64
+	if err := e.expect(TypeNumber); err != nil {
+		return 0, err
+	}
+	if err := e.Decode(&f); err != nil {
+		return 0, err
+	}
+	return f, nil
+}
+
+// AsInt fails for numbers with a fractional part.
+func (e *Entry) AsInt() (int64, error) {
+	var i int64
+	if err := e.expect(TypeNumber); err != nil {
+		return 0, err
+	}
+	if err := e.Decode(&i); err != nil {
+		return 0, err
+	}
+	return i, nil
+}
+
+// AsDuration reads a string such as "1m30s", or a number of milliseconds.
+func (e *Entry) AsDuration() (time.Duration, error) {
+	switch e.Type {
+	case TypeNumber:
+		ms, err := e.AsInt()
+		return time.Duration(ms) * time.Millisecond, err
+	case TypeString:
+		s, err := e.AsString()
+		if err != nil {
+			return 0, err
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %s: %v", ErrTypeMismatch, e.Key, err)
+		}
+		return d, nil
+	default:
+		return 0, fmt.Errorf("%w: %s has type %s, not a duration", ErrTypeMismatch, e.Key, e.Type)
+	}
+}
+
+func (e *Entry) expect(typ string) error {
+	if e.Type != typ {
+		return fmt.Errorf("%w: %s has type %s, not %s", ErrTypeMismatch, e.Key, e.Type, typ)
+	}
+	return nil
+}
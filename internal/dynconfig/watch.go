@@ -0,0 +1,224 @@
+package dynconfig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+// Event actions sent by WatchEntries.
+const (
+	// ActionSnapshot carries an entry that existed when the watch started.
+	ActionSnapshot = "snapshot"
+	// ActionResync is sent after a lost database connection, before a new
+	// snapshot; watchers should drop entries it does not repeat.
+	ActionResync  = "resync"
+	ActionCreated = "created"
+	ActionUpdated = "updated"
+	// ActionDeleted carries an entry with only its key set.
+	ActionDeleted = "deleted"
+)
+
+// notifyChannel is the channel the config_entries trigger notifies.
+const notifyChannel = "config_entries"
+
+// watcherBuffer is the number of events a slow watcher may fall behind by
+// before it is dropped.
+const watcherBuffer = 64
+
+const listenRetryInterval = time.Second
+
+type Event struct {
+	Action string `json:"action"`
+	Entry  *Entry `json:"entry,omitempty"`
+}
+
+type entryWatcher struct {
+	prefix string
+	in     chan *Event
+}
+
+type notification struct {
+	Op  string `json:"op"`
+	Key string `json:"key"`
+}
+
+// WatchEntries sends a snapshot event for every entry under prefix, then an
+// event for each change, until ctx is done. The channel is also closed when
+// the watcher falls too far behind, in which case it should watch again.
+func (s *ConfigService) WatchEntries(ctx context.Context, prefix string) (<-chan *Event, error) {
+	w := &entryWatcher{prefix: prefix, in: make(chan *Event, watcherBuffer)}
+	s.mu.Lock()
+	s.watchers[w] = struct{}{}
+	if !s.listening {
+		s.listening = true
+		go s.listen()
+	}
+	s.mu.Unlock()
+
+	// Registering before the snapshot means no change is missed, though one
+	// may be sent after the snapshot already included it.
+	snapshot, err := s.ListEntries(ctx, prefix)
+	if err != nil {
+		s.unwatch(w)
+		return nil, err
+	}
+
+	out := make(chan *Event)
+	go func() {
+		defer close(out)
+		defer s.unwatch(w)
+
+		send := func(ev *Event) bool {
+			select {
+			case out <- ev:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		for _, entry := range snapshot {
+			if !send(&Event{Action: ActionSnapshot, Entry: entry}) {
+				return
+			}
+		}
+		for {
+			select {
+			case ev, ok := <-w.in:
+				if !ok {
+					log.Printf("dropped slow config watcher for prefix %q", prefix)
+					return
+				}
+				if !send(ev) {
+					return
+				}
+				if ev.Action == ActionResync {
+					entries, err := s.ListEntries(ctx, prefix)
+					if err != nil {
+						log.Printf("error resyncing config watcher for prefix %q: %v", prefix, err)
+						return
+					}
+					for _, entry := range entries {
+						if !send(&Event{Action: ActionSnapshot, Entry: entry}) {
+							return
+						}
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (s *ConfigService) unwatch(w *entryWatcher) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.watchers[w]; ok {
+		delete(s.watchers, w)
+		close(w.in)
+	}
+}
+
+// listen holds one connection for the service, listening for changes to
+// config_entries, and reconnects when it is lost.
+func (s *ConfigService) listen() {
+	ctx := context.Background()
+	reconnect := false
+	for {
+		if err := s.listenOnce(ctx, reconnect); err != nil {
+			log.Printf("error listening for config changes: %v", err)
+		}
+		reconnect = true
+		time.Sleep(listenRetryInterval)
+	}
+}
+
+func (s *ConfigService) listenOnce(ctx context.Context, reconnect bool) error {
+	pooled, err := s.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// The connection stays in LISTEN mode, so it is taken out of the pool.
+	conn := pooled.Hijack()
+	defer conn.Close(ctx)
+
+	if _, err := conn.Exec(ctx, "LISTEN "+notifyChannel); err != nil {
+		return err
+	}
+	if reconnect {
+		// Changes made while disconnected were missed.
+		s.broadcast("", &Event{Action: ActionResync})
+	}
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var change notification
+		if err := json.Unmarshal([]byte(n.Payload), &change); err != nil {
+			log.Printf("ignoring invalid config notification: %s", n.Payload)
+			continue
+		}
+		if ev := s.event(ctx, change); ev != nil {
+			s.broadcast(change.Key, ev)
+		}
+	}
+}
+
+// event reads the entry a notification is about, unless nobody watches it.
+func (s *ConfigService) event(ctx context.Context, change notification) *Event {
+	if !s.watched(change.Key) {
+		return nil
+	}
+	if change.Op == "DELETE" {
+		return &Event{Action: ActionDeleted, Entry: &Entry{Key: change.Key}}
+	}
+	entry, err := s.GetEntry(ctx, change.Key)
+	if errors.Is(err, ErrEntryNotFound) {
+		// Deleted since; its own notification follows.
+		return nil
+	}
+	if err != nil {
+		log.Printf("error reading changed config entry %s: %v", change.Key, err)
+		return nil
+	}
+	if change.Op == "INSERT" {
+		return &Event{Action: ActionCreated, Entry: entry}
+	}
+	return &Event{Action: ActionUpdated, Entry: entry}
+}
+
+func (s *ConfigService) watched(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for w := range s.watchers {
+		if strings.HasPrefix(key, w.prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// broadcast queues ev for the watchers of key, dropping any watcher whose
+// queue is full rather than holding up the others.
+func (s *ConfigService) broadcast(key string, ev *Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for w := range s.watchers {
+		if !strings.HasPrefix(key, w.prefix) && ev.Action != ActionResync {
+			continue
+		}
+		select {
+		case w.in <- ev:
+		default:
+			delete(s.watchers, w)
+			close(w.in)
+		}
+	}
+}
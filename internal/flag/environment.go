@@ -0,0 +1,164 @@
+package flag
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	ffpb "github.com/julianstephens/feature-flag-service/gen/go/grpc/v1/featureflag.v1"
+	"github.com/julianstephens/feature-flag-service/internal/project"
+)
+
+// FlagEnvironment is the state of a flag in one environment of its project.
+// The flag's variations are shared by every environment; whether it is on
+// and who gets which variation are not.
+type FlagEnvironment struct {
+	Enabled       bool           `json:"enabled"`
+	OnVariation   int            `json:"onVariation"`
+	OffVariation  int            `json:"offVariation"`
+	Targets       []Target       `json:"targets"`
+	Rules         []Rule         `json:"rules"`
+	Prerequisites []Prerequisite `json:"prerequisites"`
+	// Rollout replaces the on variation for contexts that fall through.
+	Rollout *Rollout `json:"rollout,omitempty"`
+}
+
+// unsetVariation marks an on or off variation a write left out.
+const unsetVariation = -1
+
+// UnmarshalJSON leaves the on and off variations a request omits unset, so
+// they keep their current value rather than pointing at the first variation.
+func (e *FlagEnvironment) UnmarshalJSON(data []byte) error {
+	type plain FlagEnvironment
+	state := plain{OnVariation: unsetVariation, OffVariation: unsetVariation}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	*e = FlagEnvironment(state)
+	return nil
+}
+
+// Environment returns the flag's state in env. A flag that was never
+// configured in env is off there and serves its last variation.
+func (f *Flag) Environment(env string) *FlagEnvironment {
+	if state, ok := f.Environments[env]; ok && state != nil {
+		return state
+	}
+	state := &FlagEnvironment{}
+	if len(f.Variations) > 0 {
+		state.OffVariation = len(f.Variations) - 1
+	}
+	return state
+}
+
+// fillVariations gives the on and off variations a write left unset the
+// values they have in current.
+func (e *FlagEnvironment) fillVariations(current *FlagEnvironment) {
+	if e.OnVariation == unsetVariation {
+		e.OnVariation = current.OnVariation
+	}
+	if e.OffVariation == unsetVariation {
+		e.OffVariation = current.OffVariation
+	}
+}
+
+// Scoped returns a copy of the flag carrying only its state in env, for
+// callers that may not see the other environments.
+func (f *Flag) Scoped(env string) *Flag {
+	scoped := *f
+	scoped.Environments = map[string]*FlagEnvironment{env: f.Environment(env)}
+	return &scoped
+}
+
+// checkEnvironments rejects state for environments the project does not have.
+func checkEnvironments(proj *project.Project, envs map[string]*FlagEnvironment) error {
+	for key, state := range envs {
+		if state == nil {
+			return fmt.Errorf("%w: environment %s has no state", ErrInvalidFlag, key)
+		}
+		if !proj.HasEnvironment(key) {
+			return fmt.Errorf("%w: project %s has no environment %q", ErrInvalidFlag, proj.Key, key)
+		}
+	}
+	return nil
+}
+
+// pruneEnvironments drops state kept for environments that have since been
+// removed from the project.
+func (f *Flag) pruneEnvironments(proj *project.Project) {
+	for key := range f.Environments {
+		if !proj.HasEnvironment(key) {
+			delete(f.Environments, key)
+		}
+	}
+}
+
+func (e *FlagEnvironment) validate(variations int) error {
+	if e.OnVariation < 0 || e.OnVariation >= variations {
+		return fmt.Errorf("%w: on variation %d out of range", ErrInvalidFlag, e.OnVariation)
+	}
+	if e.OffVariation < 0 || e.OffVariation >= variations {
+		return fmt.Errorf("%w: off variation %d out of range", ErrInvalidFlag, e.OffVariation)
+	}
+	return e.validateTargeting(variations)
+}
+
+func environmentKeys(envs map[string]*FlagEnvironment) []string {
+	keys := make([]string, 0, len(envs))
+	for k := range envs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (e *FlagEnvironment) ToProto() *ffpb.FlagEnvironment {
+	on, off := int32(e.OnVariation), int32(e.OffVariation)
+	return &ffpb.FlagEnvironment{
+		Enabled:       e.Enabled,
+		OnVariation:   &on,
+		OffVariation:  &off,
+		Targets:       targetsToProto(e.Targets),
+		Rules:         rulesToProto(e.Rules),
+		Prerequisites: prerequisitesToProto(e.Prerequisites),
+		Rollout:       e.Rollout.ToProto(),
+	}
+}
+
+func FlagEnvironmentFromProto(protoEnv *ffpb.FlagEnvironment) *FlagEnvironment {
+	if protoEnv == nil {
+		return nil
+	}
+	state := &FlagEnvironment{
+		Enabled:       protoEnv.Enabled,
+		OnVariation:   unsetVariation,
+		OffVariation:  unsetVariation,
+		Targets:       TargetsFromProto(protoEnv.Targets),
+		Rules:         RulesFromProto(protoEnv.Rules),
+		Prerequisites: PrerequisitesFromProto(protoEnv.Prerequisites),
+		Rollout:       RolloutFromProto(protoEnv.Rollout),
+	}
+	if protoEnv.OnVariation != nil {
+		state.OnVariation = int(*protoEnv.OnVariation)
+	}
+	if protoEnv.OffVariation != nil {
+		state.OffVariation = int(*protoEnv.OffVariation)
+	}
+	return state
+}
+
+func environmentsToProto(envs map[string]*FlagEnvironment) map[string]*ffpb.FlagEnvironment {
+	protoEnvs := make(map[string]*ffpb.FlagEnvironment, len(envs))
+	for key, state := range envs {
+		protoEnvs[key] = state.ToProto()
+	}
+	return protoEnvs
+}
+
+func EnvironmentsFromProto(protoEnvs map[string]*ffpb.FlagEnvironment) map[string]*FlagEnvironment {
+	envs := make(map[string]*FlagEnvironment, len(protoEnvs))
+	for key, protoEnv := range protoEnvs {
+		envs[key] = FlagEnvironmentFromProto(protoEnv)
+	}
+	return envs
+}
@@ -0,0 +1,304 @@
+package flag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+
+	ffpb "github.com/julianstephens/feature-flag-service/gen/go/grpc/v1/featureflag.v1"
+	"github.com/julianstephens/feature-flag-service/internal/storage"
+)
+
+const (
+	ReasonOff                = "OFF"
+	ReasonFallthrough        = "FALLTHROUGH"
+	ReasonRuleMatch          = "RULE_MATCH"
+	ReasonTargetMatch        = "TARGET_MATCH"
+	ReasonPrerequisiteFailed = "PREREQUISITE_FAILED"
+	ReasonError              = "ERROR"
+)
+
+// Error kinds reported alongside ReasonError.
+const (
+	ErrorFlagNotFound  = "FLAG_NOT_FOUND"
+	ErrorMalformedFlag = "MALFORMED_FLAG"
+)
+
+// Evaluation is the outcome of evaluating a flag for a context.
+type Evaluation struct {
+	FlagID    string          `json:"flagId"`
+	FlagKey   string          `json:"flagKey,omitempty"`
+	Value     json.RawMessage `json:"value,omitempty"`
+	Variation int             `json:"variation"`
+	Reason    string          `json:"reason"`
+	RuleID    string          `json:"ruleId,omitempty"`
+	// Bucket is the context's rollout bucket in [0, 100000) when the
+	// variation came from a percentage rollout.
+	Bucket    *int   `json:"bucket,omitempty"`
+	ErrorKind string `json:"errorKind,omitempty"`
+	// PrerequisiteID is the first unmet prerequisite of a
+	// PREREQUISITE_FAILED result.
+	PrerequisiteID string `json:"prerequisiteId,omitempty"`
+}
+
+// EvaluateFlag evaluates a single flag of a project, given by ID or key, in
+// env for ectx. A missing flag is reported as an ERROR evaluation rather than
+// an error so callers can fall back to their default value.
+func (s *FlagService) EvaluateFlag(ctx context.Context, project, env, ref string, ectx *EvaluationContext) (*Evaluation, error) {
+	project, env = s.projectKey(project), s.envKey(env)
+	if _, err := s.projects.GetEnvironment(ctx, project, env); err != nil {
+		return nil, err
+	}
+	id, err := s.resolveID(ctx, project, ref)
+	if errors.Is(err, ErrFlagNotFound) {
+		return errorEvaluation(ref, ErrorFlagNotFound), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	flags, segments, err := s.loadForEvaluation(ctx, project, env, id)
+	if err != nil {
+		return nil, err
+	}
+	return newEvaluator(flags, segments, env, ectx).evaluate(id), nil
+}
+
+// EvaluateFlags evaluates the given flags of a project, by ID or key, or
+// every flag when refs is empty, in env against a single read of the store.
+func (s *FlagService) EvaluateFlags(ctx context.Context, project, env string, refs []string, ectx *EvaluationContext) ([]*Evaluation, error) {
+	project, env = s.projectKey(project), s.envKey(env)
+	if _, err := s.projects.GetEnvironment(ctx, project, env); err != nil {
+		return nil, err
+	}
+	flags, segments, err := s.loadForEvaluation(ctx, project, env, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(refs) == 0 {
+		for id := range flags {
+			refs = append(refs, id)
+		}
+		sort.Strings(refs)
+	}
+
+	e := newEvaluator(flags, segments, env, ectx)
+	evals := make([]*Evaluation, 0, len(refs))
+	for _, ref := range refs {
+		if flag, ok := lookup(flags, ref); ok {
+			ref = flag.ID
+		}
+		evals = append(evals, e.evaluate(ref))
+	}
+	return evals, nil
+}
+
+// loadForEvaluation reads the flag of a project with the given ID, or every
+// flag of the project when id is empty, together with the prerequisites and
+// segments they depend on in env as of the same store revision. A segment
+// change therefore reaches every flag referencing it in the same evaluation.
+func (s *FlagService) loadForEvaluation(ctx context.Context, project, env, id string) (map[string]*Flag, Segments, error) {
+	key := s.GetKey(project, id)
+	list, err := s.store.List(ctx, key, storage.ListOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	res, rev := list.Values(), list.Revision
+	if id != "" {
+		// The prefix read of a single flag also returns flags whose IDs
+		// merely start with id.
+		v, ok := res[key]
+		res = map[string]string{}
+		if ok {
+			res[key] = v
+			if flag, err := ParseFlag([]byte(v)); err == nil && len(flag.prerequisites(env)) > 0 {
+				list, err = s.store.List(ctx, s.projectPrefix(project), storage.ListOptions{Revision: rev})
+				if err != nil {
+					return nil, nil, err
+				}
+				res = list.Values()
+			}
+		}
+	}
+
+	flags := make(map[string]*Flag, len(res))
+	needSegments := false
+	for _, v := range res {
+		flag, err := ParseFlag([]byte(v))
+		if err != nil {
+			log.Printf("error unmarshaling flag: %v", err)
+			continue
+		}
+		flags[flag.ID] = flag
+		needSegments = needSegments || len(flag.Environment(env).segmentKeys()) > 0
+	}
+
+	if !needSegments || s.segments == nil {
+		return flags, nil, nil
+	}
+	segments, err := s.segments.LoadSegments(ctx, rev)
+	if err != nil {
+		return nil, nil, err
+	}
+	return flags, segments, nil
+}
+
+// evaluator evaluates flags in one environment for one context against a
+// consistent set of flags and segments, evaluating each prerequisite at most
+// once.
+type evaluator struct {
+	flags    map[string]*Flag
+	segments Segments
+	env      string
+	ectx     *EvaluationContext
+	results  map[string]*Evaluation
+	visiting map[string]bool
+}
+
+func newEvaluator(flags map[string]*Flag, segments Segments, env string, ectx *EvaluationContext) *evaluator {
+	if ectx == nil {
+		ectx = &EvaluationContext{}
+	}
+	return &evaluator{
+		flags:    flags,
+		segments: segments,
+		env:      env,
+		ectx:     ectx,
+		results:  make(map[string]*Evaluation),
+		visiting: make(map[string]bool),
+	}
+}
+
+func (e *evaluator) evaluate(id string) *Evaluation {
+	if eval, ok := e.results[id]; ok {
+		return eval
+	}
+	flag, ok := e.flags[id]
+	if !ok {
+		return errorEvaluation(id, ErrorFlagNotFound)
+	}
+	// Cycles are rejected when flags are written, but data written before
+	// that check existed could still contain one.
+	if e.visiting[id] {
+		return errorEvaluation(id, ErrorMalformedFlag)
+	}
+
+	e.visiting[id] = true
+	eval := flag.evaluate(e)
+	delete(e.visiting, id)
+	e.results[id] = eval
+	return eval
+}
+
+func errorEvaluation(id, kind string) *Evaluation {
+	return &Evaluation{
+		FlagID:    id,
+		Variation: -1,
+		Reason:    ReasonError,
+		ErrorKind: kind,
+	}
+}
+
+// evaluate resolves the variation served to the evaluator's context in the
+// evaluator's environment. A disabled flag serves its off variation, as does
+// a flag whose prerequisites are not met. Otherwise individual targets are
+// checked first, then rules in order, before falling through to the rollout
+// or on variation.
+func (f *Flag) evaluate(e *evaluator) *Evaluation {
+	ectx := e.ectx
+	state := f.Environment(e.env)
+	if !state.Enabled {
+		return f.result(state.OffVariation, ReasonOff, "")
+	}
+
+	for _, p := range state.Prerequisites {
+		if !p.met(e) {
+			eval := f.result(state.OffVariation, ReasonPrerequisiteFailed, "")
+			eval.PrerequisiteID = p.FlagID
+			return eval
+		}
+	}
+
+	if ectx.Key != "" {
+		for _, t := range state.Targets {
+			for _, key := range t.Values {
+				if key == ectx.Key {
+					return f.result(t.Variation, ReasonTargetMatch, "")
+				}
+			}
+		}
+	}
+
+	for i := range state.Rules {
+		rule := &state.Rules[i]
+		if !rule.Matches(ectx, e.segments) {
+			continue
+		}
+		if rule.Rollout != nil {
+			return f.rollout(ectx, rule.Rollout, ReasonRuleMatch, rule.ID)
+		}
+		return f.result(rule.Variation, ReasonRuleMatch, rule.ID)
+	}
+
+	if state.Rollout != nil {
+		return f.rollout(ectx, state.Rollout, ReasonFallthrough, "")
+	}
+	return f.result(state.OnVariation, ReasonFallthrough, "")
+}
+
+func (f *Flag) rollout(ectx *EvaluationContext, rollout *Rollout, reason, ruleID string) *Evaluation {
+	bucket := f.bucket(ectx, rollout.BucketBy)
+	eval := f.result(rollout.resolve(bucket), reason, ruleID)
+	eval.Bucket = &bucket
+	return eval
+}
+
+func (f *Flag) result(variation int, reason, ruleID string) *Evaluation {
+	if variation < 0 || variation >= len(f.Variations) {
+		eval := errorEvaluation(f.ID, ErrorMalformedFlag)
+		eval.FlagKey = f.Key
+		return eval
+	}
+	return &Evaluation{
+		FlagID:    f.ID,
+		FlagKey:   f.Key,
+		Value:     f.Variations[variation].Value,
+		Variation: variation,
+		Reason:    reason,
+		RuleID:    ruleID,
+	}
+}
+
+func (e *Evaluation) ToProto() *ffpb.EvaluationResult {
+	res := &ffpb.EvaluationResult{
+		FlagId:         e.FlagID,
+		FlagKey:        e.FlagKey,
+		Value:          string(e.Value),
+		Variation:      int32(e.Variation),
+		Reason:         e.Reason,
+		RuleId:         e.RuleID,
+		ErrorKind:      e.ErrorKind,
+		PrerequisiteId: e.PrerequisiteID,
+	}
+	if e.Bucket != nil {
+		bucket := int32(*e.Bucket)
+		res.Bucket = &bucket
+	}
+	return res
+}
+
+// EvaluationContextFromProto converts a protobuf context. Attribute values
+// decode the same way as JSON: numbers become float64 and lists []any.
+func EvaluationContextFromProto(protoCtx *ffpb.EvaluationContext) *EvaluationContext {
+	ectx := &EvaluationContext{}
+	if protoCtx == nil {
+		return ectx
+	}
+	ectx.Key = protoCtx.Key
+	if protoCtx.Attributes != nil {
+		ectx.Attributes = protoCtx.Attributes.AsMap()
+	}
+	return ectx
+}
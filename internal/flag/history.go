@@ -0,0 +1,136 @@
+package flag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	ffpb "github.com/julianstephens/feature-flag-service/gen/go/grpc/v1/featureflag.v1"
+	"github.com/julianstephens/feature-flag-service/internal/audit"
+	"github.com/julianstephens/feature-flag-service/internal/storage"
+)
+
+var (
+	ErrFlagVersionNotFound = errors.New("flag version not found")
+	ErrFlagConflict        = errors.New("flag was changed concurrently")
+)
+
+// FlagVersion is an immutable snapshot of a flag as one write left it.
+type FlagVersion struct {
+	Version   int64     `json:"version"`
+	Author    string    `json:"author"`
+	CreatedAt time.Time `json:"createdAt"`
+	Flag      *Flag     `json:"flag"`
+}
+
+// flagHistoryPrefix returns the prefix under which the versions of a flag are
+// stored. It lies outside the flag prefix, so flag listings and watches never
+// see it. History outlives the flag.
+func (s *FlagService) flagHistoryPrefix(project, id string) string {
+	return s.historyPrefix + s.projectKey(project) + "/" + id + "/"
+}
+
+// historyKey zero-pads the version so keys sort in version order.
+func (s *FlagService) historyKey(project, id string, version int64) string {
+	return fmt.Sprintf("%s%020d", s.flagHistoryPrefix(project, id), version)
+}
+
+// ListFlagVersions returns the history of a flag, newest first. Flags last
+// written before history was kept have none until their next write.
+func (s *FlagService) ListFlagVersions(ctx context.Context, project, ref string) ([]*FlagVersion, error) {
+	id, err := s.resolveID(ctx, project, ref)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.store.List(ctx, s.flagHistoryPrefix(project, id), storage.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if len(res.KVs) == 0 {
+		if _, err := s.GetFlag(ctx, project, id); err != nil {
+			return nil, err
+		}
+	}
+
+	versions := make([]*FlagVersion, 0, len(res.KVs))
+	for i := len(res.KVs) - 1; i >= 0; i-- {
+		var version FlagVersion
+		if err := json.Unmarshal([]byte(res.KVs[i].Value), &version); err != nil {
+			log.Printf("error unmarshaling flag version: %v", err)
+			continue
+		}
+		versions = append(versions, &version)
+	}
+	return versions, nil
+}
+
+func (s *FlagService) GetFlagVersion(ctx context.Context, project, ref string, version int64) (*FlagVersion, error) {
+	id, err := s.resolveID(ctx, project, ref)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.store.Get(ctx, s.historyKey(project, id, version))
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		return nil, fmt.Errorf("%w: %s version %d", ErrFlagVersionNotFound, ref, version)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var res FlagVersion
+	if err := json.Unmarshal([]byte(resp.Value), &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// RollbackFlag restores the definition and environment states a flag had at
+// version, including its bucketing salt, as a new version. The key is kept
+// and environments the project no longer has are dropped.
+func (s *FlagService) RollbackFlag(ctx context.Context, projectKey, ref string, version int64) (*Flag, error) {
+	proj, err := s.projects.GetProject(ctx, s.projectKey(projectKey))
+	if err != nil {
+		return nil, err
+	}
+	flag, err := s.GetFlag(ctx, proj.Key, ref)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.GetFlagVersion(ctx, proj.Key, flag.ID, version)
+	if err != nil {
+		return nil, err
+	}
+	before := audit.Snapshot(flag)
+
+	restored := *target.Flag
+	restored.ID = flag.ID
+	restored.Key = flag.Key
+	restored.Project = flag.Project
+	restored.CreatedAt = flag.CreatedAt
+	restored.Version = flag.Version
+	restored.Revision = flag.Revision
+	restored.UpdatedAt = time.Now()
+	restored.pruneEnvironments(proj)
+	guard, err := s.check(ctx, &restored)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.put(ctx, proj, &restored, false, guard); err != nil {
+		return nil, err
+	}
+	audit.Log(ctx, s.audit, audit.Change{Action: audit.ActionUpdate, ResourceType: audit.ResourceFlag, ResourceID: restored.ID, Project: restored.Project, Before: before, After: &restored})
+	return &restored, nil
+}
+
+func (v *FlagVersion) ToProto() *ffpb.FlagVersion {
+	return &ffpb.FlagVersion{
+		Version:   v.Version,
+		Author:    v.Author,
+		CreatedAt: v.CreatedAt.Format(time.RFC3339),
+		Flag:      v.Flag.ToProto(),
+	}
+}
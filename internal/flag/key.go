@@ -0,0 +1,85 @@
+package flag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/julianstephens/feature-flag-service/internal/storage"
+)
+
+var ErrFlagKeyExists = errors.New("flag key already exists")
+
+// flagKeyPattern allows keys such as checkout.new-payment-flow.
+var flagKeyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+var slugSeparators = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+const maxFlagKeyLength = 128
+
+// validateKey checks a flag key. Keys never parse as IDs, so a reference to
+// a flag is unambiguous.
+func validateKey(key string) error {
+	if len(key) > maxFlagKeyLength || !flagKeyPattern.MatchString(key) {
+		return fmt.Errorf("%w: key %q must be at most %d letters, digits, '.', '_' or '-', starting with a letter or digit", ErrInvalidFlag, key, maxFlagKeyLength)
+	}
+	if isID(key) {
+		return fmt.Errorf("%w: key %q must not look like a flag ID", ErrInvalidFlag, key)
+	}
+	return nil
+}
+
+// keyFromName derives the key of a flag created without one, e.g.
+// "New Checkout Flow" becomes new-checkout-flow.
+func keyFromName(name string) string {
+	return strings.Trim(slugSeparators.ReplaceAllString(strings.ToLower(name), "-"), "-._")
+}
+
+func isID(ref string) bool {
+	_, err := uuid.Parse(ref)
+	return err == nil
+}
+
+// keyIndexKey returns the index entry holding the ID of the flag with a key.
+// The index lies outside the flag prefix, so flag listings and watches never
+// see it.
+func (s *FlagService) keyIndexKey(project, key string) string {
+	return s.keyIndexPrefix + s.projectKey(project) + "/" + key
+}
+
+// resolveID returns the ID of the flag a reference names: the reference
+// itself when it is an ID, else the ID indexed under the key.
+func (s *FlagService) resolveID(ctx context.Context, project, ref string) (string, error) {
+	if ref == "" || isID(ref) {
+		return ref, nil
+	}
+	resp, err := s.store.Get(ctx, s.keyIndexKey(project, ref))
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		return "", fmt.Errorf("%w: %s", ErrFlagNotFound, ref)
+	}
+	if err != nil {
+		return "", err
+	}
+	return resp.Value, nil
+}
+
+// lookup finds the flag a reference names, by ID or key, among flags keyed
+// by ID.
+func lookup(flags map[string]*Flag, ref string) (*Flag, bool) {
+	if flag, ok := flags[ref]; ok {
+		return flag, true
+	}
+	if isID(ref) {
+		return nil, false
+	}
+	for _, flag := range flags {
+		if flag.Key == ref {
+			return flag, true
+		}
+	}
+	return nil, false
+}
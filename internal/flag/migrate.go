@@ -0,0 +1,98 @@
+package flag
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/julianstephens/feature-flag-service/internal/project"
+	"github.com/julianstephens/feature-flag-service/internal/storage"
+)
+
+// legacyFlag is a flag as stored before projects existed, directly under the
+// flag prefix with its state alongside its definition.
+type legacyFlag struct {
+	Flag
+	FlagEnvironment
+}
+
+// UnmarshalJSON decodes the definition and the state separately. Without it
+// the UnmarshalJSON of FlagEnvironment would be promoted and fill in only the
+// state.
+func (f *legacyFlag) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &f.Flag); err != nil {
+		return err
+	}
+	// Legacy state never left its variations unset; decode it as stored.
+	type plain FlagEnvironment
+	return json.Unmarshal(data, (*plain)(&f.FlagEnvironment))
+}
+
+// MigrateLegacyFlags moves flags stored before projects existed into the
+// default environment of the default project, creating either if needed. It
+// returns the number of flags moved and is a no-op once none are left.
+func (s *FlagService) MigrateLegacyFlags(ctx context.Context) (int, error) {
+	list, err := s.store.List(ctx, s.prefix, storage.ListOptions{})
+	if err != nil {
+		return 0, err
+	}
+	res := list.Values()
+	var legacy []string
+	for _, key := range sortedKeys(res) {
+		if !strings.Contains(strings.TrimPrefix(key, s.prefix), "/") {
+			legacy = append(legacy, key)
+		}
+	}
+	if len(legacy) == 0 {
+		return 0, nil
+	}
+
+	projectKey, env := s.projectKey(""), s.envKey("")
+	proj, err := s.projects.EnsureProject(ctx, projectKey)
+	if err != nil {
+		return 0, err
+	}
+	if !proj.HasEnvironment(env) {
+		if _, err := s.projects.CreateEnvironment(ctx, projectKey, &project.Environment{Key: env, Name: env}); err != nil {
+			return 0, err
+		}
+		if proj, err = s.projects.GetProject(ctx, projectKey); err != nil {
+			return 0, err
+		}
+	}
+	projectCmps, projectOps := s.projects.FlagGuard(proj, true)
+
+	migrated := 0
+	for _, key := range legacy {
+		var old legacyFlag
+		if err := json.Unmarshal([]byte(res[key]), &old); err != nil {
+			return migrated, err
+		}
+		flag := old.Flag
+		state := old.FlagEnvironment
+		if len(flag.Variations) == 0 {
+			flag.Type = VariationBoolean
+			flag.Variations = defaultVariations()
+			state.OnVariation = 0
+			state.OffVariation = 1
+		}
+		flag.Project = projectKey
+		flag.Environments = map[string]*FlagEnvironment{env: &state}
+
+		data, err := json.Marshal(&flag)
+		if err != nil {
+			return migrated, err
+		}
+		newKey := s.GetKey(projectKey, flag.ID)
+		cmps := append([]storage.Cmp{storage.Absent(newKey)}, projectCmps...)
+		ops := append([]storage.Op{storage.Put(newKey, string(data)), storage.Delete(key)}, projectOps...)
+		resp, err := s.store.Txn(ctx, cmps, ops...)
+		if err != nil {
+			return migrated, err
+		}
+		if resp.Succeeded {
+			migrated++
+		}
+	}
+	return migrated, nil
+}
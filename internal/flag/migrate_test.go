@@ -0,0 +1,53 @@
+package flag
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMigrateLegacyFlags(t *testing.T) {
+	ctx := context.Background()
+	s, store := newTestService(t)
+
+	// A flag as the service stored it before projects existed.
+	const id = "7c9e6679-7425-40de-944b-e07fc1f90ae7"
+	legacy := `{"id":"` + id + `","name":"Dark Mode","description":"New theme","enabled":true,` +
+		`"createdAt":"2024-01-02T03:04:05Z","updatedAt":"2024-01-02T03:04:05Z"}`
+	if _, err := store.Put(ctx, s.prefix+id, legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := s.MigrateLegacyFlags(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("MigrateLegacyFlags moved %d flags; want 1", n)
+	}
+	if _, err := store.Get(ctx, s.prefix+id); err == nil {
+		t.Error("legacy record left in place")
+	}
+
+	f, err := s.GetFlag(ctx, "", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Name != "Dark Mode" || f.Description != "New theme" || f.Project != "default" || f.Type != VariationBoolean {
+		t.Errorf("migrated flag = %+v; want the legacy definition as a boolean flag in project default", f)
+	}
+	state := f.Environment("production")
+	if !state.Enabled || state.OnVariation != 0 || state.OffVariation != 1 {
+		t.Errorf("migrated state = %+v; want enabled, serving variation 0 when on and 1 when off", state)
+	}
+	eval, err := s.EvaluateFlag(ctx, "", "", id, &EvaluationContext{Key: "user-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(eval.Value) != "true" {
+		t.Errorf("migrated flag evaluates to %s; want true", eval.Value)
+	}
+
+	if n, err := s.MigrateLegacyFlags(ctx); err != nil || n != 0 {
+		t.Errorf("second MigrateLegacyFlags = %d, %v; want 0, nil", n, err)
+	}
+}
@@ -0,0 +1,311 @@
+package flag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+
+	ffpb "github.com/julianstephens/feature-flag-service/gen/go/grpc/v1/featureflag.v1"
+	"github.com/julianstephens/feature-flag-service/internal/storage"
+)
+
+var ErrFlagHasDependents = errors.New("flag is a prerequisite of other flags")
+
+// Prerequisite requires another flag to be on and serving Variation to the
+// same context before the dependent flag's own targeting is considered.
+type Prerequisite struct {
+	FlagID    string `json:"flagId"`
+	Variation int    `json:"variation"`
+}
+
+func (p Prerequisite) met(e *evaluator) bool {
+	eval := e.evaluate(p.FlagID)
+	switch eval.Reason {
+	case ReasonOff, ReasonPrerequisiteFailed, ReasonError:
+		return false
+	}
+	return eval.Variation == p.Variation
+}
+
+// DependencyGraph describes how a flag relates to others in one environment
+// through prerequisites. Affected lists every flag that stops serving its
+// targeted variations when this flag is turned off, directly or through
+// other flags.
+type DependencyGraph struct {
+	FlagID        string         `json:"flagId"`
+	Environment   string         `json:"environment"`
+	Prerequisites []Prerequisite `json:"prerequisites"`
+	Dependents    []string       `json:"dependents"`
+	Affected      []string       `json:"affected"`
+}
+
+// GetFlagDependencies returns the prerequisite graph around a flag in env.
+func (s *FlagService) GetFlagDependencies(ctx context.Context, project, env, ref string) (*DependencyGraph, error) {
+	env = s.envKey(env)
+	if _, err := s.projects.GetEnvironment(ctx, s.projectKey(project), env); err != nil {
+		return nil, err
+	}
+	flags, err := s.projectFlags(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	flag, ok := lookup(flags, ref)
+	if !ok {
+		return nil, ErrFlagNotFound
+	}
+	id := flag.ID
+
+	dependents := dependentsOf(flags, env)
+	graph := &DependencyGraph{
+		FlagID:        id,
+		Environment:   env,
+		Prerequisites: flag.Environment(env).Prerequisites,
+		Dependents:    dependents[id],
+	}
+
+	seen := map[string]bool{id: true}
+	queue := []string{id}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		for _, dep := range dependents[next] {
+			if !seen[dep] {
+				seen[dep] = true
+				graph.Affected = append(graph.Affected, dep)
+				queue = append(queue, dep)
+			}
+		}
+	}
+	sort.Strings(graph.Affected)
+	return graph, nil
+}
+
+// writeGuard serializes writes that are each valid alone but can break an
+// invariant together. Each reads the guard before the state it checks and
+// replaces it in its own transaction, so it fails with ErrFlagConflict when
+// another such write committed in between.
+type writeGuard struct {
+	key      string
+	revision int64
+	// what names what the guard protects, for conflict errors.
+	what string
+}
+
+// readGuard returns the guard kept at key.
+func readGuard(ctx context.Context, store storage.Store, key, what string) (*writeGuard, error) {
+	guard := &writeGuard{key: key, what: what}
+	resp, err := store.Get(ctx, key)
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		return guard, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	guard.revision = resp.ModRevision
+	return guard, nil
+}
+
+// readPrerequisiteGuard returns the guard of the writes that can break the
+// prerequisite graph of a project: writes of flags with prerequisites, which
+// must not point at a deleted flag or close a cycle, and deletes, which must
+// not remove a flag another one depends on. It is kept next to the key
+// index; flag keys cannot start with '.', so it never clashes.
+func (s *FlagService) readPrerequisiteGuard(ctx context.Context, project string) (*writeGuard, error) {
+	key := s.keyIndexPrefix + s.projectKey(project) + "/.prerequisites"
+	return readGuard(ctx, s.store, key, "prerequisites in project "+s.projectKey(project))
+}
+
+// claim adds the guards to a transaction writing flag id.
+func claim(guards []*writeGuard, id string, cmps []storage.Cmp, ops []storage.Op) ([]storage.Cmp, []storage.Op) {
+	for _, g := range guards {
+		cmps = append(cmps, storage.AtRevision(g.key, g.revision))
+		ops = append(ops, storage.Put(g.key, id))
+	}
+	return cmps, ops
+}
+
+// changed returns the first of the guards another write has claimed since it
+// was read, or nil.
+func changed(ctx context.Context, store storage.Store, guards []*writeGuard) *writeGuard {
+	for _, g := range guards {
+		resp, err := store.Get(ctx, g.key)
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			if g.revision != 0 {
+				return g
+			}
+			continue
+		}
+		if err == nil && resp.ModRevision != g.revision {
+			return g
+		}
+	}
+	return nil
+}
+
+// checkPrerequisites verifies that in every environment each prerequisite of
+// flag exists in the same project, names one of its variations and does not
+// lead back to flag. Prerequisites given by key are stored by ID. Flags with
+// prerequisites get the guard their write must claim.
+func (s *FlagService) checkPrerequisites(ctx context.Context, flag *Flag) (*writeGuard, error) {
+	if len(flag.prerequisites("")) == 0 {
+		return nil, nil
+	}
+	guard, err := s.readPrerequisiteGuard(ctx, flag.Project)
+	if err != nil {
+		return nil, err
+	}
+	flags, err := s.projectFlags(ctx, flag.Project)
+	if err != nil {
+		return nil, err
+	}
+	flags[flag.ID] = flag
+
+	for _, env := range environmentKeys(flag.Environments) {
+		seen := make(map[string]bool)
+		prerequisites := flag.Environments[env].Prerequisites
+		for i, p := range prerequisites {
+			parent, ok := lookup(flags, p.FlagID)
+			if !ok {
+				return nil, fmt.Errorf("%w: environment %s: prerequisite %d: flag %s does not exist", ErrInvalidFlag, env, i, p.FlagID)
+			}
+			prerequisites[i].FlagID = parent.ID
+
+			if seen[parent.ID] {
+				return nil, fmt.Errorf("%w: environment %s: prerequisite %s listed twice", ErrInvalidFlag, env, p.FlagID)
+			}
+			seen[parent.ID] = true
+
+			if p.Variation < 0 || p.Variation >= len(parent.Variations) {
+				return nil, fmt.Errorf("%w: environment %s: prerequisite %d: variation %d out of range for flag %s", ErrInvalidFlag, env, i, p.Variation, p.FlagID)
+			}
+		}
+
+		if path := findCycle(flags, env, flag.ID); path != nil {
+			return nil, fmt.Errorf("%w: environment %s: prerequisite cycle %s", ErrInvalidFlag, env, strings.Join(path, " -> "))
+		}
+	}
+	return guard, nil
+}
+
+// findCycle returns a path of prerequisites in env from start back to
+// itself, or nil if there is none.
+func findCycle(flags map[string]*Flag, env, start string) []string {
+	visited := make(map[string]bool)
+	var path []string
+	var visit func(id string) bool
+	visit = func(id string) bool {
+		path = append(path, id)
+		if id == start && len(path) > 1 {
+			return true
+		}
+		if visited[id] {
+			path = path[:len(path)-1]
+			return false
+		}
+		visited[id] = true
+		if f, ok := flags[id]; ok {
+			for _, p := range f.prerequisites(env) {
+				if visit(p.FlagID) {
+					return true
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+	if visit(start) {
+		return path
+	}
+	return nil
+}
+
+// prerequisites returns the flag's prerequisites in env, or in every
+// environment when env is empty.
+func (f *Flag) prerequisites(env string) []Prerequisite {
+	if env != "" {
+		if state, ok := f.Environments[env]; ok {
+			return state.Prerequisites
+		}
+		return nil
+	}
+	var prerequisites []Prerequisite
+	for _, state := range f.Environments {
+		prerequisites = append(prerequisites, state.Prerequisites...)
+	}
+	return prerequisites
+}
+
+// dependentsOf maps each flag ID to the flags listing it as a prerequisite
+// in env, or in any environment when env is empty.
+func dependentsOf(flags map[string]*Flag, env string) map[string][]string {
+	dependents := make(map[string][]string)
+	for _, f := range flags {
+		for _, p := range f.prerequisites(env) {
+			if !slices.Contains(dependents[p.FlagID], f.ID) {
+				dependents[p.FlagID] = append(dependents[p.FlagID], f.ID)
+			}
+		}
+	}
+	for _, ids := range dependents {
+		sort.Strings(ids)
+	}
+	return dependents
+}
+
+// projectFlags returns every flag of a project keyed by ID.
+func (s *FlagService) projectFlags(ctx context.Context, project string) (map[string]*Flag, error) {
+	res, err := s.store.List(ctx, s.projectPrefix(project), storage.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	flags := make(map[string]*Flag, len(res.KVs))
+	for _, kv := range res.KVs {
+		flag, err := parseKeyValue(kv)
+		if err != nil {
+			log.Printf("error unmarshaling flag: %v", err)
+			continue
+		}
+		flags[flag.ID] = flag
+	}
+	return flags, nil
+}
+
+func (p Prerequisite) ToProto() *ffpb.Prerequisite {
+	return &ffpb.Prerequisite{
+		FlagId:    p.FlagID,
+		Variation: int32(p.Variation),
+	}
+}
+
+func prerequisitesToProto(prerequisites []Prerequisite) []*ffpb.Prerequisite {
+	var protoPrerequisites []*ffpb.Prerequisite
+	for _, p := range prerequisites {
+		protoPrerequisites = append(protoPrerequisites, p.ToProto())
+	}
+	return protoPrerequisites
+}
+
+func PrerequisitesFromProto(protoPrerequisites []*ffpb.Prerequisite) []Prerequisite {
+	var prerequisites []Prerequisite
+	for _, p := range protoPrerequisites {
+		prerequisites = append(prerequisites, Prerequisite{
+			FlagID:    p.FlagId,
+			Variation: int(p.Variation),
+		})
+	}
+	return prerequisites
+}
+
+func (g *DependencyGraph) ToProto() *ffpb.FlagDependencies {
+	return &ffpb.FlagDependencies{
+		FlagId:        g.FlagID,
+		Environment:   g.Environment,
+		Prerequisites: prerequisitesToProto(g.Prerequisites),
+		Dependents:    g.Dependents,
+		Affected:      g.Affected,
+	}
+}
@@ -0,0 +1,196 @@
+package flag
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// requires returns an enabled state serving variation 0 that needs each of
+// the flags to serve variation 0 first.
+func requires(ids ...string) *FlagEnvironment {
+	state := &FlagEnvironment{Enabled: true, OffVariation: 1}
+	for _, id := range ids {
+		state.Prerequisites = append(state.Prerequisites, Prerequisite{FlagID: id})
+	}
+	return state
+}
+
+// createFlags creates a boolean flag for each name and returns their IDs.
+func createFlags(t *testing.T, s *FlagService, names ...string) []string {
+	t.Helper()
+	ids := make([]string, len(names))
+	for i, name := range names {
+		f, err := s.CreateFlag(context.Background(), "", &Flag{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = f.ID
+	}
+	return ids
+}
+
+func TestPrerequisiteSelfCycle(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t)
+	ids := createFlags(t, s, "a")
+
+	_, err := s.UpdateFlagEnvironment(ctx, "", "", ids[0], requires(ids[0]))
+	if !errors.Is(err, ErrInvalidFlag) || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("flag requiring itself: err = %v; want a prerequisite cycle", err)
+	}
+}
+
+func TestPrerequisiteIndirectCycle(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t)
+	ids := createFlags(t, s, "a", "b", "c")
+	a, b, c := ids[0], ids[1], ids[2]
+
+	// c requires b, b requires a.
+	if _, err := s.UpdateFlagEnvironment(ctx, "", "", b, requires(a)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.UpdateFlagEnvironment(ctx, "", "", c, requires(b)); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := s.UpdateFlagEnvironment(ctx, "", "", a, requires(c))
+	if !errors.Is(err, ErrInvalidFlag) {
+		t.Fatalf("closing a -> c -> b -> a: err = %v; want ErrInvalidFlag", err)
+	}
+	if want := strings.Join([]string{a, c, b, a}, " -> "); !strings.Contains(err.Error(), want) {
+		t.Errorf("err = %v; want the cycle %s", err, want)
+	}
+
+	// Prerequisites are per environment, so the same edge elsewhere is fine.
+	if _, err := s.UpdateFlagEnvironment(ctx, "", "staging", a, requires(c)); err != nil {
+		t.Errorf("a requiring c in staging only: %v", err)
+	}
+}
+
+func TestPrerequisiteMissingFlag(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t)
+	ids := createFlags(t, s, "a")
+
+	if _, err := s.UpdateFlagEnvironment(ctx, "", "", ids[0], requires("no-such-flag")); !errors.Is(err, ErrInvalidFlag) {
+		t.Errorf("prerequisite on a missing flag: err = %v; want ErrInvalidFlag", err)
+	}
+	state := requires(ids[0])
+	state.Prerequisites[0].Variation = 2
+	other := createFlags(t, s, "b")
+	if _, err := s.UpdateFlagEnvironment(ctx, "", "", other[0], state); !errors.Is(err, ErrInvalidFlag) {
+		t.Errorf("prerequisite on a variation the flag lacks: err = %v; want ErrInvalidFlag", err)
+	}
+}
+
+func TestPrerequisiteStoredByID(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t)
+	ids := createFlags(t, s, "parent", "child")
+
+	got, err := s.UpdateFlagEnvironment(ctx, "", "", ids[1], requires("parent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := got.Environment("production").Prerequisites; len(p) != 1 || p[0].FlagID != ids[0] {
+		t.Errorf("prerequisites = %+v; want the parent by ID", p)
+	}
+	if err := s.DeleteFlag(ctx, "", ids[0], 0); !errors.Is(err, ErrFlagHasDependents) {
+		t.Errorf("deleting a prerequisite: err = %v; want ErrFlagHasDependents", err)
+	}
+}
+
+func TestFlagDependencies(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t)
+	ids := createFlags(t, s, "a", "b", "c", "d", "e")
+	a, b, c, d, e := ids[0], ids[1], ids[2], ids[3], ids[4]
+
+	// b and c require a, d requires b and e; in staging only e requires a.
+	for _, w := range []struct {
+		env, id string
+		needs   []string
+	}{
+		{"", b, []string{a}},
+		{"", c, []string{a}},
+		{"", d, []string{b, e}},
+		{"staging", e, []string{a}},
+	} {
+		if _, err := s.UpdateFlagEnvironment(ctx, "", w.env, w.id, requires(w.needs...)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	graph, err := s.GetFlagDependencies(ctx, "", "", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if graph.FlagID != a || graph.Environment != "production" || len(graph.Prerequisites) != 0 {
+		t.Errorf("graph of a = %+v; want a in production without prerequisites", graph)
+	}
+	if want := sorted(b, c); !slices.Equal(graph.Dependents, want) {
+		t.Errorf("dependents of a = %v; want %v", graph.Dependents, want)
+	}
+	if want := sorted(b, c, d); !slices.Equal(graph.Affected, want) {
+		t.Errorf("affected by a = %v; want %v", graph.Affected, want)
+	}
+
+	graph, err = s.GetFlagDependencies(ctx, "", "", d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(graph.Prerequisites) != 2 || graph.Prerequisites[0].FlagID != b || graph.Prerequisites[1].FlagID != e {
+		t.Errorf("prerequisites of d = %+v; want b and e", graph.Prerequisites)
+	}
+	if len(graph.Dependents) != 0 || len(graph.Affected) != 0 {
+		t.Errorf("graph of d = %+v; want no dependents", graph)
+	}
+
+	graph, err = s.GetFlagDependencies(ctx, "", "staging", a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(graph.Dependents, []string{e}) || !slices.Equal(graph.Affected, []string{e}) {
+		t.Errorf("staging graph of a = %+v; want only e", graph)
+	}
+
+	if _, err := s.GetFlagDependencies(ctx, "", "", "missing"); !errors.Is(err, ErrFlagNotFound) {
+		t.Errorf("GetFlagDependencies of a missing flag: err = %v; want ErrFlagNotFound", err)
+	}
+}
+
+func TestPrerequisiteEvaluation(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t)
+	ids := createFlags(t, s, "parent", "child")
+	if _, err := s.UpdateFlagEnvironment(ctx, "", "", ids[1], requires(ids[0])); err != nil {
+		t.Fatal(err)
+	}
+
+	eval, err := s.EvaluateFlag(ctx, "", "", "child", &EvaluationContext{Key: "user-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eval.Reason != ReasonPrerequisiteFailed || string(eval.Value) != "false" {
+		t.Errorf("child of an off parent = %s (%s); want false for a failed prerequisite", eval.Value, eval.Reason)
+	}
+
+	if _, err := s.UpdateFlagEnvironment(ctx, "", "", ids[0], requires()); err != nil {
+		t.Fatal(err)
+	}
+	eval, err = s.EvaluateFlag(ctx, "", "", "child", &EvaluationContext{Key: "user-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eval.Reason == ReasonPrerequisiteFailed || string(eval.Value) != "true" {
+		t.Errorf("child of an on parent = %s (%s); want true", eval.Value, eval.Reason)
+	}
+}
+
+func sorted(ids ...string) []string {
+	return slices.Sorted(slices.Values(ids))
+}
@@ -0,0 +1,116 @@
+package flag
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	ffpb "github.com/julianstephens/feature-flag-service/gen/go/grpc/v1/featureflag.v1"
+)
+
+// rolloutScale is the total weight of a rollout: weights are expressed in
+// thousandths of a percent.
+const rolloutScale = 100000
+
+// Rollout splits contexts between variations by weight. Contexts are bucketed
+// by hashing the flag ID, the flag's salt and the BucketBy attribute, so the
+// same context lands in the same bucket as long as the salt is unchanged.
+// Buckets are handed to the variations in order, each taking a range as wide
+// as its weight, so growing the first variation's weight only moves contexts
+// into it. Resizing any other variation shifts the ranges after it and can
+// move contexts between the later variations.
+type Rollout struct {
+	Variations []WeightedVariation `json:"variations"`
+	BucketBy   string              `json:"bucketBy,omitempty"`
+}
+
+type WeightedVariation struct {
+	Variation int `json:"variation"`
+	Weight    int `json:"weight"`
+}
+
+// bucket returns the context's position in [0, rolloutScale) for this flag.
+// Contexts missing the bucketing attribute all land in bucket 0.
+func (f *Flag) bucket(ectx *EvaluationContext, bucketBy string) int {
+	if bucketBy == "" {
+		bucketBy = "key"
+	}
+	v, ok := ectx.Value(bucketBy)
+	if !ok {
+		return 0
+	}
+	s, ok := attributeString(v)
+	if !ok {
+		return 0
+	}
+
+	sum := sha1.Sum([]byte(f.ID + "." + f.Salt + "." + s))
+	n, err := strconv.ParseUint(hex.EncodeToString(sum[:])[:15], 16, 64)
+	if err != nil {
+		return 0
+	}
+	return int(n % rolloutScale)
+}
+
+// resolve picks the variation whose cumulative weight covers the bucket.
+func (r *Rollout) resolve(bucket int) int {
+	total := 0
+	for _, wv := range r.Variations {
+		total += wv.Weight
+		if bucket < total {
+			return wv.Variation
+		}
+	}
+	// Weights always add up to rolloutScale once validated; fall back to the
+	// last variation in case of rounding in older data.
+	return r.Variations[len(r.Variations)-1].Variation
+}
+
+func (r *Rollout) validate(variations int) error {
+	if len(r.Variations) == 0 {
+		return fmt.Errorf("%w: rollout needs at least one variation", ErrInvalidFlag)
+	}
+	total := 0
+	for _, wv := range r.Variations {
+		if wv.Variation < 0 || wv.Variation >= variations {
+			return fmt.Errorf("%w: rollout variation %d out of range", ErrInvalidFlag, wv.Variation)
+		}
+		if wv.Weight < 0 {
+			return fmt.Errorf("%w: rollout weight for variation %d is negative", ErrInvalidFlag, wv.Variation)
+		}
+		total += wv.Weight
+	}
+	if total != rolloutScale {
+		return fmt.Errorf("%w: rollout weights add up to %d, want %d", ErrInvalidFlag, total, rolloutScale)
+	}
+	return nil
+}
+
+func (r *Rollout) ToProto() *ffpb.Rollout {
+	if r == nil {
+		return nil
+	}
+	rollout := &ffpb.Rollout{BucketBy: r.BucketBy}
+	for _, wv := range r.Variations {
+		rollout.Variations = append(rollout.Variations, &ffpb.WeightedVariation{
+			Variation: int32(wv.Variation),
+			Weight:    int32(wv.Weight),
+		})
+	}
+	return rollout
+}
+
+func RolloutFromProto(protoRollout *ffpb.Rollout) *Rollout {
+	if protoRollout == nil {
+		return nil
+	}
+	rollout := &Rollout{BucketBy: protoRollout.BucketBy}
+	for _, wv := range protoRollout.Variations {
+		rollout.Variations = append(rollout.Variations, WeightedVariation{
+			Variation: int(wv.Variation),
+			Weight:    int(wv.Weight),
+		})
+	}
+	return rollout
+}
@@ -0,0 +1,166 @@
+package flag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestBucketPinned(t *testing.T) {
+	// Changing these moves every user of every rollout to a new bucket.
+	f := &Flag{ID: "7c9e6679-7425-40de-944b-e07fc1f90ae7", Salt: "3f2b"}
+	tests := []struct {
+		key  string
+		want int
+	}{
+		{"user-1", 21846},
+		{"user-2", 83732},
+		{"user-3", 9626},
+		{"ada@example.com", 86314},
+	}
+	for _, tt := range tests {
+		if got := f.bucket(&EvaluationContext{Key: tt.key}, ""); got != tt.want {
+			t.Errorf("bucket(%s) = %d; want %d", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestBucketDeterministic(t *testing.T) {
+	f := &Flag{ID: "7c9e6679-7425-40de-944b-e07fc1f90ae7", Salt: "3f2b"}
+	same := &Flag{ID: f.ID, Salt: f.Salt, Name: "renamed", Version: 7}
+	for i := range 100 {
+		ectx := &EvaluationContext{Key: fmt.Sprintf("user-%d", i)}
+		b := f.bucket(ectx, "")
+		if b < 0 || b >= rolloutScale {
+			t.Fatalf("bucket(%s) = %d; want within [0, %d)", ectx.Key, b, rolloutScale)
+		}
+		if again := f.bucket(ectx, ""); again != b {
+			t.Fatalf("bucket(%s) = %d, then %d", ectx.Key, b, again)
+		}
+		if other := same.bucket(ectx, ""); other != b {
+			t.Fatalf("bucket(%s) = %d after editing the flag; want %d", ectx.Key, other, b)
+		}
+	}
+
+	byOrg := &EvaluationContext{Key: "user-1", Attributes: map[string]any{"org": "acme"}}
+	colleague := &EvaluationContext{Key: "user-2", Attributes: map[string]any{"org": "acme"}}
+	if f.bucket(byOrg, "org") != f.bucket(colleague, "org") {
+		t.Error("contexts of the same org bucketed by org landed in different buckets")
+	}
+	if got := f.bucket(&EvaluationContext{Key: "user-1"}, "org"); got != 0 {
+		t.Errorf("bucket without the bucketBy attribute = %d; want 0", got)
+	}
+}
+
+func TestRolloutWeights(t *testing.T) {
+	r := &Rollout{Variations: []WeightedVariation{
+		{Variation: 0, Weight: 20000},
+		{Variation: 1, Weight: 30000},
+		{Variation: 2, Weight: 50000},
+	}}
+	if err := r.validate(3); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct{ bucket, want int }{
+		{0, 0}, {19999, 0}, {20000, 1}, {49999, 1}, {50000, 2}, {rolloutScale - 1, 2},
+	} {
+		if got := r.resolve(tt.bucket); got != tt.want {
+			t.Errorf("resolve(%d) = %d; want %d", tt.bucket, got, tt.want)
+		}
+	}
+
+	// Over many users each variation's share follows its weight.
+	f := &Flag{ID: "7c9e6679-7425-40de-944b-e07fc1f90ae7", Salt: "3f2b"}
+	const users = 20000
+	counts := make([]int, 3)
+	for i := range users {
+		counts[r.resolve(f.bucket(&EvaluationContext{Key: fmt.Sprintf("user-%d", i)}, ""))]++
+	}
+	for i, wv := range r.Variations {
+		want := users * wv.Weight / rolloutScale
+		if diff := counts[i] - want; diff < -users/50 || diff > users/50 {
+			t.Errorf("variation %d served %d of %d users; want about %d", i, counts[i], users, want)
+		}
+	}
+}
+
+func TestRolloutValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rollout Rollout
+		valid   bool
+	}{
+		{"all to one", Rollout{Variations: []WeightedVariation{{Variation: 1, Weight: rolloutScale}}}, true},
+		{"split", Rollout{Variations: []WeightedVariation{{Variation: 0, Weight: 33333}, {Variation: 1, Weight: 66667}}}, true},
+		{"zero weight", Rollout{Variations: []WeightedVariation{{Variation: 0, Weight: 0}, {Variation: 1, Weight: rolloutScale}}}, true},
+		{"empty", Rollout{}, false},
+		{"short of the scale", Rollout{Variations: []WeightedVariation{{Variation: 0, Weight: 50000}, {Variation: 1, Weight: 49999}}}, false},
+		{"over the scale", Rollout{Variations: []WeightedVariation{{Variation: 0, Weight: 50000}, {Variation: 1, Weight: 50001}}}, false},
+		{"negative weight", Rollout{Variations: []WeightedVariation{{Variation: 0, Weight: -1}, {Variation: 1, Weight: rolloutScale + 1}}}, false},
+		{"unknown variation", Rollout{Variations: []WeightedVariation{{Variation: 2, Weight: rolloutScale}}}, false},
+	}
+	for _, tt := range tests {
+		err := tt.rollout.validate(2)
+		if tt.valid && err != nil {
+			t.Errorf("%s: validate = %v; want nil", tt.name, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidFlag) {
+			t.Errorf("%s: validate = %v; want ErrInvalidFlag", tt.name, err)
+		}
+	}
+}
+
+func TestResetFlagSaltReshuffles(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t)
+
+	f, err := s.CreateFlag(ctx, "", &Flag{Name: "split"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := &FlagEnvironment{
+		Enabled:      true,
+		OffVariation: 1,
+		Rollout:      &Rollout{Variations: []WeightedVariation{{Variation: 0, Weight: 50000}, {Variation: 1, Weight: 50000}}},
+	}
+	if _, err := s.UpdateFlagEnvironment(ctx, "", "", f.ID, state); err != nil {
+		t.Fatal(err)
+	}
+
+	const users = 200
+	serve := func() []string {
+		values := make([]string, users)
+		for i := range values {
+			eval, err := s.EvaluateFlag(ctx, "", "", f.Key, &EvaluationContext{Key: fmt.Sprintf("user-%d", i)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			values[i] = string(eval.Value)
+		}
+		return values
+	}
+	before := serve()
+	if again := serve(); fmt.Sprint(again) != fmt.Sprint(before) {
+		t.Fatal("users moved between variations without a salt reset")
+	}
+
+	reset, err := s.ResetFlagSalt(ctx, "", f.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reset.Salt == f.Salt {
+		t.Fatalf("salt %q unchanged by ResetFlagSalt", reset.Salt)
+	}
+	after := serve()
+	moved := 0
+	for i := range before {
+		if before[i] != after[i] {
+			moved++
+		}
+	}
+	// Half of the users should change sides of a 50/50 split.
+	if moved < users/4 || moved > users*3/4 {
+		t.Errorf("salt reset moved %d of %d users; want about half", moved, users)
+	}
+}
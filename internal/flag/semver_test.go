@@ -0,0 +1,81 @@
+package flag
+
+import "testing"
+
+func TestParseSemVer(t *testing.T) {
+	tests := []struct {
+		in    string
+		want  semVer
+		valid bool
+	}{
+		{"1.2.3", semVer{major: 1, minor: 2, patch: 3}, true},
+		{"v1.2", semVer{major: 1, minor: 2}, true},
+		{"7", semVer{major: 7}, true},
+		{" 1.0.0 ", semVer{major: 1}, true},
+		{"1.0.0-rc.1", semVer{major: 1, pre: []string{"rc", "1"}}, true},
+		{"1.0.0+build.5", semVer{major: 1}, true},
+		{"1.0.0-beta+build.5", semVer{major: 1, pre: []string{"beta"}}, true},
+
+		{"", semVer{}, false},
+		{"v", semVer{}, false},
+		{"1.2.3.4", semVer{}, false},
+		{"1..3", semVer{}, false},
+		{"1.2.x", semVer{}, false},
+		{"-1.0.0", semVer{}, false},
+		{"1.-2.0", semVer{}, false},
+		{"latest", semVer{}, false},
+	}
+	for _, tt := range tests {
+		got, err := parseSemVer(tt.in)
+		if !tt.valid {
+			if err == nil {
+				t.Errorf("parseSemVer(%q) = %+v; want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseSemVer(%q): %v", tt.in, err)
+			continue
+		}
+		if got.compare(tt.want) != 0 || len(got.pre) != len(tt.want.pre) {
+			t.Errorf("parseSemVer(%q) = %+v; want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSemVerCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"1.2", "1.2.0", 0},
+		{"v1.2.3", "1.2.3+build", 0},
+		{"1.2.3", "1.2.4", -1},
+		{"1.10.0", "1.9.0", 1},
+		{"2.0.0", "10.0.0", -1},
+		{"1.0.0-alpha", "1.0.0", -1},
+		{"1.0.0", "1.0.0-rc.1", 1},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"1.0.0-beta.2", "1.0.0-beta.11", -1},
+		{"1.0.0-beta", "1.0.0-alpha", 1},
+		{"1.0.0-rc.1", "1.0.0-rc.1", 0},
+	}
+	for _, tt := range tests {
+		a, err := parseSemVer(tt.a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := parseSemVer(tt.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := a.compare(b); got != tt.want {
+			t.Errorf("compare(%s, %s) = %d; want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := b.compare(a); got != -tt.want {
+			t.Errorf("compare(%s, %s) = %d; want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
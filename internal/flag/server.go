@@ -2,8 +2,16 @@ package flag
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	ffpb "github.com/julianstephens/feature-flag-service/gen/go/grpc/v1/featureflag.v1"
+	"github.com/julianstephens/feature-flag-service/internal/auth"
+	"github.com/julianstephens/feature-flag-service/internal/project"
+	"github.com/julianstephens/feature-flag-service/internal/schema"
 )
 
 type FlagGRPCServer struct {
@@ -12,9 +20,9 @@ type FlagGRPCServer struct {
 }
 
 func (s *FlagGRPCServer) ListFlags(ctx context.Context, req *ffpb.ListFlagsRequest) (*ffpb.ListFlagsResponse, error) {
-	flags, err := s.Service.ListFlags(ctx)
+	flags, err := s.Service.ListFlags(ctx, req.Project)
 	if err != nil {
-		return nil, err
+		return nil, grpcError(err)
 	}
 	var protoFlags []*ffpb.Flag
 	for _, f := range flags {
@@ -24,33 +32,178 @@ func (s *FlagGRPCServer) ListFlags(ctx context.Context, req *ffpb.ListFlagsReque
 }
 
 func (s *FlagGRPCServer) GetFlag(ctx context.Context, req *ffpb.GetFlagRequest) (*ffpb.Flag, error) {
-	flag, err := s.Service.GetFlag(ctx, req.Id)
+	flag, err := s.Service.GetFlag(ctx, req.Project, req.Id)
 	if err != nil {
-		return nil, err
+		return nil, grpcError(err)
 	}
 	return flag.ToProto(), nil
 }
 
 func (s *FlagGRPCServer) CreateFlag(ctx context.Context, req *ffpb.CreateFlagRequest) (*ffpb.Flag, error) {
-	flag, err := s.Service.CreateFlag(ctx, req.Name, req.Description, req.Enabled)
+	flag, err := s.Service.CreateFlag(ctx, req.Project, &Flag{
+		Key:          req.Key,
+		Name:         req.Name,
+		Description:  req.Description,
+		Tags:         req.Tags,
+		Type:         VariationType(req.Type),
+		Variations:   VariationsFromProto(req.Variations),
+		Schema:       json.RawMessage(req.Schema),
+		Environments: EnvironmentsFromProto(req.Environments),
+	})
 	if err != nil {
-		return nil, err
+		return nil, grpcError(err)
 	}
 	return flag.ToProto(), nil
 }
 
 func (s *FlagGRPCServer) UpdateFlag(ctx context.Context, req *ffpb.UpdateFlagRequest) (*ffpb.Flag, error) {
-	flag, err := s.Service.UpdateFlag(ctx, req.Id, req.Name, req.Description, req.Enabled)
+	flag, err := s.Service.UpdateFlag(ctx, req.Project, req.Id, &Flag{
+		Key:          req.Key,
+		Name:         req.Name,
+		Description:  req.Description,
+		Tags:         req.Tags,
+		Type:         VariationType(req.Type),
+		Variations:   VariationsFromProto(req.Variations),
+		Schema:       json.RawMessage(req.Schema),
+		Environments: EnvironmentsFromProto(req.Environments),
+		Revision:     req.Revision,
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return flag.ToProto(), nil
+}
+
+func (s *FlagGRPCServer) UpdateFlagEnvironment(ctx context.Context, req *ffpb.UpdateFlagEnvironmentRequest) (*ffpb.Flag, error) {
+	state := FlagEnvironmentFromProto(req.State)
+	if state == nil {
+		state = &FlagEnvironment{OnVariation: unsetVariation, OffVariation: unsetVariation}
+	}
+	flag, err := s.Service.UpdateFlagEnvironment(ctx, req.Project, req.Environment, req.Id, state)
 	if err != nil {
-		return nil, err
+		return nil, grpcError(err)
 	}
 	return flag.ToProto(), nil
 }
 
+func (s *FlagGRPCServer) ResetFlagSalt(ctx context.Context, req *ffpb.ResetFlagSaltRequest) (*ffpb.Flag, error) {
+	flag, err := s.Service.ResetFlagSalt(ctx, req.Project, req.Id)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return flag.ToProto(), nil
+}
+
+func (s *FlagGRPCServer) ListFlagVersions(ctx context.Context, req *ffpb.ListFlagVersionsRequest) (*ffpb.ListFlagVersionsResponse, error) {
+	versions, err := s.Service.ListFlagVersions(ctx, req.Project, req.Id)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	res := &ffpb.ListFlagVersionsResponse{}
+	for _, v := range versions {
+		res.Versions = append(res.Versions, v.ToProto())
+	}
+	return res, nil
+}
+
+func (s *FlagGRPCServer) GetFlagVersion(ctx context.Context, req *ffpb.GetFlagVersionRequest) (*ffpb.FlagVersion, error) {
+	version, err := s.Service.GetFlagVersion(ctx, req.Project, req.Id, req.Version)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return version.ToProto(), nil
+}
+
+func (s *FlagGRPCServer) RollbackFlag(ctx context.Context, req *ffpb.RollbackFlagRequest) (*ffpb.Flag, error) {
+	flag, err := s.Service.RollbackFlag(ctx, req.Project, req.Id, req.Version)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return flag.ToProto(), nil
+}
+
+func (s *FlagGRPCServer) GetFlagDependencies(ctx context.Context, req *ffpb.GetFlagDependenciesRequest) (*ffpb.FlagDependencies, error) {
+	graph, err := s.Service.GetFlagDependencies(ctx, req.Project, req.Environment, req.Id)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return graph.ToProto(), nil
+}
+
 func (s *FlagGRPCServer) DeleteFlag(ctx context.Context, req *ffpb.DeleteFlagRequest) (*ffpb.DeleteFlagResponse, error) {
-	err := s.Service.DeleteFlag(ctx, req.Id)
+	err := s.Service.DeleteFlag(ctx, req.Project, req.Id, req.Revision)
 	if err != nil {
-		return nil, err
+		return nil, grpcError(err)
 	}
 	return &ffpb.DeleteFlagResponse{}, nil
 }
+
+func (s *FlagGRPCServer) StreamFlags(req *ffpb.StreamFlagsRequest, stream ffpb.FlagService_StreamFlagsServer) error {
+	principal := auth.FromContext(stream.Context())
+	projectKey, _, err := principal.Scope(req.Project, "")
+	if err != nil {
+		return grpcError(err)
+	}
+	events, err := s.Service.WatchFlags(stream.Context(), projectKey, req.Revision)
+	if err != nil {
+		return grpcError(err)
+	}
+	for ev := range events {
+		if principal.IsSDK() {
+			ev = ev.Scoped(principal.Environment)
+		}
+		if err := stream.Send(ev.ToProto()); err != nil {
+			return err
+		}
+	}
+	return stream.Context().Err()
+}
+
+func (s *FlagGRPCServer) Evaluate(ctx context.Context, req *ffpb.EvaluateRequest) (*ffpb.EvaluationResult, error) {
+	projectKey, env, err := auth.FromContext(ctx).Scope(req.Project, req.Environment)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	eval, err := s.Service.EvaluateFlag(ctx, projectKey, env, req.FlagId, EvaluationContextFromProto(req.Context))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return eval.ToProto(), nil
+}
+
+func (s *FlagGRPCServer) EvaluateBatch(ctx context.Context, req *ffpb.EvaluateBatchRequest) (*ffpb.EvaluateBatchResponse, error) {
+	projectKey, env, err := auth.FromContext(ctx).Scope(req.Project, req.Environment)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	evals, err := s.Service.EvaluateFlags(ctx, projectKey, env, req.FlagIds, EvaluationContextFromProto(req.Context))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	res := &ffpb.EvaluateBatchResponse{}
+	for _, eval := range evals {
+		res.Results = append(res.Results, eval.ToProto())
+	}
+	return res, nil
+}
+
+// grpcError maps service errors onto gRPC status codes.
+func grpcError(err error) error {
+	var verr *schema.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		return verr.Status(err.Error()).Err()
+	case errors.Is(err, ErrFlagNotFound), errors.Is(err, ErrFlagVersionNotFound), errors.Is(err, project.ErrProjectNotFound), errors.Is(err, project.ErrEnvironmentNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrInvalidFlag):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrFlagKeyExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, ErrFlagHasDependents), errors.Is(err, ErrFlagConflict):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, auth.ErrForbidden):
+		return status.Error(codes.PermissionDenied, err.Error())
+	default:
+		return err
+	}
+}
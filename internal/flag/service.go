@@ -4,74 +4,145 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"strings"
 	"time"
 
-	clientv3 "go.etcd.io/etcd/client/v3"
-
 	ffpb "github.com/julianstephens/feature-flag-service/gen/go/grpc/v1/featureflag.v1"
+	"github.com/julianstephens/feature-flag-service/internal/audit"
 	"github.com/julianstephens/feature-flag-service/internal/config"
+	"github.com/julianstephens/feature-flag-service/internal/project"
 	"github.com/julianstephens/feature-flag-service/internal/storage"
 	"github.com/julianstephens/feature-flag-service/internal/utils"
 )
 
 var ErrFlagNotFound = errors.New("flag not found")
 
+// Flag is a flag definition shared by every environment of its project.
+// Environments holds the per-environment state keyed by environment key.
 type Flag struct {
 	ID          string `json:"id"`
+	// Key is a human-readable name unique within the project, e.g.
+	// checkout.new-payment-flow. Flags are addressed by ID or key. Flags
+	// created before keys have none until one is set.
+	Key         string `json:"key"`
+	Project     string `json:"project"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
-	Enabled     bool `json:"enabled"`
+	Tags        []string `json:"tags"`
+	Type         VariationType `json:"type"`
+	Variations   []Variation   `json:"variations"`
+	// Schema is a JSON Schema every variation of a json flag must match.
+	Schema       json.RawMessage `json:"schema,omitempty"`
+	Environments map[string]*FlagEnvironment `json:"environments"`
+	Salt    string   `json:"salt"`
+	// Version is incremented by every write; each version is kept in the
+	// flag's history.
+	Version     int64     `json:"version"`
+	// Revision is the store revision the flag was last written at, its
+	// entity tag. It is set on reads and never stored.
+	Revision    int64     `json:"revision,omitempty"`
 	CreatedAt   time.Time `json:"createdAt"`
 	UpdatedAt   time.Time `json:"updatedAt"`
 }
 
+// Service manages flags within a project. An empty project or environment
+// key refers to the configured default.
 type Service interface {
-	CreateFlag(ctx context.Context, name, description string, enabled bool) (*Flag, error)
-	UpdateFlag(ctx context.Context, id, name, description string, enabled bool) (*Flag, error)
-	GetFlag(ctx context.Context, id string) (*Flag, error)
-	DeleteFlag(ctx context.Context, id string) error
-	ListFlags(ctx context.Context) ([]*Flag, error)
+	CreateFlag(ctx context.Context, project string, flag *Flag) (*Flag, error)
+	UpdateFlag(ctx context.Context, project, id string, flag *Flag) (*Flag, error)
+	UpdateFlagEnvironment(ctx context.Context, project, env, id string, state *FlagEnvironment) (*Flag, error)
+	GetFlag(ctx context.Context, project, id string) (*Flag, error)
+	DeleteFlag(ctx context.Context, project, id string, revision int64) error
+	ListFlags(ctx context.Context, project string) ([]*Flag, error)
+	ResetFlagSalt(ctx context.Context, project, id string) (*Flag, error)
+	GetFlagDependencies(ctx context.Context, project, env, id string) (*DependencyGraph, error)
+	WatchFlags(ctx context.Context, project string, revision int64) (<-chan *FlagEvent, error)
+	EvaluateFlag(ctx context.Context, project, env, id string, ectx *EvaluationContext) (*Evaluation, error)
+	EvaluateFlags(ctx context.Context, project, env string, ids []string, ectx *EvaluationContext) ([]*Evaluation, error)
+	MigrateLegacyFlags(ctx context.Context) (int, error)
+	ListFlagVersions(ctx context.Context, project, id string) ([]*FlagVersion, error)
+	GetFlagVersion(ctx context.Context, project, id string, version int64) (*FlagVersion, error)
+	RollbackFlag(ctx context.Context, project, id string, version int64) (*Flag, error)
 }
 
 type FlagService struct {
 	conf  *config.Config
-	store storage.Store[clientv3.OpOption]
+	store storage.Store
 	prefix string
+	historyPrefix string
+	keyIndexPrefix string
+	projects project.Service
+	segments SegmentSource
+	audit    audit.Recorder
 }
 
-func NewService(conf *config.Config, etcdClient *storage.EtcdStore) Service {
+func NewService(conf *config.Config, store storage.Store, projects project.Service, segments SegmentSource, recorder audit.Recorder) Service {
 	return &FlagService{
 		conf:  conf,
-		store: etcdClient,
+		store: store,
 		prefix: conf.FlagServicePrefix,
+		historyPrefix: conf.FlagHistoryPrefix,
+		keyIndexPrefix: conf.FlagKeyIndexPrefix,
+		projects: projects,
+		segments: segments,
+		audit:    recorder,
 	}
 }
 
-func (s *FlagService) GetKey(key string) string {
-	return s.prefix + key
+func (s *FlagService) GetKey(project, id string) string {
+	return s.projectPrefix(project) + id
+}
+
+// projectPrefix returns the prefix under which the flags of a project are
+// stored.
+func (s *FlagService) projectPrefix(project string) string {
+	return s.prefix + s.projectKey(project) + "/"
+}
+
+func (s *FlagService) projectKey(project string) string {
+	if project == "" {
+		return s.conf.DefaultProject
+	}
+	return project
+}
+
+func (s *FlagService) envKey(env string) string {
+	if env == "" {
+		return s.conf.DefaultEnvironment
+	}
+	return env
 }
 
-func (s *FlagService) ListFlags(ctx context.Context) ([]*Flag, error) {
-	res, err := s.store.List(ctx, "")
+func (s *FlagService) ListFlags(ctx context.Context, project string) ([]*Flag, error) {
+	if _, err := s.projects.GetProject(ctx, s.projectKey(project)); err != nil {
+		return nil, err
+	}
+	res, err := s.store.List(ctx, s.projectPrefix(project), storage.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
-	var flags []*Flag
-	for _, v := range res {
-		var flag Flag
-		if err := json.Unmarshal([]byte(v), &flag); err != nil {
+	flags := make([]*Flag, 0, len(res.KVs))
+	for _, kv := range res.KVs {
+		flag, err := parseKeyValue(kv)
+		if err != nil {
 			log.Printf("error unmarshaling flag: %v", err)
 			continue
 		}
-		flags = append(flags, &flag)
+		flags = append(flags, flag)
 	}
 	return flags, nil
 }
 
-func (s *FlagService) GetFlag(ctx context.Context, id string) (*Flag, error) {
-	resp, err := s.store.Get(ctx, s.GetKey(id))
+// GetFlag returns the flag with the given ID or key.
+func (s *FlagService) GetFlag(ctx context.Context, project, ref string) (*Flag, error) {
+	id, err := s.resolveID(ctx, project, ref)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.store.Get(ctx, s.GetKey(project, id))
 	if err != nil {
 		if errors.Is(err, storage.ErrKeyNotFound) {
 			return nil, ErrFlagNotFound
@@ -79,77 +150,386 @@ func (s *FlagService) GetFlag(ctx context.Context, id string) (*Flag, error) {
 		return nil, err
 	}
 
-	var flag Flag
-	if err := json.Unmarshal([]byte(resp), &flag); err != nil {
+	return parseKeyValue(resp)
+}
+
+// CreateFlag stores a new flag in a project, built from the writable fields
+// of input. A flag without variations becomes a boolean flag serving true
+// when on and false when off. Environments input has no state for start out
+// off. A flag without a key is keyed by its name.
+func (s *FlagService) CreateFlag(ctx context.Context, projectKey string, input *Flag) (*Flag, error) {
+	proj, err := s.projects.GetProject(ctx, s.projectKey(projectKey))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkEnvironments(proj, input.Environments); err != nil {
 		return nil, err
 	}
-	return &flag, nil
-}
 
-func (s *FlagService) CreateFlag(ctx context.Context, name, description string, enabled bool) (*Flag, error) {
-	id := utils.GenerateID()
+	key := input.Key
+	if key == "" {
+		key = keyFromName(input.Name)
+	}
+	if key == "" {
+		return nil, fmt.Errorf("%w: key is required", ErrInvalidFlag)
+	}
+
 	now := time.Now()
 	flag := &Flag{
-		ID:          id,
-		Name:        name,
-		Description: description,
-		Enabled:     enabled,
+		ID:          utils.GenerateID(),
+		Key:         key,
+		Project:     proj.Key,
+		Name:        input.Name,
+		Description: input.Description,
+		Tags:        input.Tags,
+		Environments: make(map[string]*FlagEnvironment, len(input.Environments)),
+		Salt:        utils.GenerateID(),
 		CreatedAt:   now,
 		UpdatedAt:   now,
 	}
+	flag.setVariations(input)
+	for key, state := range input.Environments {
+		state.fillVariations(flag.Environment(key))
+		flag.Environments[key] = state
+	}
+	guard, err := s.check(ctx, flag)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.put(ctx, proj, flag, true, guard); err != nil {
+		return nil, err
+	}
+	audit.Log(ctx, s.audit, audit.Change{Action: audit.ActionCreate, ResourceType: audit.ResourceFlag, ResourceID: flag.ID, Project: flag.Project, After: flag})
+	return flag, nil
+}
 
-	data, err := json.Marshal(flag)
+// UpdateFlag replaces the definition of a flag with that of input and the
+// state of every environment input carries, keeping on and off variations
+// it leaves unset. The state of other environments is kept. The variations are replaced only when input carries variations.
+// A non-zero input revision must match the flag's current revision. Keys
+// cannot be changed, only given to flags that have none.
+func (s *FlagService) UpdateFlag(ctx context.Context, projectKey, id string, input *Flag) (*Flag, error) {
+	proj, err := s.projects.GetProject(ctx, s.projectKey(projectKey))
 	if err != nil {
 		return nil, err
 	}
+	if err := checkEnvironments(proj, input.Environments); err != nil {
+		return nil, err
+	}
+	flag, err := s.GetFlag(ctx, proj.Key, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRevision(flag, input.Revision); err != nil {
+		return nil, err
+	}
+	if input.Key != "" && flag.Key != "" && input.Key != flag.Key {
+		return nil, fmt.Errorf("%w: key %q cannot be changed", ErrInvalidFlag, flag.Key)
+	}
+	newKey := flag.Key == "" && input.Key != ""
+	before := audit.Snapshot(flag)
 
-	_, err = s.store.Put(ctx, s.GetKey(id), string(data))
+	if newKey {
+		flag.Key = input.Key
+	}
+	flag.Name = input.Name
+	flag.Description = input.Description
+	flag.Tags = input.Tags
+	if flag.Environments == nil {
+		flag.Environments = make(map[string]*FlagEnvironment)
+	}
+	for key, state := range input.Environments {
+		state.fillVariations(flag.Environment(key))
+		flag.Environments[key] = state
+	}
+	flag.pruneEnvironments(proj)
+	if len(input.Variations) > 0 || len(flag.Variations) == 0 {
+		flag.setVariations(input)
+	}
+	guard, err := s.check(ctx, flag)
 	if err != nil {
 		return nil, err
 	}
+	flag.UpdatedAt = time.Now()
 
+	if err := s.put(ctx, proj, flag, newKey, guard); err != nil {
+		return nil, err
+	}
+	audit.Log(ctx, s.audit, audit.Change{Action: audit.ActionUpdate, ResourceType: audit.ResourceFlag, ResourceID: flag.ID, Project: flag.Project, Before: before, After: flag})
 	return flag, nil
 }
 
-func (s *FlagService) UpdateFlag(ctx context.Context, id, name, description string, enabled bool) (*Flag, error) {
-	flag, err := s.GetFlag(ctx, s.GetKey(id))
+// UpdateFlagEnvironment replaces the state of a flag in one environment. On
+// and off variations left unset keep their current values.
+func (s *FlagService) UpdateFlagEnvironment(ctx context.Context, projectKey, env, id string, state *FlagEnvironment) (*Flag, error) {
+	proj, err := s.projects.GetProject(ctx, s.projectKey(projectKey))
 	if err != nil {
 		return nil, err
 	}
+	env = s.envKey(env)
+	if !proj.HasEnvironment(env) {
+		return nil, project.ErrEnvironmentNotFound
+	}
+	flag, err := s.GetFlag(ctx, proj.Key, id)
+	if err != nil {
+		return nil, err
+	}
+	before := audit.Snapshot(flag)
 
-	flag.Name = name
-	flag.Description = description
-	flag.Enabled = enabled
+	if flag.Environments == nil {
+		flag.Environments = make(map[string]*FlagEnvironment)
+	}
+	state.fillVariations(flag.Environment(env))
+	flag.Environments[env] = state
+	flag.pruneEnvironments(proj)
+	guard, err := s.check(ctx, flag)
+	if err != nil {
+		return nil, err
+	}
 	flag.UpdatedAt = time.Now()
 
-	data, err := json.Marshal(flag)
-	if err != nil {
+	if err := s.put(ctx, proj, flag, false, guard); err != nil {
 		return nil, err
 	}
+	audit.Log(ctx, s.audit, audit.Change{Action: audit.ActionUpdate, ResourceType: audit.ResourceFlag, ResourceID: flag.ID, Project: flag.Project, Environment: env, Before: before, After: flag})
+	return flag, nil
+}
 
-	_, err = s.store.Put(ctx, s.GetKey(id), string(data))
+// ResetFlagSalt gives the flag a new bucketing salt, re-shuffling which
+// contexts land in each rollout bucket in every environment.
+func (s *FlagService) ResetFlagSalt(ctx context.Context, project, id string) (*Flag, error) {
+	flag, err := s.GetFlag(ctx, project, id)
 	if err != nil {
 		return nil, err
 	}
+	before := audit.Snapshot(flag)
+
+	flag.Salt = utils.GenerateID()
+	flag.UpdatedAt = time.Now()
 
+	if err := s.put(ctx, nil, flag, false, nil); err != nil {
+		return nil, err
+	}
+	audit.Log(ctx, s.audit, audit.Change{Action: audit.ActionUpdate, ResourceType: audit.ResourceFlag, ResourceID: flag.ID, Project: flag.Project, Before: before, After: flag})
 	return flag, nil
 }
 
-func (s *FlagService) DeleteFlag(ctx context.Context, id string) error {
-	return s.store.Delete(ctx, s.GetKey(id))
+// check validates a flag about to be written, including the segments and
+// prerequisites it references. The returned guards must be claimed by the
+// write.
+func (s *FlagService) check(ctx context.Context, flag *Flag) ([]*writeGuard, error) {
+	if err := flag.validate(); err != nil {
+		return nil, err
+	}
+	guards, err := s.checkSegments(ctx, flag)
+	if err != nil {
+		return nil, err
+	}
+	guard, err := s.checkPrerequisites(ctx, flag)
+	if err != nil {
+		return nil, err
+	}
+	if guard != nil {
+		guards = append(guards, guard)
+	}
+	return guards, nil
+}
+
+// put writes flag as its next version and records the version in the
+// flag's history in the same transaction. The write only succeeds while the
+// flag is still at the revision it was read at, zero for new flags; it fails
+// with ErrFlagConflict when another write came first. With index set the
+// flag's key is claimed in the key index too, failing with ErrFlagKeyExists
+// when another flag holds it. The guards are claimed as well, and with proj
+// set the write also fails once the project has changed since it was read,
+// so state is never written for a deleted project or environment.
+func (s *FlagService) put(ctx context.Context, proj *project.Project, flag *Flag, index bool, guards []*writeGuard) error {
+	flag.Version++
+	stored := *flag
+	stored.Revision = 0
+	data, err := json.Marshal(&stored)
+	if err != nil {
+		return err
+	}
+	record, err := json.Marshal(&FlagVersion{
+		Version:   flag.Version,
+		Author:    audit.Actor(ctx),
+		CreatedAt: flag.UpdatedAt,
+		Flag:      &stored,
+	})
+	if err != nil {
+		return err
+	}
+
+	key := s.GetKey(flag.Project, flag.ID)
+	historyKey := s.historyKey(flag.Project, flag.ID, flag.Version)
+	cmps := []storage.Cmp{storage.AtRevision(key, flag.Revision), storage.Absent(historyKey)}
+	ops := []storage.Op{storage.Put(key, string(data)), storage.Put(historyKey, string(record))}
+	indexKey := s.keyIndexKey(flag.Project, flag.Key)
+	if index {
+		cmps = append(cmps, storage.Absent(indexKey))
+		ops = append(ops, storage.Put(indexKey, flag.ID))
+	}
+	if proj != nil {
+		projectCmps, projectOps := s.projects.FlagGuard(proj, flag.Revision == 0)
+		cmps, ops = append(cmps, projectCmps...), append(ops, projectOps...)
+	}
+	cmps, ops = claim(guards, flag.ID, cmps, ops)
+	resp, err := s.store.Txn(ctx, cmps, ops...)
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		if index {
+			if owner, err := s.store.Get(ctx, indexKey); err == nil && owner.Value != flag.ID {
+				return fmt.Errorf("%w: %s", ErrFlagKeyExists, flag.Key)
+			}
+		}
+		if proj != nil {
+			if current, err := s.projects.GetProject(ctx, proj.Key); err != nil || current.Revision != proj.Revision {
+				return fmt.Errorf("%w: project %s changed while %s was written", ErrFlagConflict, proj.Key, flag.ID)
+			}
+		}
+		if guard := changed(ctx, s.store, guards); guard != nil {
+			return fmt.Errorf("%w: %s changed while %s was written", ErrFlagConflict, guard.what, flag.ID)
+		}
+		return fmt.Errorf("%w: %s was modified since revision %d", ErrFlagConflict, flag.ID, flag.Revision)
+	}
+	flag.Revision = resp.Revision
+	return nil
+}
+
+// checkRevision fails with ErrFlagConflict unless revision is zero or the
+// flag's current revision.
+func checkRevision(flag *Flag, revision int64) error {
+	if revision != 0 && revision != flag.Revision {
+		return fmt.Errorf("%w: %s is at revision %d, not %d", ErrFlagConflict, flag.ID, flag.Revision, revision)
+	}
+	return nil
+}
+
+// checkSegments rejects flags whose rules reference unknown segments. It
+// returns the guards of the referenced segments, which the write must claim
+// so that a segment cannot be deleted while it starts being referenced.
+func (s *FlagService) checkSegments(ctx context.Context, flag *Flag) ([]*writeGuard, error) {
+	keys := flag.segmentKeys()
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	if s.segments == nil {
+		return nil, fmt.Errorf("%w: segments are not available", ErrInvalidFlag)
+	}
+	guards := make([]*writeGuard, 0, len(keys))
+	for _, key := range keys {
+		guard, err := readGuard(ctx, s.store, SegmentGuardKey(s.conf, key), "references to segment "+key)
+		if err != nil {
+			return nil, err
+		}
+		guards = append(guards, guard)
+	}
+	segments, err := s.segments.LoadSegments(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if !segments.Has(key) {
+			return nil, fmt.Errorf("%w: unknown segment %q", ErrInvalidFlag, key)
+		}
+	}
+	return guards, nil
+}
+
+// DeleteFlag removes a flag that no other flag lists as a prerequisite in
+// any environment, freeing its key. A non-zero revision must match the
+// flag's current revision.
+func (s *FlagService) DeleteFlag(ctx context.Context, project, ref string, revision int64) error {
+	guard, err := s.readPrerequisiteGuard(ctx, project)
+	if err != nil {
+		return err
+	}
+	flags, err := s.projectFlags(ctx, project)
+	if err != nil {
+		return err
+	}
+	flag, ok := lookup(flags, ref)
+	if !ok {
+		return ErrFlagNotFound
+	}
+	id := flag.ID
+	if err := checkRevision(flag, revision); err != nil {
+		return err
+	}
+	if dependents := dependentsOf(flags, "")[id]; len(dependents) > 0 {
+		return fmt.Errorf("%w: %s", ErrFlagHasDependents, strings.Join(dependents, ", "))
+	}
+
+	key := s.GetKey(project, id)
+	ops := []storage.Op{storage.Delete(key)}
+	if flag.Key != "" {
+		ops = append(ops, storage.Delete(s.keyIndexKey(project, flag.Key)))
+	}
+	guards := []*writeGuard{guard}
+	cmps, ops := claim(guards, id, []storage.Cmp{storage.AtRevision(key, flag.Revision)}, ops)
+	resp, err := s.store.Txn(ctx, cmps, ops...)
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		if guard := changed(ctx, s.store, guards); guard != nil {
+			return fmt.Errorf("%w: %s changed while %s was deleted", ErrFlagConflict, guard.what, id)
+		}
+		return fmt.Errorf("%w: %s was modified since revision %d", ErrFlagConflict, id, flag.Revision)
+	}
+	audit.Log(ctx, s.audit, audit.Change{Action: audit.ActionDelete, ResourceType: audit.ResourceFlag, ResourceID: id, Project: flag.Project, Before: flag})
+	return nil
 }
 
 func (f *Flag) ToProto() *ffpb.Flag {
 	return &ffpb.Flag{
 		Id:          f.ID,
+		Key:         f.Key,
+		Project:     f.Project,
 		Name:        f.Name,
 		Description: f.Description,
-		Enabled:     f.Enabled,
+		Tags:        f.Tags,
 		CreatedAt:   f.CreatedAt.Format(time.RFC3339),
 		UpdatedAt:   f.UpdatedAt.Format(time.RFC3339),
+		Type:         string(f.Type),
+		Variations:   variationsToProto(f.Variations),
+		Schema:       string(f.Schema),
+		Environments: environmentsToProto(f.Environments),
+		Salt:         f.Salt,
+		Version:      f.Version,
+		Revision:     f.Revision,
 	}
 }
 
+func (f *Flag) validate() error {
+	if f.Key != "" {
+		if err := validateKey(f.Key); err != nil {
+			return err
+		}
+	}
+	if err := f.validateVariations(); err != nil {
+		return err
+	}
+	for _, key := range environmentKeys(f.Environments) {
+		if err := f.Environments[key].validate(len(f.Variations)); err != nil {
+			return fmt.Errorf("environment %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func variationsToProto(variations []Variation) []*ffpb.Variation {
+	var protoVariations []*ffpb.Variation
+	for _, v := range variations {
+		protoVariations = append(protoVariations, v.ToProto())
+	}
+	return protoVariations
+}
+
 func FlagFromProto(protoFlag *ffpb.Flag) (*Flag, error) {
 	createdAt, err := time.Parse(time.RFC3339, protoFlag.CreatedAt)
 	if err != nil {
@@ -161,14 +541,33 @@ func FlagFromProto(protoFlag *ffpb.Flag) (*Flag, error) {
 	}
 	return &Flag{
 		ID:          protoFlag.Id,
+		Key:         protoFlag.Key,
+		Project:     protoFlag.Project,
 		Name:        protoFlag.Name,
 		Description: protoFlag.Description,
-		Enabled:     protoFlag.Enabled,
+		Tags:        protoFlag.Tags,
+		Type:         VariationType(protoFlag.Type),
+		Variations:   VariationsFromProto(protoFlag.Variations),
+		Schema:       json.RawMessage(protoFlag.Schema),
+		Environments: EnvironmentsFromProto(protoFlag.Environments),
+		Salt:         protoFlag.Salt,
+		Version:      protoFlag.Version,
+		Revision:     protoFlag.Revision,
 		CreatedAt:   createdAt,
 		UpdatedAt:   updatedAt,
 	}, nil
 }
 
+// parseKeyValue parses a stored flag, taking its revision from the store.
+func parseKeyValue(kv *storage.KeyValue) (*Flag, error) {
+	flag, err := ParseFlag([]byte(kv.Value))
+	if err != nil {
+		return nil, err
+	}
+	flag.Revision = kv.ModRevision
+	return flag, nil
+}
+
 func ParseFlag(data []byte) (*Flag, error) {
 	var flag Flag
 	if err := json.Unmarshal(data, &flag); err != nil {
@@ -0,0 +1,235 @@
+package flag
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/julianstephens/feature-flag-service/internal/config"
+	"github.com/julianstephens/feature-flag-service/internal/project"
+	"github.com/julianstephens/feature-flag-service/internal/storage"
+)
+
+// newTestService returns a FlagService on a MemoryStore holding the default
+// project.
+func newTestService(t *testing.T) (*FlagService, *storage.MemoryStore) {
+	t.Helper()
+	conf := &config.Config{
+		FlagServicePrefix:    "/featureflags/",
+		FlagHistoryPrefix:    "/featureflag-history/",
+		FlagKeyIndexPrefix:   "/featureflag-keys/",
+		ProjectServicePrefix: "/projects/",
+		SDKKeyServicePrefix:  "/sdkkeys/",
+		DefaultProject:       "default",
+		DefaultEnvironment:   "production",
+	}
+	store := storage.NewMemoryStore()
+	t.Cleanup(func() { store.Close() })
+	projects := project.NewService(conf, store, nil)
+	if _, err := projects.EnsureProject(context.Background(), conf.DefaultProject); err != nil {
+		t.Fatal(err)
+	}
+	return NewService(conf, store, projects, nil, nil).(*FlagService), store
+}
+
+func TestFlagServiceLifecycle(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t)
+
+	created, err := s.CreateFlag(ctx, "", &Flag{Name: "New Checkout"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Key != "new-checkout" || created.Type != VariationBoolean || created.Revision == 0 {
+		t.Fatalf("CreateFlag = %+v; want a boolean flag keyed new-checkout with a revision", created)
+	}
+	if _, err := s.CreateFlag(ctx, "", &Flag{Name: "Other", Key: "new-checkout"}); !errors.Is(err, ErrFlagKeyExists) {
+		t.Errorf("CreateFlag with a taken key: err = %v; want ErrFlagKeyExists", err)
+	}
+
+	byKey, err := s.GetFlag(ctx, "", "new-checkout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byKey.ID != created.ID || byKey.Revision != created.Revision {
+		t.Errorf("GetFlag by key = %s at %d; want %s at %d", byKey.ID, byKey.Revision, created.ID, created.Revision)
+	}
+
+	updated, err := s.UpdateFlag(ctx, "", created.ID, &Flag{Name: "Checkout", Revision: created.Revision})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Name != "Checkout" || updated.Key != "new-checkout" || updated.Revision <= created.Revision {
+		t.Errorf("UpdateFlag = %+v; want the renamed flag at a later revision", updated)
+	}
+	if _, err := s.UpdateFlag(ctx, "", created.ID, &Flag{Name: "Stale", Revision: created.Revision}); !errors.Is(err, ErrFlagConflict) {
+		t.Errorf("UpdateFlag at a stale revision: err = %v; want ErrFlagConflict", err)
+	}
+
+	if err := s.DeleteFlag(ctx, "", created.ID, created.Revision); !errors.Is(err, ErrFlagConflict) {
+		t.Errorf("DeleteFlag at a stale revision: err = %v; want ErrFlagConflict", err)
+	}
+	if err := s.DeleteFlag(ctx, "", "new-checkout", updated.Revision); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetFlag(ctx, "", created.ID); !errors.Is(err, ErrFlagNotFound) {
+		t.Errorf("GetFlag after DeleteFlag: err = %v; want ErrFlagNotFound", err)
+	}
+	if _, err := s.CreateFlag(ctx, "", &Flag{Name: "Again", Key: "new-checkout"}); err != nil {
+		t.Errorf("CreateFlag reusing a deleted flag's key: %v", err)
+	}
+}
+
+func TestFlagServiceEnvironmentAndEvaluation(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t)
+
+	f, err := s.CreateFlag(ctx, "", &Flag{Name: "beta"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eval, err := s.EvaluateFlag(ctx, "", "", f.Key, &EvaluationContext{Key: "user-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(eval.Value) != "false" {
+		t.Errorf("new flag evaluates to %s; want false", eval.Value)
+	}
+
+	state := &FlagEnvironment{Enabled: true, OnVariation: unsetVariation, OffVariation: unsetVariation}
+	if _, err := s.UpdateFlagEnvironment(ctx, "", "", f.ID, state); err != nil {
+		t.Fatal(err)
+	}
+	eval, err = s.EvaluateFlag(ctx, "", "", f.Key, &EvaluationContext{Key: "user-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(eval.Value) != "true" {
+		t.Errorf("enabled flag evaluates to %s; want true", eval.Value)
+	}
+
+	versions, err := s.ListFlagVersions(ctx, "", f.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 {
+		t.Fatalf("ListFlagVersions returned %d versions; want 2", len(versions))
+	}
+	if _, err := s.RollbackFlag(ctx, "", f.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+	eval, err = s.EvaluateFlag(ctx, "", "", f.Key, &EvaluationContext{Key: "user-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(eval.Value) != "false" {
+		t.Errorf("flag rolled back to version 1 evaluates to %s; want false", eval.Value)
+	}
+}
+
+func TestFlagServiceWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, _ := newTestService(t)
+
+	existing, err := s.CreateFlag(ctx, "", &Flag{Name: "existing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := s.WatchFlags(ctx, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev := nextEvent(t, events); ev.Action != ActionSnapshot || ev.Flag.ID != existing.ID || ev.Flag.Revision != existing.Revision {
+		t.Fatalf("first event = %s %+v; want a snapshot of %s at %d", ev.Action, ev.Flag, existing.ID, existing.Revision)
+	}
+
+	added, err := s.CreateFlag(ctx, "", &Flag{Name: "added"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev := nextEvent(t, events); ev.Action != ActionCreated || ev.Flag.ID != added.ID || ev.Revision != added.Revision || ev.Flag.Revision != added.Revision {
+		t.Errorf("event = %s %+v at %d; want %s created at %d", ev.Action, ev.Flag, ev.Revision, added.ID, added.Revision)
+	}
+	if err := s.DeleteFlag(ctx, "", added.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if ev := nextEvent(t, events); ev.Action != ActionDeleted || ev.Flag.ID != added.ID {
+		t.Errorf("event = %s %+v; want %s deleted", ev.Action, ev.Flag, added.ID)
+	}
+}
+
+func TestFlagServiceWatchAheadOfStore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, _ := newTestService(t)
+
+	f, err := s.CreateFlag(ctx, "", &Flag{Name: "existing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := s.WatchFlags(ctx, "", f.Revision+100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev := nextEvent(t, events); ev.Action != ActionResync {
+		t.Fatalf("first event = %s; want a resync", ev.Action)
+	}
+	if ev := nextEvent(t, events); ev.Action != ActionSnapshot || ev.Flag.ID != f.ID {
+		t.Errorf("event after resync = %s %+v; want a snapshot of %s", ev.Action, ev.Flag, f.ID)
+	}
+}
+
+func TestFlagServiceRecreatedEnvironment(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t)
+
+	f, err := s.CreateFlag(ctx, "", &Flag{Name: "beta"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := &FlagEnvironment{Enabled: true, OnVariation: unsetVariation, OffVariation: unsetVariation}
+	if _, err := s.UpdateFlagEnvironment(ctx, "", "staging", f.ID, state); err != nil {
+		t.Fatal(err)
+	}
+	stale, err := s.projects.GetProject(ctx, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.projects.DeleteEnvironment(ctx, "default", "staging"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.projects.CreateEnvironment(ctx, "default", &project.Environment{Key: "staging"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GetFlag(ctx, "", f.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Environment("staging").Enabled {
+		t.Error("re-created environment inherited the old flag state")
+	}
+
+	got.Environments["staging"] = &FlagEnvironment{Enabled: true, OffVariation: 1}
+	if err := s.put(ctx, stale, got, false, nil); !errors.Is(err, ErrFlagConflict) {
+		t.Errorf("write based on the project before the deletion: err = %v; want ErrFlagConflict", err)
+	}
+}
+
+// nextEvent returns the next flag event, failing the test if none arrives
+// within a second.
+func nextEvent(t *testing.T, events <-chan *FlagEvent) *FlagEvent {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		if !ok {
+			t.Fatal("watch closed")
+		}
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("no flag event")
+	}
+	return nil
+}
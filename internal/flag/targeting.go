@@ -0,0 +1,500 @@
+package flag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ffpb "github.com/julianstephens/feature-flag-service/gen/go/grpc/v1/featureflag.v1"
+	"github.com/julianstephens/feature-flag-service/internal/config"
+	"github.com/julianstephens/feature-flag-service/internal/utils"
+)
+
+type Operator string
+
+const (
+	OpIn                 Operator = "in"
+	OpNotIn              Operator = "notIn"
+	OpStartsWith         Operator = "startsWith"
+	OpEndsWith           Operator = "endsWith"
+	OpContains           Operator = "contains"
+	OpMatches            Operator = "matches"
+	OpLessThan           Operator = "lessThan"
+	OpLessThanOrEqual    Operator = "lessThanOrEqual"
+	OpGreaterThan        Operator = "greaterThan"
+	OpGreaterThanOrEqual Operator = "greaterThanOrEqual"
+	OpSemVerEqual        Operator = "semVerEqual"
+	OpSemVerLessThan     Operator = "semVerLessThan"
+	OpSemVerGreaterThan  Operator = "semVerGreaterThan"
+	OpBefore             Operator = "before"
+	OpAfter              Operator = "after"
+	// OpSegmentMatch matches contexts in any of the segments named by the
+	// clause values. The clause attribute is ignored.
+	OpSegmentMatch Operator = "segmentMatch"
+)
+
+// Segments resolves segment membership for segmentMatch clauses.
+type Segments interface {
+	Has(key string) bool
+	Contains(key string, ectx *EvaluationContext) bool
+}
+
+// SegmentSource loads the segments as of a store revision, or the latest
+// segments when revision is 0, so that flags and the segments they reference
+// can be read consistently.
+type SegmentSource interface {
+	LoadSegments(ctx context.Context, revision int64) (Segments, error)
+}
+
+// SegmentGuardKey returns the key claimed by every flag write referencing a
+// segment and by the deletion of the segment, so that a segment is never
+// deleted while a flag starts referencing it. Project keys cannot start with
+// '.', so it never clashes with the key index.
+func SegmentGuardKey(conf *config.Config, segment string) string {
+	return conf.FlagKeyIndexPrefix + ".segments/" + segment
+}
+
+// EvaluationContext describes who a flag is being evaluated for. Key is the
+// targeting key and can be referenced by clauses as the "key" attribute.
+type EvaluationContext struct {
+	Key        string         `json:"key"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+func (c *EvaluationContext) Value(attribute string) (any, bool) {
+	if attribute == "key" {
+		return c.Key, c.Key != ""
+	}
+	v, ok := c.Attributes[attribute]
+	return v, ok && v != nil
+}
+
+// Target serves a variation to an explicit list of context keys.
+type Target struct {
+	Variation int      `json:"variation"`
+	Values    []string `json:"values"`
+}
+
+// Rule serves a variation when all of its clauses match. When Rollout is set
+// it takes precedence over Variation.
+type Rule struct {
+	ID          string   `json:"id"`
+	Description string   `json:"description,omitempty"`
+	Clauses     []Clause `json:"clauses"`
+	Variation   int      `json:"variation"`
+	Rollout     *Rollout `json:"rollout,omitempty"`
+}
+
+// Clause tests a single context attribute. It matches when the operator holds
+// for any of the values; for list attributes it is enough that one element
+// matches. A clause never matches a missing attribute, even when negated.
+type Clause struct {
+	Attribute string   `json:"attribute"`
+	Operator  Operator `json:"operator"`
+	Values    []string `json:"values"`
+	Negate    bool     `json:"negate,omitempty"`
+}
+
+func (r *Rule) Matches(ectx *EvaluationContext, segments Segments) bool {
+	for i := range r.Clauses {
+		if !r.Clauses[i].Matches(ectx, segments) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Clause) Matches(ectx *EvaluationContext, segments Segments) bool {
+	if c.Operator == OpSegmentMatch {
+		matched := false
+		for _, key := range c.Values {
+			if segments != nil && segments.Contains(key, ectx) {
+				matched = true
+				break
+			}
+		}
+		return matched != c.Negate
+	}
+
+	v, ok := ectx.Value(c.Attribute)
+	if !ok {
+		return false
+	}
+
+	op, invert := c.Operator, c.Negate
+	if op == OpNotIn {
+		op, invert = OpIn, !invert
+	}
+
+	matched := false
+	if list, isList := v.([]any); isList {
+		for _, item := range list {
+			if c.matchValue(op, item) {
+				matched = true
+				break
+			}
+		}
+	} else {
+		matched = c.matchValue(op, v)
+	}
+	return matched != invert
+}
+
+func (c *Clause) matchValue(op Operator, v any) bool {
+	for _, want := range c.Values {
+		if matchOperator(op, v, want) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchOperator(op Operator, v any, want string) bool {
+	switch op {
+	case OpIn:
+		s, ok := attributeString(v)
+		if !ok {
+			return false
+		}
+		if s == want {
+			return true
+		}
+		a, aErr := strconv.ParseFloat(s, 64)
+		b, bErr := strconv.ParseFloat(want, 64)
+		return aErr == nil && bErr == nil && a == b
+	case OpStartsWith, OpEndsWith, OpContains, OpMatches:
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		switch op {
+		case OpStartsWith:
+			return strings.HasPrefix(s, want)
+		case OpEndsWith:
+			return strings.HasSuffix(s, want)
+		case OpContains:
+			return strings.Contains(s, want)
+		default:
+			re, err := compileRegexp(want)
+			return err == nil && re.MatchString(s)
+		}
+	case OpLessThan, OpLessThanOrEqual, OpGreaterThan, OpGreaterThanOrEqual:
+		a, ok := attributeNumber(v)
+		if !ok {
+			return false
+		}
+		b, err := strconv.ParseFloat(want, 64)
+		if err != nil {
+			return false
+		}
+		switch op {
+		case OpLessThan:
+			return a < b
+		case OpLessThanOrEqual:
+			return a <= b
+		case OpGreaterThan:
+			return a > b
+		default:
+			return a >= b
+		}
+	case OpSemVerEqual, OpSemVerLessThan, OpSemVerGreaterThan:
+		s, ok := attributeString(v)
+		if !ok {
+			return false
+		}
+		a, err := parseSemVer(s)
+		if err != nil {
+			return false
+		}
+		b, err := parseSemVer(want)
+		if err != nil {
+			return false
+		}
+		switch op {
+		case OpSemVerEqual:
+			return a.compare(b) == 0
+		case OpSemVerLessThan:
+			return a.compare(b) < 0
+		default:
+			return a.compare(b) > 0
+		}
+	case OpBefore, OpAfter:
+		a, ok := attributeTime(v)
+		if !ok {
+			return false
+		}
+		b, err := parseTime(want)
+		if err != nil {
+			return false
+		}
+		if op == OpBefore {
+			return a.Before(b)
+		}
+		return a.After(b)
+	}
+	return false
+}
+
+func (c *Clause) Validate() error {
+	if c.Attribute == "" && c.Operator != OpSegmentMatch {
+		return fmt.Errorf("%w: clause attribute is required", ErrInvalidFlag)
+	}
+	if len(c.Values) == 0 {
+		return fmt.Errorf("%w: clause on %q needs at least one value", ErrInvalidFlag, c.Attribute)
+	}
+
+	var check func(string) error
+	switch c.Operator {
+	case OpIn, OpNotIn, OpStartsWith, OpEndsWith, OpContains, OpSegmentMatch:
+	case OpMatches:
+		check = func(v string) error {
+			_, err := compileRegexp(v)
+			return err
+		}
+	case OpLessThan, OpLessThanOrEqual, OpGreaterThan, OpGreaterThanOrEqual:
+		check = func(v string) error {
+			_, err := strconv.ParseFloat(v, 64)
+			return err
+		}
+	case OpSemVerEqual, OpSemVerLessThan, OpSemVerGreaterThan:
+		check = func(v string) error {
+			_, err := parseSemVer(v)
+			return err
+		}
+	case OpBefore, OpAfter:
+		check = func(v string) error {
+			_, err := parseTime(v)
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: unknown clause operator %q", ErrInvalidFlag, c.Operator)
+	}
+
+	if check != nil {
+		for _, v := range c.Values {
+			if err := check(v); err != nil {
+				return fmt.Errorf("%w: invalid %s value %q: %v", ErrInvalidFlag, c.Operator, v, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateTargeting checks targets, rules and rollouts against the number of
+// variations and assigns IDs to new rules.
+func (e *FlagEnvironment) validateTargeting(variations int) error {
+	for i, t := range e.Targets {
+		if t.Variation < 0 || t.Variation >= variations {
+			return fmt.Errorf("%w: target %d variation %d out of range", ErrInvalidFlag, i, t.Variation)
+		}
+	}
+	for i := range e.Rules {
+		rule := &e.Rules[i]
+		if rule.ID == "" {
+			rule.ID = utils.GenerateID()
+		}
+		if rule.Rollout != nil {
+			if err := rule.Rollout.validate(variations); err != nil {
+				return err
+			}
+		} else if rule.Variation < 0 || rule.Variation >= variations {
+			return fmt.Errorf("%w: rule %d variation %d out of range", ErrInvalidFlag, i, rule.Variation)
+		}
+		for j := range rule.Clauses {
+			if err := rule.Clauses[j].Validate(); err != nil {
+				return err
+			}
+		}
+	}
+	if e.Rollout != nil {
+		if err := e.Rollout.validate(variations); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// segmentKeys returns the segments referenced by the rules of env.
+func (e *FlagEnvironment) segmentKeys() []string {
+	var keys []string
+	for _, rule := range e.Rules {
+		for _, c := range rule.Clauses {
+			if c.Operator == OpSegmentMatch {
+				keys = append(keys, c.Values...)
+			}
+		}
+	}
+	return keys
+}
+
+// segmentKeys returns the segments referenced by the flag in any
+// environment, sorted and without duplicates.
+func (f *Flag) segmentKeys() []string {
+	var keys []string
+	for _, state := range f.Environments {
+		keys = append(keys, state.segmentKeys()...)
+	}
+	slices.Sort(keys)
+	return slices.Compact(keys)
+}
+
+var regexpCache sync.Map
+
+func compileRegexp(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexpCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexpCache.Store(pattern, re)
+	return re, nil
+}
+
+func attributeString(v any) (string, bool) {
+	switch t := v.(type) {
+	case string:
+		return t, true
+	case bool:
+		return strconv.FormatBool(t), true
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), true
+	case int:
+		return strconv.Itoa(t), true
+	case int64:
+		return strconv.FormatInt(t, 10), true
+	case json.Number:
+		return t.String(), true
+	}
+	return "", false
+}
+
+func attributeNumber(v any) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case int:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	case json.Number:
+		f, err := t.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(t, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// attributeTime accepts RFC 3339 strings or Unix timestamps in milliseconds.
+func attributeTime(v any) (time.Time, bool) {
+	if s, ok := v.(string); ok {
+		t, err := parseTime(s)
+		return t, err == nil
+	}
+	if n, ok := attributeNumber(v); ok {
+		return time.UnixMilli(int64(n)), true
+	}
+	return time.Time{}, false
+}
+
+func parseTime(s string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func (t Target) ToProto() *ffpb.Target {
+	return &ffpb.Target{
+		Variation: int32(t.Variation),
+		Values:    t.Values,
+	}
+}
+
+func (r Rule) ToProto() *ffpb.Rule {
+	rule := &ffpb.Rule{
+		Id:          r.ID,
+		Description: r.Description,
+		Variation:   int32(r.Variation),
+		Rollout:     r.Rollout.ToProto(),
+		Clauses:     ClausesToProto(r.Clauses),
+	}
+	return rule
+}
+
+func ClausesToProto(clauses []Clause) []*ffpb.Clause {
+	var protoClauses []*ffpb.Clause
+	for _, c := range clauses {
+		protoClauses = append(protoClauses, &ffpb.Clause{
+			Attribute: c.Attribute,
+			Operator:  string(c.Operator),
+			Values:    c.Values,
+			Negate:    c.Negate,
+		})
+	}
+	return protoClauses
+}
+
+func targetsToProto(targets []Target) []*ffpb.Target {
+	var protoTargets []*ffpb.Target
+	for _, t := range targets {
+		protoTargets = append(protoTargets, t.ToProto())
+	}
+	return protoTargets
+}
+
+func rulesToProto(rules []Rule) []*ffpb.Rule {
+	var protoRules []*ffpb.Rule
+	for _, r := range rules {
+		protoRules = append(protoRules, r.ToProto())
+	}
+	return protoRules
+}
+
+func TargetsFromProto(protoTargets []*ffpb.Target) []Target {
+	var targets []Target
+	for _, t := range protoTargets {
+		targets = append(targets, Target{
+			Variation: int(t.Variation),
+			Values:    t.Values,
+		})
+	}
+	return targets
+}
+
+func RulesFromProto(protoRules []*ffpb.Rule) []Rule {
+	var rules []Rule
+	for _, r := range protoRules {
+		rule := Rule{
+			ID:          r.Id,
+			Description: r.Description,
+			Variation:   int(r.Variation),
+			Rollout:     RolloutFromProto(r.Rollout),
+			Clauses:     ClausesFromProto(r.Clauses),
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func ClausesFromProto(protoClauses []*ffpb.Clause) []Clause {
+	var clauses []Clause
+	for _, c := range protoClauses {
+		clauses = append(clauses, Clause{
+			Attribute: c.Attribute,
+			Operator:  Operator(c.Operator),
+			Values:    c.Values,
+			Negate:    c.Negate,
+		})
+	}
+	return clauses
+}
@@ -0,0 +1,155 @@
+package flag
+
+import (
+	"errors"
+	"testing"
+)
+
+// memberSegments holds the segment "beta" with the single member "user-1".
+type memberSegments struct{}
+
+func (memberSegments) Has(key string) bool { return key == "beta" }
+
+func (memberSegments) Contains(key string, ectx *EvaluationContext) bool {
+	return key == "beta" && ectx.Key == "user-1"
+}
+
+func TestClauseMatches(t *testing.T) {
+	ectx := &EvaluationContext{
+		Key: "user-1",
+		Attributes: map[string]any{
+			"email":    "ada@example.com",
+			"country":  "GB",
+			"groups":   []any{"admins", "beta-testers"},
+			"age":      float64(36),
+			"seats":    "12",
+			"version":  "2.4.1",
+			"build":    "2.5.0-rc.1",
+			"signedUp": "2024-03-01T12:00:00Z",
+			"lastSeen": float64(1709294400000), // 2024-03-01T12:00:00Z
+			"nothing":  nil,
+		},
+	}
+
+	tests := []struct {
+		name   string
+		clause Clause
+		want   bool
+	}{
+		{"in", Clause{Attribute: "country", Operator: OpIn, Values: []string{"FR", "GB"}}, true},
+		{"in without match", Clause{Attribute: "country", Operator: OpIn, Values: []string{"FR"}}, false},
+		{"in on the key", Clause{Attribute: "key", Operator: OpIn, Values: []string{"user-1"}}, true},
+		{"in on a list", Clause{Attribute: "groups", Operator: OpIn, Values: []string{"admins"}}, true},
+		{"in compares numbers", Clause{Attribute: "age", Operator: OpIn, Values: []string{"36.0"}}, true},
+		{"notIn", Clause{Attribute: "country", Operator: OpNotIn, Values: []string{"FR"}}, true},
+		{"notIn with match", Clause{Attribute: "country", Operator: OpNotIn, Values: []string{"GB"}}, false},
+		{"notIn on a list", Clause{Attribute: "groups", Operator: OpNotIn, Values: []string{"admins"}}, false},
+		{"negated notIn", Clause{Attribute: "country", Operator: OpNotIn, Values: []string{"GB"}, Negate: true}, true},
+
+		{"startsWith", Clause{Attribute: "email", Operator: OpStartsWith, Values: []string{"ada@"}}, true},
+		{"endsWith", Clause{Attribute: "email", Operator: OpEndsWith, Values: []string{"@example.org", "@example.com"}}, true},
+		{"contains", Clause{Attribute: "email", Operator: OpContains, Values: []string{"bob"}}, false},
+		{"string operator on a number", Clause{Attribute: "age", Operator: OpStartsWith, Values: []string{"3"}}, false},
+
+		{"matches", Clause{Attribute: "email", Operator: OpMatches, Values: []string{`^[a-z]+@example\.com$`}}, true},
+		{"matches without match", Clause{Attribute: "email", Operator: OpMatches, Values: []string{`^bob@`}}, false},
+		{"matches on a list", Clause{Attribute: "groups", Operator: OpMatches, Values: []string{`-testers$`}}, true},
+		{"malformed regex", Clause{Attribute: "email", Operator: OpMatches, Values: []string{`(`}}, false},
+
+		{"lessThan", Clause{Attribute: "age", Operator: OpLessThan, Values: []string{"40"}}, true},
+		{"lessThan at the bound", Clause{Attribute: "age", Operator: OpLessThan, Values: []string{"36"}}, false},
+		{"lessThanOrEqual", Clause{Attribute: "age", Operator: OpLessThanOrEqual, Values: []string{"36"}}, true},
+		{"greaterThan", Clause{Attribute: "age", Operator: OpGreaterThan, Values: []string{"36"}}, false},
+		{"greaterThanOrEqual", Clause{Attribute: "age", Operator: OpGreaterThanOrEqual, Values: []string{"36"}}, true},
+		{"numeric string attribute", Clause{Attribute: "seats", Operator: OpGreaterThan, Values: []string{"10"}}, true},
+		{"non-numeric attribute", Clause{Attribute: "country", Operator: OpGreaterThan, Values: []string{"0"}}, false},
+		{"non-numeric value", Clause{Attribute: "age", Operator: OpGreaterThan, Values: []string{"many"}}, false},
+
+		{"semVerEqual", Clause{Attribute: "version", Operator: OpSemVerEqual, Values: []string{"v2.4.1"}}, true},
+		{"semVerEqual ignores build metadata", Clause{Attribute: "version", Operator: OpSemVerEqual, Values: []string{"2.4.1+sha.5114f85"}}, true},
+		{"semVerLessThan", Clause{Attribute: "version", Operator: OpSemVerLessThan, Values: []string{"2.10.0"}}, true},
+		{"semVerGreaterThan", Clause{Attribute: "version", Operator: OpSemVerGreaterThan, Values: []string{"2.4"}}, true},
+		{"pre-release below release", Clause{Attribute: "build", Operator: OpSemVerLessThan, Values: []string{"2.5.0"}}, true},
+		{"malformed semver attribute", Clause{Attribute: "email", Operator: OpSemVerLessThan, Values: []string{"9.9.9"}}, false},
+		{"malformed semver value", Clause{Attribute: "version", Operator: OpSemVerLessThan, Values: []string{"3.x"}}, false},
+
+		{"before", Clause{Attribute: "signedUp", Operator: OpBefore, Values: []string{"2024-06-01T00:00:00Z"}}, true},
+		{"after", Clause{Attribute: "signedUp", Operator: OpAfter, Values: []string{"2024-06-01T00:00:00Z"}}, false},
+		{"after in milliseconds", Clause{Attribute: "signedUp", Operator: OpAfter, Values: []string{"1704067200000"}}, true},
+		{"timestamp attribute", Clause{Attribute: "lastSeen", Operator: OpBefore, Values: []string{"2024-03-01T12:00:01Z"}}, true},
+		{"equal times", Clause{Attribute: "lastSeen", Operator: OpBefore, Values: []string{"2024-03-01T12:00:00Z"}}, false},
+		{"malformed date attribute", Clause{Attribute: "email", Operator: OpBefore, Values: []string{"2024-06-01T00:00:00Z"}}, false},
+		{"malformed date value", Clause{Attribute: "signedUp", Operator: OpBefore, Values: []string{"next tuesday"}}, false},
+
+		{"negated", Clause{Attribute: "country", Operator: OpIn, Values: []string{"GB"}, Negate: true}, false},
+		{"negated without match", Clause{Attribute: "age", Operator: OpGreaterThan, Values: []string{"40"}, Negate: true}, true},
+		{"negated on a list", Clause{Attribute: "groups", Operator: OpIn, Values: []string{"staff"}, Negate: true}, true},
+		{"missing attribute", Clause{Attribute: "plan", Operator: OpIn, Values: []string{"pro"}}, false},
+		{"negated missing attribute", Clause{Attribute: "plan", Operator: OpIn, Values: []string{"pro"}, Negate: true}, false},
+		{"notIn on a missing attribute", Clause{Attribute: "plan", Operator: OpNotIn, Values: []string{"pro"}}, false},
+		{"null attribute", Clause{Attribute: "nothing", Operator: OpIn, Values: []string{""}, Negate: true}, false},
+
+		{"segmentMatch", Clause{Operator: OpSegmentMatch, Values: []string{"alpha", "beta"}}, true},
+		{"segmentMatch unknown segment", Clause{Operator: OpSegmentMatch, Values: []string{"alpha"}}, false},
+		{"negated segmentMatch", Clause{Operator: OpSegmentMatch, Values: []string{"beta"}, Negate: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.clause.Matches(ectx, memberSegments{}); got != tt.want {
+				t.Errorf("%+v matches = %v; want %v", tt.clause, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleMatchesAllClauses(t *testing.T) {
+	ectx := &EvaluationContext{Key: "user-1", Attributes: map[string]any{"country": "GB", "age": float64(36)}}
+	rule := Rule{Clauses: []Clause{
+		{Attribute: "country", Operator: OpIn, Values: []string{"GB"}},
+		{Attribute: "age", Operator: OpGreaterThanOrEqual, Values: []string{"18"}},
+	}}
+	if !rule.Matches(ectx, nil) {
+		t.Error("rule whose clauses all match did not match")
+	}
+	rule.Clauses[1].Negate = true
+	if rule.Matches(ectx, nil) {
+		t.Error("rule matched with a failing clause")
+	}
+}
+
+func TestClauseValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		clause Clause
+		valid  bool
+	}{
+		{"in", Clause{Attribute: "country", Operator: OpIn, Values: []string{"GB"}}, true},
+		{"segmentMatch without attribute", Clause{Operator: OpSegmentMatch, Values: []string{"beta"}}, true},
+		{"regex", Clause{Attribute: "email", Operator: OpMatches, Values: []string{`@example\.com$`}}, true},
+		{"number", Clause{Attribute: "age", Operator: OpLessThan, Values: []string{"-1.5"}}, true},
+		{"semver", Clause{Attribute: "version", Operator: OpSemVerEqual, Values: []string{"v1.2.3-beta.1+build"}}, true},
+		{"date", Clause{Attribute: "signedUp", Operator: OpAfter, Values: []string{"2024-03-01T12:00:00+01:00"}}, true},
+		{"date in milliseconds", Clause{Attribute: "signedUp", Operator: OpAfter, Values: []string{"1709294400000"}}, true},
+
+		{"no attribute", Clause{Operator: OpIn, Values: []string{"GB"}}, false},
+		{"no values", Clause{Attribute: "country", Operator: OpIn}, false},
+		{"unknown operator", Clause{Attribute: "country", Operator: "like", Values: []string{"G%"}}, false},
+		{"malformed regex", Clause{Attribute: "email", Operator: OpMatches, Values: []string{`[a-`}}, false},
+		{"malformed number", Clause{Attribute: "age", Operator: OpGreaterThan, Values: []string{"18", "old"}}, false},
+		{"malformed semver", Clause{Attribute: "version", Operator: OpSemVerGreaterThan, Values: []string{"1.2.3.4"}}, false},
+		{"non-numeric semver", Clause{Attribute: "version", Operator: OpSemVerGreaterThan, Values: []string{"one.two"}}, false},
+		{"empty semver", Clause{Attribute: "version", Operator: OpSemVerGreaterThan, Values: []string{""}}, false},
+		{"malformed date", Clause{Attribute: "signedUp", Operator: OpBefore, Values: []string{"2024-13-01"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.clause.Validate()
+			if tt.valid && err != nil {
+				t.Errorf("Validate(%+v) = %v; want nil", tt.clause, err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidFlag) {
+				t.Errorf("Validate(%+v) = %v; want ErrInvalidFlag", tt.clause, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package flag
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	ffpb "github.com/julianstephens/feature-flag-service/gen/go/grpc/v1/featureflag.v1"
+	"github.com/julianstephens/feature-flag-service/internal/schema"
+)
+
+var ErrInvalidFlag = errors.New("invalid flag")
+
+type VariationType string
+
+const (
+	VariationBoolean VariationType = "boolean"
+	VariationString  VariationType = "string"
+	VariationNumber  VariationType = "number"
+	VariationJSON    VariationType = "json"
+)
+
+// Variation is one of the values a flag can serve. Value holds the JSON
+// encoding of the value and must match the flag's type.
+type Variation struct {
+	Name        string          `json:"name,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Value       json.RawMessage `json:"value"`
+}
+
+// defaultVariations returns the variations of a plain on/off flag.
+func defaultVariations() []Variation {
+	return []Variation{
+		{Name: "on", Value: json.RawMessage("true")},
+		{Name: "off", Value: json.RawMessage("false")},
+	}
+}
+
+// setVariations applies the variation settings of src to f, falling back to
+// a boolean true/false pair when src has none. The environments src carries
+// then serve true when on and false when off.
+func (f *Flag) setVariations(src *Flag) {
+	f.Schema = src.Schema
+	if len(src.Variations) == 0 {
+		f.Type = VariationBoolean
+		f.Variations = defaultVariations()
+		for _, state := range src.Environments {
+			state.OnVariation = 0
+			state.OffVariation = 1
+		}
+		return
+	}
+	f.Type = src.Type
+	if f.Type == "" {
+		f.Type = VariationBoolean
+	}
+	f.Variations = src.Variations
+}
+
+func (f *Flag) validateVariations() error {
+	if len(f.Variations) == 0 {
+		return fmt.Errorf("%w: at least one variation is required", ErrInvalidFlag)
+	}
+	for i, v := range f.Variations {
+		if err := checkVariationValue(f.Type, v.Value); err != nil {
+			return fmt.Errorf("%w: variation %d: %v", ErrInvalidFlag, i, err)
+		}
+	}
+	if len(f.Schema) == 0 {
+		return nil
+	}
+	if f.Type != VariationJSON {
+		return fmt.Errorf("%w: only json flags can have a schema", ErrInvalidFlag)
+	}
+	sch, err := schema.Compile(f.Schema)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidFlag, err)
+	}
+	for i, v := range f.Variations {
+		if err := sch.Validate(fmt.Sprintf("variations[%d].value", i), v.Value); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidFlag, err)
+		}
+	}
+	return nil
+}
+
+func checkVariationValue(t VariationType, raw json.RawMessage) error {
+	if len(raw) == 0 {
+		return errors.New("value is required")
+	}
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("value is not valid JSON: %v", err)
+	}
+
+	switch t {
+	case VariationBoolean:
+		if _, ok := v.(bool); !ok {
+			return errors.New("value must be a boolean")
+		}
+	case VariationString:
+		if _, ok := v.(string); !ok {
+			return errors.New("value must be a string")
+		}
+	case VariationNumber:
+		if _, ok := v.(json.Number); !ok {
+			return errors.New("value must be a number")
+		}
+	case VariationJSON:
+	default:
+		return fmt.Errorf("unknown variation type %q", t)
+	}
+	return nil
+}
+
+func (v Variation) ToProto() *ffpb.Variation {
+	return &ffpb.Variation{
+		Name:        v.Name,
+		Description: v.Description,
+		Value:       string(v.Value),
+	}
+}
+
+func VariationsFromProto(protoVariations []*ffpb.Variation) []Variation {
+	var variations []Variation
+	for _, v := range protoVariations {
+		variations = append(variations, Variation{
+			Name:        v.Name,
+			Description: v.Description,
+			Value:       json.RawMessage(v.Value),
+		})
+	}
+	return variations
+}
@@ -0,0 +1,64 @@
+package flag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/julianstephens/feature-flag-service/internal/schema"
+)
+
+func TestJSONFlagSchema(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t)
+	banner := json.RawMessage(`{"type": "object", "properties": {"title": {"type": "string"}}, "required": ["title"]}`)
+	variations := func(values ...string) []Variation {
+		out := make([]Variation, len(values))
+		for i, v := range values {
+			out[i] = Variation{Value: json.RawMessage(v)}
+		}
+		return out
+	}
+
+	tests := []struct {
+		name string
+		flag *Flag
+		want error
+		// field is where the single schema violation is expected, if any.
+		field string
+	}{
+		{name: "matching variations", flag: &Flag{Type: VariationJSON, Schema: banner, Variations: variations(`{"title": "Sale"}`, `{"title": ""}`)}},
+		{name: "no schema", flag: &Flag{Type: VariationJSON, Variations: variations(`[1, 2]`, `null`)}},
+		{name: "missing field", flag: &Flag{Type: VariationJSON, Schema: banner, Variations: variations(`{"title": "Sale"}`, `{}`)}, want: ErrInvalidFlag, field: "variations[1].value"},
+		{name: "wrong type", flag: &Flag{Type: VariationJSON, Schema: banner, Variations: variations(`{"title": 7}`)}, want: ErrInvalidFlag, field: "variations[0].value.title"},
+		{name: "invalid schema", flag: &Flag{Type: VariationJSON, Schema: json.RawMessage(`{"type": "banner"}`), Variations: variations(`{}`)}, want: schema.ErrInvalidSchema},
+		{name: "schema on a string flag", flag: &Flag{Type: VariationString, Schema: banner, Variations: variations(`"a"`)}, want: ErrInvalidFlag},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.flag.Name = fmt.Sprintf("banner %d", i)
+			_, err := s.CreateFlag(ctx, "", tt.flag)
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("CreateFlag = %v; want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidFlag) || !errors.Is(err, tt.want) {
+				t.Fatalf("CreateFlag = %v; want ErrInvalidFlag wrapping %v", err, tt.want)
+			}
+			if tt.field == "" {
+				return
+			}
+			var verr *schema.ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("CreateFlag = %v; want a *schema.ValidationError", err)
+			}
+			if len(verr.Violations) != 1 || verr.Violations[0].Field != tt.field {
+				t.Errorf("violations = %+v; want one at %s", verr.Violations, tt.field)
+			}
+		})
+	}
+}
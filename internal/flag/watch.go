@@ -0,0 +1,270 @@
+package flag
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	ffpb "github.com/julianstephens/feature-flag-service/gen/go/grpc/v1/featureflag.v1"
+	"github.com/julianstephens/feature-flag-service/internal/storage"
+)
+
+const (
+	ActionSnapshot = "snapshot"
+	ActionResync   = "resync"
+	ActionCreated  = "created"
+	ActionUpdated  = "updated"
+	ActionDeleted  = "deleted"
+)
+
+const watchRetryInterval = time.Second
+
+// FlagEvent describes a single change to a flag as seen by a watcher.
+// Revision is the store revision of the change and can be handed back to
+// WatchFlags to resume after it. A resync event carries no flag and tells the
+// client to drop its local state before the snapshot that follows.
+type FlagEvent struct {
+	Action   string `json:"action"`
+	Flag     *Flag  `json:"flag,omitempty"`
+	Revision int64  `json:"revision"`
+}
+
+func (e *FlagEvent) ToProto() *ffpb.FlagUpdate {
+	update := &ffpb.FlagUpdate{
+		Action:   e.Action,
+		Revision: e.Revision,
+	}
+	if e.Flag != nil {
+		update.Flag = e.Flag.ToProto()
+	}
+	return update
+}
+
+// Scoped returns the event with its flag narrowed down to env.
+func (e *FlagEvent) Scoped(env string) *FlagEvent {
+	if e.Flag == nil {
+		return e
+	}
+	scoped := *e
+	scoped.Flag = e.Flag.Scoped(env)
+	return &scoped
+}
+
+// WatchFlags sends a snapshot of every flag of a project followed by a live
+// feed of changes. When revision is non-zero the snapshot is skipped and every
+// change after that revision is replayed instead; if the revision has already
+// been compacted a resync marker and a fresh snapshot are sent. The returned
+// channel is closed once ctx is done.
+func (s *FlagService) WatchFlags(ctx context.Context, project string, revision int64) (<-chan *FlagEvent, error) {
+	if _, err := s.projects.GetProject(ctx, s.projectKey(project)); err != nil {
+		return nil, err
+	}
+	w := &flagWatcher{
+		svc:    s,
+		prefix: s.projectPrefix(project),
+		events: make(chan *FlagEvent),
+		known:  make(map[string]*storage.KeyValue),
+	}
+
+	if revision > 0 {
+		go w.run(ctx, revision)
+		return w.events, nil
+	}
+
+	snapshot, err := s.store.List(ctx, w.prefix, storage.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		if w.snapshot(ctx, byKey(snapshot.KVs), snapshot.Revision, false) {
+			w.run(ctx, snapshot.Revision)
+			return
+		}
+		close(w.events)
+	}()
+	return w.events, nil
+}
+
+type flagWatcher struct {
+	svc    *FlagService
+	prefix string
+	events chan *FlagEvent
+	// known mirrors what the client has been told so far. It is only complete
+	// once the client has received a snapshot from this watcher, at which
+	// point a compaction can be recovered by replaying the differences.
+	known    map[string]*storage.KeyValue
+	complete bool
+}
+
+func (w *flagWatcher) run(ctx context.Context, rev int64) {
+	defer close(w.events)
+
+	for {
+		next, compacted := w.follow(ctx, rev)
+		if ctx.Err() != nil {
+			return
+		}
+		rev = next
+
+		if compacted {
+			current, err := w.svc.store.List(ctx, w.prefix, storage.ListOptions{})
+			if err == nil {
+				var ok bool
+				if w.complete {
+					ok = w.replay(ctx, byKey(current.KVs), current.Revision)
+				} else {
+					ok = w.snapshot(ctx, byKey(current.KVs), current.Revision, true)
+				}
+				if !ok {
+					return
+				}
+				rev = current.Revision
+				continue
+			}
+			log.Printf("error resyncing flag watch: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(watchRetryInterval):
+		}
+	}
+}
+
+// follow consumes a single store watch starting after rev. It returns the last
+// revision delivered and whether the client must be resynced, because the
+// watch was cut short by compaction or rev is ahead of the store.
+func (w *flagWatcher) follow(ctx context.Context, rev int64) (int64, bool) {
+	for resp := range w.svc.store.Watch(ctx, w.prefix, rev+1) {
+		if resp.CompactRevision != 0 {
+			log.Printf("flag watch compacted at revision %d, resyncing", resp.CompactRevision)
+			return rev, true
+		}
+		if errors.Is(resp.Err, storage.ErrFutureRevision) {
+			// Resumed from a revision this store never reached, such as one
+			// handed out before a memory store was restarted.
+			log.Printf("flag watch from revision %d is ahead of the store, resyncing", rev+1)
+			return rev, true
+		}
+		if resp.Err != nil {
+			log.Printf("error watching flags: %v", resp.Err)
+			return rev, false
+		}
+
+		for _, ev := range resp.Events {
+			key := ev.KV.Key
+			switch ev.Type {
+			case storage.EventPut:
+				action := ActionUpdated
+				if ev.IsCreate() {
+					action = ActionCreated
+				}
+				w.known[key] = ev.KV
+				if !w.emit(ctx, action, ev.KV, ev.KV.ModRevision) {
+					return rev, false
+				}
+			case storage.EventDelete:
+				prev, ok := w.known[key]
+				if ev.PrevKV != nil {
+					prev, ok = ev.PrevKV, true
+				}
+				delete(w.known, key)
+				if ok && !w.emit(ctx, ActionDeleted, prev, ev.KV.ModRevision) {
+					return rev, false
+				}
+			}
+			rev = ev.KV.ModRevision
+		}
+	}
+	return rev, false
+}
+
+// snapshot sends every flag in current as of rev, preceded by a resync marker
+// when the client already holds state that must be discarded.
+func (w *flagWatcher) snapshot(ctx context.Context, current map[string]*storage.KeyValue, rev int64, resync bool) bool {
+	if resync {
+		select {
+		case w.events <- &FlagEvent{Action: ActionResync, Revision: rev}:
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	w.known = make(map[string]*storage.KeyValue, len(current))
+	for _, key := range sortedKeys(current) {
+		w.known[key] = current[key]
+		if !w.emit(ctx, ActionSnapshot, current[key], rev) {
+			return false
+		}
+	}
+	w.complete = true
+	return true
+}
+
+// replay emits the changes needed to bring known up to date with current.
+func (w *flagWatcher) replay(ctx context.Context, current map[string]*storage.KeyValue, rev int64) bool {
+	for _, key := range sortedKeys(w.known) {
+		if _, ok := current[key]; ok {
+			continue
+		}
+		if !w.emit(ctx, ActionDeleted, w.known[key], rev) {
+			return false
+		}
+		delete(w.known, key)
+	}
+
+	for _, key := range sortedKeys(current) {
+		prev, ok := w.known[key]
+		if ok && prev.ModRevision == current[key].ModRevision {
+			continue
+		}
+		action := ActionUpdated
+		if !ok {
+			action = ActionCreated
+		}
+		w.known[key] = current[key]
+		if !w.emit(ctx, action, current[key], rev) {
+			return false
+		}
+	}
+	return true
+}
+
+// emit sends the flag stored in kv, at the revision it was written, as an
+// event at rev.
+func (w *flagWatcher) emit(ctx context.Context, action string, kv *storage.KeyValue, rev int64) bool {
+	flag, err := ParseFlag([]byte(kv.Value))
+	if err != nil {
+		log.Printf("error unmarshaling flag: %v", err)
+		return true
+	}
+	flag.Revision = kv.ModRevision
+
+	select {
+	case w.events <- &FlagEvent{Action: action, Flag: flag, Revision: rev}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// byKey indexes kvs by key.
+func byKey(kvs []*storage.KeyValue) map[string]*storage.KeyValue {
+	m := make(map[string]*storage.KeyValue, len(kvs))
+	for _, kv := range kvs {
+		m[kv.Key] = kv
+	}
+	return m
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
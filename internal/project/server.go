@@ -0,0 +1,132 @@
+package project
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	ffpb "github.com/julianstephens/feature-flag-service/gen/go/grpc/v1/featureflag.v1"
+)
+
+type ProjectGRPCServer struct {
+	ffpb.UnimplementedProjectServiceServer
+	Service Service
+}
+
+func (s *ProjectGRPCServer) ListProjects(ctx context.Context, req *ffpb.ListProjectsRequest) (*ffpb.ListProjectsResponse, error) {
+	projects, err := s.Service.ListProjects(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	var protoProjects []*ffpb.Project
+	for _, p := range projects {
+		protoProjects = append(protoProjects, p.ToProto())
+	}
+	return &ffpb.ListProjectsResponse{Projects: protoProjects}, nil
+}
+
+func (s *ProjectGRPCServer) GetProject(ctx context.Context, req *ffpb.GetProjectRequest) (*ffpb.Project, error) {
+	project, err := s.Service.GetProject(ctx, req.Key)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return project.ToProto(), nil
+}
+
+func (s *ProjectGRPCServer) CreateProject(ctx context.Context, req *ffpb.CreateProjectRequest) (*ffpb.Project, error) {
+	input := &Project{
+		Key:         req.Key,
+		Name:        req.Name,
+		Description: req.Description,
+	}
+	for _, env := range req.Environments {
+		input.Environments = append(input.Environments, &Environment{Key: env.Key, Name: env.Name})
+	}
+	project, err := s.Service.CreateProject(ctx, input)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return project.ToProto(), nil
+}
+
+func (s *ProjectGRPCServer) UpdateProject(ctx context.Context, req *ffpb.UpdateProjectRequest) (*ffpb.Project, error) {
+	project, err := s.Service.UpdateProject(ctx, req.Key, &Project{
+		Name:        req.Name,
+		Description: req.Description,
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return project.ToProto(), nil
+}
+
+func (s *ProjectGRPCServer) DeleteProject(ctx context.Context, req *ffpb.DeleteProjectRequest) (*ffpb.DeleteProjectResponse, error) {
+	if err := s.Service.DeleteProject(ctx, req.Key); err != nil {
+		return nil, grpcError(err)
+	}
+	return &ffpb.DeleteProjectResponse{}, nil
+}
+
+func (s *ProjectGRPCServer) CreateEnvironment(ctx context.Context, req *ffpb.CreateEnvironmentRequest) (*ffpb.Environment, error) {
+	env, err := s.Service.CreateEnvironment(ctx, req.Project, &Environment{Key: req.Key, Name: req.Name})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return env.ToProto(), nil
+}
+
+func (s *ProjectGRPCServer) UpdateEnvironment(ctx context.Context, req *ffpb.UpdateEnvironmentRequest) (*ffpb.Environment, error) {
+	env, err := s.Service.UpdateEnvironment(ctx, req.Project, req.Key, &Environment{Name: req.Name})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return env.ToProto(), nil
+}
+
+func (s *ProjectGRPCServer) DeleteEnvironment(ctx context.Context, req *ffpb.DeleteEnvironmentRequest) (*ffpb.DeleteEnvironmentResponse, error) {
+	if err := s.Service.DeleteEnvironment(ctx, req.Project, req.Key); err != nil {
+		return nil, grpcError(err)
+	}
+	return &ffpb.DeleteEnvironmentResponse{}, nil
+}
+
+func (p *Project) ToProto() *ffpb.Project {
+	project := &ffpb.Project{
+		Key:         p.Key,
+		Name:        p.Name,
+		Description: p.Description,
+		CreatedAt:   p.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:   p.UpdatedAt.Format(time.RFC3339),
+	}
+	for _, env := range p.Environments {
+		project.Environments = append(project.Environments, env.ToProto())
+	}
+	return project
+}
+
+func (e *Environment) ToProto() *ffpb.Environment {
+	return &ffpb.Environment{
+		Key:       e.Key,
+		Name:      e.Name,
+		CreatedAt: e.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// grpcError maps service errors onto gRPC status codes.
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, ErrProjectNotFound), errors.Is(err, ErrEnvironmentNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrProjectExists), errors.Is(err, ErrEnvironmentExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, ErrProjectNotEmpty), errors.Is(err, ErrProjectConflict):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, ErrInvalidProject):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return err
+	}
+}
@@ -0,0 +1,467 @@
+package project
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/julianstephens/feature-flag-service/internal/audit"
+	"github.com/julianstephens/feature-flag-service/internal/config"
+	"github.com/julianstephens/feature-flag-service/internal/storage"
+)
+
+var (
+	ErrProjectNotFound     = errors.New("project not found")
+	ErrProjectExists       = errors.New("project already exists")
+	ErrProjectNotEmpty     = errors.New("project still has flags")
+	ErrProjectConflict     = errors.New("project was changed concurrently")
+	ErrEnvironmentNotFound = errors.New("environment not found")
+	ErrEnvironmentExists   = errors.New("environment already exists")
+	ErrInvalidProject      = errors.New("invalid project")
+)
+
+var keyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// DefaultEnvironments are created with a project that lists none.
+var DefaultEnvironments = []string{"development", "staging", "production"}
+
+// Project groups flags that share definitions. Each flag carries separate
+// targeting state for every environment of its project.
+type Project struct {
+	Key          string         `json:"key"`
+	Name         string         `json:"name"`
+	Description  string         `json:"description"`
+	Environments []*Environment `json:"environments"`
+	CreatedAt    time.Time      `json:"createdAt"`
+	UpdatedAt    time.Time      `json:"updatedAt"`
+	// Revision is the store revision the project was last written at. It is
+	// set on reads and never stored.
+	Revision int64 `json:"revision,omitempty"`
+}
+
+type Environment struct {
+	Key       string    `json:"key"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type Service interface {
+	CreateProject(ctx context.Context, project *Project) (*Project, error)
+	UpdateProject(ctx context.Context, key string, project *Project) (*Project, error)
+	GetProject(ctx context.Context, key string) (*Project, error)
+	DeleteProject(ctx context.Context, key string) error
+	ListProjects(ctx context.Context) ([]*Project, error)
+	EnsureProject(ctx context.Context, key string) (*Project, error)
+	CreateEnvironment(ctx context.Context, projectKey string, env *Environment) (*Environment, error)
+	UpdateEnvironment(ctx context.Context, projectKey, envKey string, env *Environment) (*Environment, error)
+	GetEnvironment(ctx context.Context, projectKey, envKey string) (*Environment, error)
+	DeleteEnvironment(ctx context.Context, projectKey, envKey string) error
+	FlagGuard(project *Project, create bool) ([]storage.Cmp, []storage.Op)
+}
+
+type ProjectService struct {
+	conf         *config.Config
+	store        storage.Store
+	prefix       string
+	flagPrefix   string
+	markerPrefix string
+	sdkKeyPrefix string
+	audit        audit.Recorder
+}
+
+func NewService(conf *config.Config, store storage.Store, recorder audit.Recorder) Service {
+	return &ProjectService{
+		conf:         conf,
+		store:        store,
+		prefix:       conf.ProjectServicePrefix,
+		flagPrefix:   conf.FlagServicePrefix,
+		markerPrefix: conf.FlagKeyIndexPrefix,
+		sdkKeyPrefix: conf.SDKKeyServicePrefix,
+		audit:        recorder,
+	}
+}
+
+func (s *ProjectService) GetKey(key string) string {
+	return s.prefix + key
+}
+
+// markerKey returns the key every flag creation in a project writes, so that
+// DeleteProject notices flags created after it checked for them. It is kept
+// next to the flag key index; flag keys cannot start with '.', so it never
+// clashes.
+func (s *ProjectService) markerKey(key string) string {
+	return s.markerPrefix + key + "/.flags"
+}
+
+func (s *ProjectService) ListProjects(ctx context.Context) ([]*Project, error) {
+	res, err := s.store.List(ctx, s.prefix, storage.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	projects := make([]*Project, 0, len(res.KVs))
+	for _, kv := range res.KVs {
+		var project Project
+		if err := json.Unmarshal([]byte(kv.Value), &project); err != nil {
+			log.Printf("error unmarshaling project: %v", err)
+			continue
+		}
+		project.Revision = kv.ModRevision
+		projects = append(projects, &project)
+	}
+	sort.Slice(projects, func(i, j int) bool { return projects[i].Key < projects[j].Key })
+	return projects, nil
+}
+
+func (s *ProjectService) GetProject(ctx context.Context, key string) (*Project, error) {
+	resp, err := s.store.Get(ctx, s.GetKey(key))
+	if err != nil {
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			return nil, ErrProjectNotFound
+		}
+		return nil, err
+	}
+
+	var project Project
+	if err := json.Unmarshal([]byte(resp.Value), &project); err != nil {
+		return nil, err
+	}
+	project.Revision = resp.ModRevision
+	return &project, nil
+}
+
+// CreateProject stores a new project with the given environments, or with
+// DefaultEnvironments when it has none.
+func (s *ProjectService) CreateProject(ctx context.Context, input *Project) (*Project, error) {
+	if !keyPattern.MatchString(input.Key) {
+		return nil, fmt.Errorf("%w: key %q must be lowercase letters, digits, '_' or '-'", ErrInvalidProject, input.Key)
+	}
+
+	now := time.Now()
+	project := &Project{
+		Key:         input.Key,
+		Name:        input.Name,
+		Description: input.Description,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	envs := input.Environments
+	if len(envs) == 0 {
+		for _, key := range DefaultEnvironments {
+			envs = append(envs, &Environment{Key: key})
+		}
+	}
+	for _, env := range envs {
+		if project.environment(env.Key) != nil {
+			return nil, fmt.Errorf("%w: %s", ErrEnvironmentExists, env.Key)
+		}
+		if !keyPattern.MatchString(env.Key) {
+			return nil, fmt.Errorf("%w: environment key %q must be lowercase letters, digits, '_' or '-'", ErrInvalidProject, env.Key)
+		}
+		project.Environments = append(project.Environments, &Environment{Key: env.Key, Name: env.Name, CreatedAt: now})
+	}
+
+	if err := s.create(ctx, project); err != nil {
+		return nil, err
+	}
+	audit.Log(ctx, s.audit, audit.Change{Action: audit.ActionCreate, ResourceType: audit.ResourceProject, ResourceID: project.Key, Project: project.Key, After: project})
+	return project, nil
+}
+
+// EnsureProject returns the project, creating it with the default
+// environments if it does not exist yet.
+func (s *ProjectService) EnsureProject(ctx context.Context, key string) (*Project, error) {
+	project, err := s.GetProject(ctx, key)
+	if !errors.Is(err, ErrProjectNotFound) {
+		return project, err
+	}
+	project, err = s.CreateProject(ctx, &Project{Key: key, Name: key})
+	if errors.Is(err, ErrProjectExists) {
+		return s.GetProject(ctx, key)
+	}
+	return project, err
+}
+
+func (s *ProjectService) UpdateProject(ctx context.Context, key string, input *Project) (*Project, error) {
+	project, err := s.GetProject(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	before := audit.Snapshot(project)
+
+	project.Name = input.Name
+	project.Description = input.Description
+	if err := s.save(ctx, project, nil); err != nil {
+		return nil, err
+	}
+	audit.Log(ctx, s.audit, audit.Change{Action: audit.ActionUpdate, ResourceType: audit.ResourceProject, ResourceID: project.Key, Project: project.Key, Before: before, After: project})
+	return project, nil
+}
+
+// DeleteProject removes a project that no longer has any flags, along with
+// the SDK keys of its environments. It fails with ErrProjectConflict when the
+// project changed or a flag was created in it while it was being deleted.
+func (s *ProjectService) DeleteProject(ctx context.Context, key string) error {
+	var markerRev int64
+	marker, err := s.store.Get(ctx, s.markerKey(key))
+	if err == nil {
+		markerRev = marker.ModRevision
+	} else if !errors.Is(err, storage.ErrKeyNotFound) {
+		return err
+	}
+	project, err := s.GetProject(ctx, key)
+	if err != nil {
+		return err
+	}
+	res, err := s.store.List(ctx, s.flagPrefix+key+"/", storage.ListOptions{})
+	if err != nil {
+		return err
+	}
+	if len(res.KVs) > 0 {
+		return fmt.Errorf("%w: %d flags", ErrProjectNotEmpty, len(res.KVs))
+	}
+
+	ops, err := s.deleteSDKKeys(ctx, key, "")
+	if err != nil {
+		return err
+	}
+	ops = append(ops, storage.Delete(s.GetKey(key)))
+	if markerRev != 0 {
+		ops = append(ops, storage.Delete(s.markerKey(key)))
+	}
+	cmps := []storage.Cmp{storage.AtRevision(s.GetKey(key), project.Revision), storage.AtRevision(s.markerKey(key), markerRev)}
+	resp, err := s.store.Txn(ctx, cmps, ops...)
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return fmt.Errorf("%w: %s was modified while it was deleted", ErrProjectConflict, key)
+	}
+	audit.Log(ctx, s.audit, audit.Change{Action: audit.ActionDelete, ResourceType: audit.ResourceProject, ResourceID: key, Project: key, Before: project})
+	return nil
+}
+
+func (s *ProjectService) GetEnvironment(ctx context.Context, projectKey, envKey string) (*Environment, error) {
+	project, err := s.GetProject(ctx, projectKey)
+	if err != nil {
+		return nil, err
+	}
+	env := project.environment(envKey)
+	if env == nil {
+		return nil, ErrEnvironmentNotFound
+	}
+	return env, nil
+}
+
+// CreateEnvironment adds an environment to a project. Flags start out off in
+// the new environment until their state there is set.
+func (s *ProjectService) CreateEnvironment(ctx context.Context, projectKey string, input *Environment) (*Environment, error) {
+	if !keyPattern.MatchString(input.Key) {
+		return nil, fmt.Errorf("%w: environment key %q must be lowercase letters, digits, '_' or '-'", ErrInvalidProject, input.Key)
+	}
+	project, err := s.GetProject(ctx, projectKey)
+	if err != nil {
+		return nil, err
+	}
+	if project.environment(input.Key) != nil {
+		return nil, fmt.Errorf("%w: %s", ErrEnvironmentExists, input.Key)
+	}
+
+	env := &Environment{Key: input.Key, Name: input.Name, CreatedAt: time.Now()}
+	project.Environments = append(project.Environments, env)
+	if err := s.save(ctx, project, nil); err != nil {
+		return nil, err
+	}
+	audit.Log(ctx, s.audit, audit.Change{Action: audit.ActionCreate, ResourceType: audit.ResourceEnvironment, ResourceID: env.Key, Project: projectKey, Environment: env.Key, After: env})
+	return env, nil
+}
+
+func (s *ProjectService) UpdateEnvironment(ctx context.Context, projectKey, envKey string, input *Environment) (*Environment, error) {
+	project, err := s.GetProject(ctx, projectKey)
+	if err != nil {
+		return nil, err
+	}
+	env := project.environment(envKey)
+	if env == nil {
+		return nil, ErrEnvironmentNotFound
+	}
+	before := audit.Snapshot(env)
+
+	env.Name = input.Name
+	if err := s.save(ctx, project, nil); err != nil {
+		return nil, err
+	}
+	audit.Log(ctx, s.audit, audit.Change{Action: audit.ActionUpdate, ResourceType: audit.ResourceEnvironment, ResourceID: env.Key, Project: projectKey, Environment: env.Key, Before: before, After: env})
+	return env, nil
+}
+
+// DeleteEnvironment removes an environment from a project together with its
+// SDK keys and the state every flag of the project keeps for it, so an
+// environment created later with the same key starts out clean.
+func (s *ProjectService) DeleteEnvironment(ctx context.Context, projectKey, envKey string) error {
+	project, err := s.GetProject(ctx, projectKey)
+	if err != nil {
+		return err
+	}
+	for i, env := range project.Environments {
+		if env.Key == envKey {
+			project.Environments = append(project.Environments[:i], project.Environments[i+1:]...)
+			ops, err := s.deleteSDKKeys(ctx, projectKey, envKey)
+			if err != nil {
+				return err
+			}
+			cmps, states, err := s.deleteFlagStates(ctx, projectKey, envKey)
+			if err != nil {
+				return err
+			}
+			if err := s.save(ctx, project, cmps, append(ops, states...)...); err != nil {
+				return err
+			}
+			audit.Log(ctx, s.audit, audit.Change{Action: audit.ActionDelete, ResourceType: audit.ResourceEnvironment, ResourceID: envKey, Project: projectKey, Environment: envKey, Before: env})
+			return nil
+		}
+	}
+	return ErrEnvironmentNotFound
+}
+
+// sdkKeyScope is the part of a stored SDK key needed to find the keys of an
+// environment; the keys themselves are managed by the auth package.
+type sdkKeyScope struct {
+	Project     string `json:"project"`
+	Environment string `json:"environment"`
+}
+
+// deleteSDKKeys returns the deletes of the SDK keys issued for env, or for
+// every environment of the project when env is empty.
+func (s *ProjectService) deleteSDKKeys(ctx context.Context, projectKey, env string) ([]storage.Op, error) {
+	res, err := s.store.List(ctx, s.sdkKeyPrefix, storage.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var ops []storage.Op
+	for _, kv := range res.KVs {
+		var scope sdkKeyScope
+		if err := json.Unmarshal([]byte(kv.Value), &scope); err != nil {
+			log.Printf("error unmarshaling sdk key: %v", err)
+			continue
+		}
+		if scope.Project == projectKey && (env == "" || scope.Environment == env) {
+			ops = append(ops, storage.Delete(kv.Key))
+		}
+	}
+	return ops, nil
+}
+
+// deleteFlagStates returns the writes that drop the state flags of a project
+// keep for env, each guarded on the revision the flag was read at. Only the
+// environments of a stored flag are touched; the flags themselves are
+// managed by the flag package.
+func (s *ProjectService) deleteFlagStates(ctx context.Context, projectKey, env string) ([]storage.Cmp, []storage.Op, error) {
+	res, err := s.store.List(ctx, s.flagPrefix+projectKey+"/", storage.ListOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	var cmps []storage.Cmp
+	var ops []storage.Op
+	for _, kv := range res.KVs {
+		var stored map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(kv.Value), &stored); err != nil {
+			log.Printf("error unmarshaling flag: %v", err)
+			continue
+		}
+		var states map[string]json.RawMessage
+		if err := json.Unmarshal(stored["environments"], &states); err != nil || states == nil {
+			continue
+		}
+		if _, ok := states[env]; !ok {
+			continue
+		}
+		delete(states, env)
+		if stored["environments"], err = json.Marshal(states); err != nil {
+			return nil, nil, err
+		}
+		data, err := json.Marshal(stored)
+		if err != nil {
+			return nil, nil, err
+		}
+		cmps = append(cmps, storage.AtRevision(kv.Key, kv.ModRevision))
+		ops = append(ops, storage.Put(kv.Key, string(data)))
+	}
+	return cmps, ops, nil
+}
+
+// FlagGuard returns what a transaction writing flag state in project must
+// include: a compare that fails once the project has changed since it was
+// read, so no flag is written for a deleted project or with state for a
+// deleted environment, and, when the write creates a flag, the write that
+// DeleteProject checks for.
+func (s *ProjectService) FlagGuard(project *Project, create bool) ([]storage.Cmp, []storage.Op) {
+	cmps := []storage.Cmp{storage.AtRevision(s.GetKey(project.Key), project.Revision)}
+	if !create {
+		return cmps, nil
+	}
+	return cmps, []storage.Op{storage.Put(s.markerKey(project.Key), project.Key)}
+}
+
+func (s *ProjectService) create(ctx context.Context, project *Project) error {
+	data, err := json.Marshal(project)
+	if err != nil {
+		return err
+	}
+
+	key := s.GetKey(project.Key)
+	resp, err := s.store.Txn(ctx, []storage.Cmp{storage.Absent(key)}, storage.Put(key, string(data)))
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return fmt.Errorf("%w: %s", ErrProjectExists, project.Key)
+	}
+	project.Revision = resp.Revision
+	return nil
+}
+
+// save writes project, along with any other cmps and ops in the same
+// transaction. The write only succeeds while the project is still at the
+// revision it was read at; it fails with ErrProjectConflict when another
+// write came first.
+func (s *ProjectService) save(ctx context.Context, project *Project, cmps []storage.Cmp, ops ...storage.Op) error {
+	project.UpdatedAt = time.Now()
+	stored := *project
+	stored.Revision = 0
+	data, err := json.Marshal(&stored)
+	if err != nil {
+		return err
+	}
+	key := s.GetKey(project.Key)
+	cmps = append(cmps, storage.AtRevision(key, project.Revision))
+	resp, err := s.store.Txn(ctx, cmps, append(ops, storage.Put(key, string(data)))...)
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return fmt.Errorf("%w: %s was modified since revision %d", ErrProjectConflict, project.Key, project.Revision)
+	}
+	project.Revision = resp.Revision
+	return nil
+}
+
+func (p *Project) environment(key string) *Environment {
+	for _, env := range p.Environments {
+		if env.Key == key {
+			return env
+		}
+	}
+	return nil
+}
+
+// HasEnvironment reports whether the project has an environment with the
+// given key.
+func (p *Project) HasEnvironment(key string) bool {
+	return p.environment(key) != nil
+}
@@ -0,0 +1,164 @@
+package project
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/julianstephens/feature-flag-service/internal/config"
+	"github.com/julianstephens/feature-flag-service/internal/storage"
+)
+
+// racyStore runs beforeTxn once, just before the first transaction, to
+// stand in for a concurrent write.
+type racyStore struct {
+	storage.Store
+	beforeTxn func()
+}
+
+func (s *racyStore) Txn(ctx context.Context, cmps []storage.Cmp, ops ...storage.Op) (*storage.TxnResult, error) {
+	if hook := s.beforeTxn; hook != nil {
+		s.beforeTxn = nil
+		hook()
+	}
+	return s.Store.Txn(ctx, cmps, ops...)
+}
+
+func newTestService(t *testing.T) (*ProjectService, *racyStore) {
+	t.Helper()
+	conf := &config.Config{
+		FlagServicePrefix:    "/featureflags/",
+		FlagKeyIndexPrefix:   "/featureflag-keys/",
+		ProjectServicePrefix: "/projects/",
+		SDKKeyServicePrefix:  "/sdkkeys/",
+	}
+	store := &racyStore{Store: storage.NewMemoryStore()}
+	t.Cleanup(func() { store.Close() })
+	s := NewService(conf, store, nil).(*ProjectService)
+	if _, err := s.CreateProject(context.Background(), &Project{Key: "shop"}); err != nil {
+		t.Fatal(err)
+	}
+	return s, store
+}
+
+func TestConcurrentEnvironmentsConflict(t *testing.T) {
+	ctx := context.Background()
+	s, store := newTestService(t)
+
+	store.beforeTxn = func() {
+		if _, err := s.CreateEnvironment(ctx, "shop", &Environment{Key: "uat"}); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := s.CreateEnvironment(ctx, "shop", &Environment{Key: "qa"}); !errors.Is(err, ErrProjectConflict) {
+		t.Fatalf("CreateEnvironment racing another: err = %v; want ErrProjectConflict", err)
+	}
+	project, err := s.GetProject(ctx, "shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !project.HasEnvironment("uat") || project.HasEnvironment("qa") {
+		t.Errorf("environments = %v; want uat kept and qa rejected", project.Environments)
+	}
+
+	if _, err := s.CreateEnvironment(ctx, "shop", &Environment{Key: "qa"}); err != nil {
+		t.Fatalf("retried CreateEnvironment: %v", err)
+	}
+	if project, _ := s.GetProject(ctx, "shop"); !project.HasEnvironment("uat") || !project.HasEnvironment("qa") {
+		t.Errorf("environments = %v; want both uat and qa", project.Environments)
+	}
+}
+
+func TestDeleteEnvironmentDropsFlagState(t *testing.T) {
+	ctx := context.Background()
+	s, store := newTestService(t)
+
+	flagKey := s.flagPrefix + "shop/7c9e6679-7425-40de-944b-e07fc1f90ae7"
+	stored := `{"id":"7c9e6679-7425-40de-944b-e07fc1f90ae7","name":"beta","version":3,` +
+		`"environments":{"staging":{"enabled":true,"onVariation":0,"offVariation":1},"production":{"enabled":false,"onVariation":0,"offVariation":1}}}`
+	if _, err := store.Put(ctx, flagKey, stored); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.DeleteEnvironment(ctx, "shop", "staging"); err != nil {
+		t.Fatal(err)
+	}
+	kv, err := store.Get(ctx, flagKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var flag struct {
+		Name         string                     `json:"name"`
+		Version      int64                      `json:"version"`
+		Environments map[string]json.RawMessage `json:"environments"`
+	}
+	if err := json.Unmarshal([]byte(kv.Value), &flag); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := flag.Environments["staging"]; ok {
+		t.Error("flag kept its state for the deleted environment")
+	}
+	if _, ok := flag.Environments["production"]; !ok || flag.Name != "beta" || flag.Version != 3 {
+		t.Errorf("flag = %s; want everything but the staging state kept", kv.Value)
+	}
+
+	// A flag written in between keeps the deletion from going through.
+	store.beforeTxn = func() {
+		if _, err := store.Put(ctx, flagKey, stored); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := s.DeleteEnvironment(ctx, "shop", "production"); !errors.Is(err, ErrProjectConflict) {
+		t.Errorf("DeleteEnvironment racing a flag write: err = %v; want ErrProjectConflict", err)
+	}
+	if project, _ := s.GetProject(ctx, "shop"); !project.HasEnvironment("production") {
+		t.Error("production deleted despite the conflict")
+	}
+}
+
+func TestDeleteProjectRacesFlagCreation(t *testing.T) {
+	ctx := context.Background()
+	s, store := newTestService(t)
+
+	project, err := s.GetProject(ctx, "shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.beforeTxn = func() {
+		cmps, ops := s.FlagGuard(project, true)
+		ops = append(ops, storage.Put(s.flagPrefix+"shop/7c9e6679-7425-40de-944b-e07fc1f90ae7", "{}"))
+		if res, err := store.Store.Txn(ctx, cmps, ops...); err != nil || !res.Succeeded {
+			t.Errorf("creating a flag: %+v, %v", res, err)
+		}
+	}
+	if err := s.DeleteProject(ctx, "shop"); !errors.Is(err, ErrProjectConflict) {
+		t.Fatalf("DeleteProject racing a flag creation: err = %v; want ErrProjectConflict", err)
+	}
+	if _, err := s.GetProject(ctx, "shop"); err != nil {
+		t.Errorf("project deleted despite the new flag: %v", err)
+	}
+	if err := s.DeleteProject(ctx, "shop"); !errors.Is(err, ErrProjectNotEmpty) {
+		t.Errorf("retried DeleteProject: err = %v; want ErrProjectNotEmpty", err)
+	}
+
+	// Once the project is gone, a flag write based on it fails.
+	if err := store.Delete(ctx, s.flagPrefix+"shop/7c9e6679-7425-40de-944b-e07fc1f90ae7"); err != nil {
+		t.Fatal(err)
+	}
+	project, err = s.GetProject(ctx, "shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteProject(ctx, "shop"); err != nil {
+		t.Fatal(err)
+	}
+	cmps, ops := s.FlagGuard(project, true)
+	res, err := store.Txn(ctx, cmps, append(ops, storage.Put(s.flagPrefix+"shop/orphan", "{}"))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Succeeded {
+		t.Error("flag created in a deleted project")
+	}
+}
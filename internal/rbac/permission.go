@@ -0,0 +1,90 @@
+package rbac
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	ResourceFlags    = "flags"
+	ResourceSegments = "segments"
+	ResourceProjects = "projects"
+	ResourceSDKKeys  = "sdkkeys"
+	ResourceConfig   = "config"
+	ResourceAudit    = "audit"
+	ResourceRBAC     = "rbac"
+
+	ActionRead  = "read"
+	ActionWrite = "write"
+
+	// Any matches every resource, action, project or environment.
+	Any = "*"
+)
+
+var resources = []string{ResourceFlags, ResourceSegments, ResourceProjects, ResourceSDKKeys, ResourceConfig, ResourceAudit, ResourceRBAC, Any}
+
+// Permission allows an action on a resource, optionally limited to one
+// project and environment. It is written resource:action[:project[:env]],
+// e.g. flags:write:web:staging; "*" alone grants everything.
+type Permission struct {
+	Resource    string
+	Action      string
+	Project     string
+	Environment string
+}
+
+func ParsePermission(s string) (Permission, error) {
+	if s == Any {
+		return Permission{Resource: Any, Action: Any, Project: Any, Environment: Any}, nil
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 4 {
+		return Permission{}, fmt.Errorf("%w: permission %q must be resource:action[:project[:environment]]", ErrInvalidRole, s)
+	}
+	p := Permission{Resource: parts[0], Action: parts[1], Project: Any, Environment: Any}
+	if len(parts) > 2 {
+		p.Project = parts[2]
+	}
+	if len(parts) > 3 {
+		p.Environment = parts[3]
+	}
+
+	if !slices.Contains(resources, p.Resource) {
+		return Permission{}, fmt.Errorf("%w: unknown resource %q in permission %q", ErrInvalidRole, p.Resource, s)
+	}
+	if p.Action != ActionRead && p.Action != ActionWrite && p.Action != Any {
+		return Permission{}, fmt.Errorf("%w: unknown action %q in permission %q", ErrInvalidRole, p.Action, s)
+	}
+	if p.Project == "" || p.Environment == "" {
+		return Permission{}, fmt.Errorf("%w: empty scope in permission %q", ErrInvalidRole, s)
+	}
+	return p, nil
+}
+
+func (p Permission) String() string {
+	if p.Resource == Any && p.Action == Any && p.Project == Any && p.Environment == Any {
+		return Any
+	}
+	s := p.Resource + ":" + p.Action
+	switch {
+	case p.Environment != Any && p.Environment != "":
+		s += ":" + p.Project + ":" + p.Environment
+	case p.Project != Any && p.Project != "":
+		s += ":" + p.Project
+	}
+	return s
+}
+
+// Grants reports whether holding p allows want. Write implies read, and an
+// empty project or environment in want can only be granted by "*".
+func (p Permission) Grants(want Permission) bool {
+	match := func(have, want string) bool { return have == Any || have == want }
+	if !match(p.Resource, want.Resource) {
+		return false
+	}
+	if !match(p.Action, want.Action) && !(p.Action == ActionWrite && want.Action == ActionRead) {
+		return false
+	}
+	return match(p.Project, want.Project) && match(p.Environment, want.Environment)
+}
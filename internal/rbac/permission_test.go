@@ -0,0 +1,101 @@
+package rbac
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPermissionGrants(t *testing.T) {
+	flagsRead := func(project, env string) Permission {
+		return Permission{Resource: ResourceFlags, Action: ActionRead, Project: project, Environment: env}
+	}
+	flagsWrite := func(project, env string) Permission {
+		return Permission{Resource: ResourceFlags, Action: ActionWrite, Project: project, Environment: env}
+	}
+
+	tests := []struct {
+		have string
+		want Permission
+		ok   bool
+	}{
+		// "*" alone grants everything, including unscoped requests.
+		{"*", flagsWrite("web", "staging"), true},
+		{"*", Permission{Resource: ResourceRBAC, Action: ActionWrite}, true},
+
+		// Resource and action wildcards.
+		{"*:read", Permission{Resource: ResourceConfig, Action: ActionRead}, true},
+		{"*:read", Permission{Resource: ResourceConfig, Action: ActionWrite}, false},
+		{"flags:*", flagsWrite("web", "staging"), true},
+		{"flags:*", Permission{Resource: ResourceSegments, Action: ActionRead}, false},
+
+		// Write implies read, not the other way round.
+		{"flags:write", flagsRead("web", "staging"), true},
+		{"flags:read", flagsRead("web", "staging"), true},
+		{"flags:read", flagsWrite("web", "staging"), false},
+		{"segments:write", flagsRead("web", "staging"), false},
+
+		// An unscoped grant covers every project and environment.
+		{"flags:read", flagsRead("", ""), true},
+		{"flags:read", flagsRead("web", ""), true},
+		{"flags:write:*:*", flagsWrite("web", "staging"), true},
+
+		// A project grant covers its environments only.
+		{"flags:write:web", flagsWrite("web", "staging"), true},
+		{"flags:write:web", flagsWrite("web", ""), true},
+		{"flags:write:web", flagsWrite("api", "staging"), false},
+		{"flags:write:web", flagsWrite("", ""), false},
+
+		// An environment grant covers that environment only.
+		{"flags:write:web:staging", flagsWrite("web", "staging"), true},
+		{"flags:write:web:staging", flagsRead("web", "staging"), true},
+		{"flags:write:web:staging", flagsWrite("web", "production"), false},
+		{"flags:write:web:staging", flagsWrite("api", "staging"), false},
+		{"flags:write:web:staging", flagsWrite("web", ""), false},
+		{"flags:write:*:staging", flagsWrite("api", "staging"), true},
+		{"flags:write:*:staging", flagsWrite("api", "production"), false},
+
+		// Scopes are matched exactly.
+		{"flags:read:web", flagsRead("Web", ""), false},
+		{"flags:read:web", flagsRead("web-eu", ""), false},
+	}
+	for _, tt := range tests {
+		have, err := ParsePermission(tt.have)
+		if err != nil {
+			t.Fatalf("ParsePermission(%q): %v", tt.have, err)
+		}
+		if got := have.Grants(tt.want); got != tt.ok {
+			t.Errorf("%s grants %+v = %v; want %v", tt.have, tt.want, got, tt.ok)
+		}
+	}
+}
+
+func TestParsePermission(t *testing.T) {
+	valid := []struct {
+		in   string
+		want Permission
+	}{
+		{"*", Permission{Resource: Any, Action: Any, Project: Any, Environment: Any}},
+		{"flags:read", Permission{Resource: ResourceFlags, Action: ActionRead, Project: Any, Environment: Any}},
+		{"sdkkeys:write:web", Permission{Resource: ResourceSDKKeys, Action: ActionWrite, Project: "web", Environment: Any}},
+		{"flags:write:web:staging", Permission{Resource: ResourceFlags, Action: ActionWrite, Project: "web", Environment: "staging"}},
+	}
+	for _, tt := range valid {
+		got, err := ParsePermission(tt.in)
+		if err != nil {
+			t.Errorf("ParsePermission(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParsePermission(%q) = %+v; want %+v", tt.in, got, tt.want)
+		}
+		if s := got.String(); s != tt.in {
+			t.Errorf("ParsePermission(%q).String() = %q", tt.in, s)
+		}
+	}
+
+	for _, in := range []string{"", "flags", "flags:read:web:staging:extra", "widgets:read", "flags:delete", "flags:read::staging", "flags:read:web:"} {
+		if _, err := ParsePermission(in); !errors.Is(err, ErrInvalidRole) {
+			t.Errorf("ParsePermission(%q): err = %v; want ErrInvalidRole", in, err)
+		}
+	}
+}
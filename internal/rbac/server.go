@@ -0,0 +1,187 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	ffpb "github.com/julianstephens/feature-flag-service/gen/go/grpc/v1/featureflag.v1"
+	"github.com/julianstephens/feature-flag-service/internal/auth"
+)
+
+type RBACGRPCServer struct {
+	ffpb.UnimplementedRBACServiceServer
+	Service Service
+}
+
+func (s *RBACGRPCServer) ListRoles(ctx context.Context, req *ffpb.ListRolesRequest) (*ffpb.ListRolesResponse, error) {
+	roles, err := s.Service.ListRoles(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return rolesToProto(roles), nil
+}
+
+func (s *RBACGRPCServer) GetRole(ctx context.Context, req *ffpb.GetRoleRequest) (*ffpb.Role, error) {
+	role, err := s.Service.GetRole(ctx, req.Id)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return role.ToProto(), nil
+}
+
+func (s *RBACGRPCServer) CreateRole(ctx context.Context, req *ffpb.CreateRoleRequest) (*ffpb.Role, error) {
+	role, err := s.Service.CreateRole(ctx, &Role{
+		Name:        req.Name,
+		Description: req.Description,
+		Permissions: req.Permissions,
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return role.ToProto(), nil
+}
+
+func (s *RBACGRPCServer) UpdateRole(ctx context.Context, req *ffpb.UpdateRoleRequest) (*ffpb.Role, error) {
+	update := &RoleUpdate{Name: req.Name, Description: req.Description}
+	if req.SetPermissions {
+		update.Permissions = append([]string{}, req.Permissions...)
+	}
+	role, err := s.Service.UpdateRole(ctx, req.Id, update)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return role.ToProto(), nil
+}
+
+func (s *RBACGRPCServer) DeleteRole(ctx context.Context, req *ffpb.DeleteRoleRequest) (*ffpb.DeleteRoleResponse, error) {
+	if err := s.Service.DeleteRole(ctx, req.Id); err != nil {
+		return nil, grpcError(err)
+	}
+	return &ffpb.DeleteRoleResponse{}, nil
+}
+
+func (s *RBACGRPCServer) ListUsers(ctx context.Context, req *ffpb.ListUsersRequest) (*ffpb.ListUsersResponse, error) {
+	users, err := s.Service.ListUsers(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	var protoUsers []*ffpb.User
+	for _, u := range users {
+		protoUsers = append(protoUsers, u.ToProto())
+	}
+	return &ffpb.ListUsersResponse{Users: protoUsers}, nil
+}
+
+func (s *RBACGRPCServer) GetUser(ctx context.Context, req *ffpb.GetUserRequest) (*ffpb.User, error) {
+	user, err := s.Service.GetUser(ctx, req.Id)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return user.ToProto(), nil
+}
+
+func (s *RBACGRPCServer) CreateUser(ctx context.Context, req *ffpb.CreateUserRequest) (*ffpb.User, error) {
+	user, err := s.Service.CreateUser(ctx, &User{
+		Username: req.Username,
+		Email:    req.Email,
+		FullName: req.FullName,
+		Active:   req.Active == nil || *req.Active,
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return user.ToProto(), nil
+}
+
+func (s *RBACGRPCServer) UpdateUser(ctx context.Context, req *ffpb.UpdateUserRequest) (*ffpb.User, error) {
+	user, err := s.Service.UpdateUser(ctx, req.Id, &UserUpdate{
+		Username: req.Username,
+		Email:    req.Email,
+		FullName: req.FullName,
+		Active:   req.Active,
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return user.ToProto(), nil
+}
+
+func (s *RBACGRPCServer) DeleteUser(ctx context.Context, req *ffpb.DeleteUserRequest) (*ffpb.DeleteUserResponse, error) {
+	if err := s.Service.DeleteUser(ctx, req.Id); err != nil {
+		return nil, grpcError(err)
+	}
+	return &ffpb.DeleteUserResponse{}, nil
+}
+
+func (s *RBACGRPCServer) ListUserRoles(ctx context.Context, req *ffpb.ListUserRolesRequest) (*ffpb.ListRolesResponse, error) {
+	roles, err := s.Service.ListUserRoles(ctx, req.UserId)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return rolesToProto(roles), nil
+}
+
+func (s *RBACGRPCServer) AssignRole(ctx context.Context, req *ffpb.AssignRoleRequest) (*ffpb.AssignRoleResponse, error) {
+	if err := s.Service.AssignRole(ctx, req.UserId, req.RoleId); err != nil {
+		return nil, grpcError(err)
+	}
+	return &ffpb.AssignRoleResponse{}, nil
+}
+
+func (s *RBACGRPCServer) RemoveRole(ctx context.Context, req *ffpb.RemoveRoleRequest) (*ffpb.RemoveRoleResponse, error) {
+	if err := s.Service.RemoveRole(ctx, req.UserId, req.RoleId); err != nil {
+		return nil, grpcError(err)
+	}
+	return &ffpb.RemoveRoleResponse{}, nil
+}
+
+func (r *Role) ToProto() *ffpb.Role {
+	return &ffpb.Role{
+		Id:          r.ID,
+		Name:        r.Name,
+		Description: r.Description,
+		Permissions: r.Permissions,
+		CreatedAt:   r.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:   r.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+func (u *User) ToProto() *ffpb.User {
+	return &ffpb.User{
+		Id:        u.ID,
+		Username:  u.Username,
+		Email:     u.Email,
+		FullName:  u.FullName,
+		Active:    u.Active,
+		CreatedAt: u.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: u.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+func rolesToProto(roles []*Role) *ffpb.ListRolesResponse {
+	res := &ffpb.ListRolesResponse{}
+	for _, r := range roles {
+		res.Roles = append(res.Roles, r.ToProto())
+	}
+	return res
+}
+
+// grpcError maps service errors onto gRPC status codes.
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, ErrRoleNotFound), errors.Is(err, ErrUserNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrRoleExists), errors.Is(err, ErrUserExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, ErrInvalidRole), errors.Is(err, ErrInvalidUser):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, auth.ErrForbidden):
+		return status.Error(codes.PermissionDenied, err.Error())
+	default:
+		return err
+	}
+}
@@ -0,0 +1,507 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/julianstephens/feature-flag-service/internal/audit"
+	"github.com/julianstephens/feature-flag-service/internal/auth"
+	"github.com/julianstephens/feature-flag-service/internal/config"
+	"github.com/julianstephens/feature-flag-service/internal/utils"
+)
+
+var (
+	ErrRoleNotFound = errors.New("role not found")
+	ErrRoleExists   = errors.New("role already exists")
+	ErrInvalidRole  = errors.New("invalid role")
+	ErrUserNotFound = errors.New("user not found")
+	ErrUserExists   = errors.New("user already exists")
+	ErrInvalidUser  = errors.New("invalid user")
+)
+
+// AdminRole is seeded by the migrations with every permission.
+const AdminRole = "admin"
+
+// pgUniqueViolation is the Postgres error code for a duplicate key.
+const pgUniqueViolation = "23505"
+
+type Role struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// RoleUpdate changes the fields of a role that are set.
+type RoleUpdate struct {
+	Name        *string  `json:"name,omitempty"`
+	Description *string  `json:"description,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+}
+
+// User is matched to a JWT by its email claim, or by username against the
+// subject when the token carries no email.
+type User struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	FullName  string    `json:"fullName"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// roleAssignment is the audit snapshot of a user holding a role.
+type roleAssignment struct {
+	UserID   string `json:"userId"`
+	RoleID   string `json:"roleId"`
+	RoleName string `json:"roleName,omitempty"`
+}
+
+// UserUpdate changes the fields of a user that are set.
+type UserUpdate struct {
+	Username *string `json:"username,omitempty"`
+	Email    *string `json:"email,omitempty"`
+	FullName *string `json:"fullName,omitempty"`
+	Active   *bool   `json:"active,omitempty"`
+}
+
+type Service interface {
+	ListRoles(ctx context.Context) ([]*Role, error)
+	GetRole(ctx context.Context, id string) (*Role, error)
+	CreateRole(ctx context.Context, role *Role) (*Role, error)
+	UpdateRole(ctx context.Context, id string, update *RoleUpdate) (*Role, error)
+	DeleteRole(ctx context.Context, id string) error
+	ListUsers(ctx context.Context) ([]*User, error)
+	GetUser(ctx context.Context, id string) (*User, error)
+	CreateUser(ctx context.Context, user *User) (*User, error)
+	UpdateUser(ctx context.Context, id string, update *UserUpdate) (*User, error)
+	DeleteUser(ctx context.Context, id string) error
+	ListUserRoles(ctx context.Context, userID string) ([]*Role, error)
+	AssignRole(ctx context.Context, userID, roleID string) error
+	RemoveRole(ctx context.Context, userID, roleID string) error
+	Authorize(ctx context.Context, principal *auth.Principal, want Permission) error
+	EnsureAdmin(ctx context.Context, email string) error
+}
+
+type RBACService struct {
+	conf  *config.Config
+	db    *pgxpool.Pool
+	audit audit.Recorder
+}
+
+func NewService(conf *config.Config, db *pgxpool.Pool, recorder audit.Recorder) Service {
+	return &RBACService{
+		conf:  conf,
+		db:    db,
+		audit: recorder,
+	}
+}
+
+// roleColumns are selected from rbac_roles aliased as r.
+const roleColumns = "r.id, r.name, COALESCE(r.description, ''), r.permissions, r.created_at, r.updated_at"
+
+const userColumns = "id::text, username, email, COALESCE(name, ''), active, created_at, updated_at"
+
+func (s *RBACService) ListRoles(ctx context.Context) ([]*Role, error) {
+	rows, err := s.db.Query(ctx, "SELECT "+roleColumns+" FROM rbac_roles r ORDER BY r.name")
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanRole)
+}
+
+func (s *RBACService) GetRole(ctx context.Context, id string) (*Role, error) {
+	roleID, err := parseRoleID(id)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx, "SELECT "+roleColumns+" FROM rbac_roles r WHERE r.id = $1", roleID)
+	if err != nil {
+		return nil, err
+	}
+	role, err := pgx.CollectExactlyOneRow(rows, scanRole)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrRoleNotFound, id)
+	}
+	return role, err
+}
+
+func (s *RBACService) CreateRole(ctx context.Context, role *Role) (*Role, error) {
+	if err := validateRole(role); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx,
+		"INSERT INTO rbac_roles AS r (name, description, permissions) VALUES ($1, $2, $3) RETURNING "+roleColumns,
+		role.Name, role.Description, role.Permissions)
+	if err != nil {
+		return nil, err
+	}
+	created, err := pgx.CollectExactlyOneRow(rows, scanRole)
+	if isUniqueViolation(err) {
+		return nil, fmt.Errorf("%w: %s", ErrRoleExists, role.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	audit.Log(ctx, s.audit, audit.Change{Action: audit.ActionCreate, ResourceType: audit.ResourceRole, ResourceID: created.ID, After: created})
+	return created, nil
+}
+
+func (s *RBACService) UpdateRole(ctx context.Context, id string, update *RoleUpdate) (*Role, error) {
+	role, err := s.GetRole(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	before := audit.Snapshot(role)
+	if update.Name != nil {
+		role.Name = *update.Name
+	}
+	if update.Description != nil {
+		role.Description = *update.Description
+	}
+	if update.Permissions != nil {
+		role.Permissions = update.Permissions
+	}
+	if err := validateRole(role); err != nil {
+		return nil, err
+	}
+
+	roleID, err := parseRoleID(role.ID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx,
+		"UPDATE rbac_roles r SET name = $2, description = $3, permissions = $4, updated_at = CURRENT_TIMESTAMP WHERE r.id = $1 RETURNING "+roleColumns,
+		roleID, role.Name, role.Description, role.Permissions)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := pgx.CollectExactlyOneRow(rows, scanRole)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return nil, fmt.Errorf("%w: %s", ErrRoleNotFound, id)
+	case isUniqueViolation(err):
+		return nil, fmt.Errorf("%w: %s", ErrRoleExists, role.Name)
+	case err != nil:
+		return nil, err
+	}
+	audit.Log(ctx, s.audit, audit.Change{Action: audit.ActionUpdate, ResourceType: audit.ResourceRole, ResourceID: updated.ID, Before: before, After: updated})
+	return updated, nil
+}
+
+func (s *RBACService) DeleteRole(ctx context.Context, id string) error {
+	roleID, err := parseRoleID(id)
+	if err != nil {
+		return err
+	}
+	rows, err := s.db.Query(ctx, "DELETE FROM rbac_roles r WHERE r.id = $1 RETURNING "+roleColumns, roleID)
+	if err != nil {
+		return err
+	}
+	deleted, err := pgx.CollectExactlyOneRow(rows, scanRole)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%w: %s", ErrRoleNotFound, id)
+	}
+	if err != nil {
+		return err
+	}
+	audit.Log(ctx, s.audit, audit.Change{Action: audit.ActionDelete, ResourceType: audit.ResourceRole, ResourceID: deleted.ID, Before: deleted})
+	return nil
+}
+
+func (s *RBACService) ListUsers(ctx context.Context) ([]*User, error) {
+	rows, err := s.db.Query(ctx, "SELECT "+userColumns+" FROM rbac_users ORDER BY username")
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanUser)
+}
+
+func (s *RBACService) GetUser(ctx context.Context, id string) (*User, error) {
+	rows, err := s.db.Query(ctx, "SELECT "+userColumns+" FROM rbac_users WHERE id::text = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	user, err := pgx.CollectExactlyOneRow(rows, scanUser)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrUserNotFound, id)
+	}
+	return user, err
+}
+
+func (s *RBACService) CreateUser(ctx context.Context, user *User) (*User, error) {
+	if err := validateUser(user); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx,
+		"INSERT INTO rbac_users (id, username, email, name, active) VALUES ($1, $2, $3, $4, $5) RETURNING "+userColumns,
+		utils.GenerateID(), user.Username, user.Email, user.FullName, user.Active)
+	if err != nil {
+		return nil, err
+	}
+	created, err := pgx.CollectExactlyOneRow(rows, scanUser)
+	if isUniqueViolation(err) {
+		return nil, fmt.Errorf("%w: %s", ErrUserExists, user.Email)
+	}
+	if err != nil {
+		return nil, err
+	}
+	audit.Log(ctx, s.audit, audit.Change{Action: audit.ActionCreate, ResourceType: audit.ResourceUser, ResourceID: created.ID, After: created})
+	return created, nil
+}
+
+func (s *RBACService) UpdateUser(ctx context.Context, id string, update *UserUpdate) (*User, error) {
+	user, err := s.GetUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	before := audit.Snapshot(user)
+	if update.Username != nil {
+		user.Username = *update.Username
+	}
+	if update.Email != nil {
+		user.Email = *update.Email
+	}
+	if update.FullName != nil {
+		user.FullName = *update.FullName
+	}
+	if update.Active != nil {
+		user.Active = *update.Active
+	}
+	if err := validateUser(user); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(ctx,
+		"UPDATE rbac_users SET username = $2, email = $3, name = $4, active = $5, updated_at = CURRENT_TIMESTAMP WHERE id::text = $1 RETURNING "+userColumns,
+		id, user.Username, user.Email, user.FullName, user.Active)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := pgx.CollectExactlyOneRow(rows, scanUser)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return nil, fmt.Errorf("%w: %s", ErrUserNotFound, id)
+	case isUniqueViolation(err):
+		return nil, fmt.Errorf("%w: %s", ErrUserExists, user.Email)
+	case err != nil:
+		return nil, err
+	}
+	audit.Log(ctx, s.audit, audit.Change{Action: audit.ActionUpdate, ResourceType: audit.ResourceUser, ResourceID: updated.ID, Before: before, After: updated})
+	return updated, nil
+}
+
+func (s *RBACService) DeleteUser(ctx context.Context, id string) error {
+	rows, err := s.db.Query(ctx, "DELETE FROM rbac_users WHERE id::text = $1 RETURNING "+userColumns, id)
+	if err != nil {
+		return err
+	}
+	deleted, err := pgx.CollectExactlyOneRow(rows, scanUser)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%w: %s", ErrUserNotFound, id)
+	}
+	if err != nil {
+		return err
+	}
+	audit.Log(ctx, s.audit, audit.Change{Action: audit.ActionDelete, ResourceType: audit.ResourceUser, ResourceID: deleted.ID, Before: deleted})
+	return nil
+}
+
+func (s *RBACService) ListUserRoles(ctx context.Context, userID string) ([]*Role, error) {
+	if _, err := s.GetUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx,
+		"SELECT "+roleColumns+" FROM rbac_roles r JOIN rbac_user_roles ur ON ur.role_id = r.id WHERE ur.user_id::text = $1 ORDER BY r.name",
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanRole)
+}
+
+func (s *RBACService) AssignRole(ctx context.Context, userID, roleID string) error {
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	role, err := s.GetRole(ctx, roleID)
+	if err != nil {
+		return err
+	}
+	id, err := parseRoleID(role.ID)
+	if err != nil {
+		return err
+	}
+	tag, err := s.db.Exec(ctx,
+		"INSERT INTO rbac_user_roles (user_id, role_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		user.ID, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() > 0 {
+		audit.Log(ctx, s.audit, audit.Change{Action: audit.ActionCreate, ResourceType: audit.ResourceRoleAssignment, ResourceID: user.ID + "/" + role.ID, After: roleAssignment{user.ID, role.ID, role.Name}})
+	}
+	return nil
+}
+
+func (s *RBACService) RemoveRole(ctx context.Context, userID, roleID string) error {
+	id, err := parseRoleID(roleID)
+	if err != nil {
+		return err
+	}
+	tag, err := s.db.Exec(ctx, "DELETE FROM rbac_user_roles WHERE user_id::text = $1 AND role_id = $2", userID, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: user %s does not have role %s", ErrRoleNotFound, userID, roleID)
+	}
+	audit.Log(ctx, s.audit, audit.Change{Action: audit.ActionDelete, ResourceType: audit.ResourceRoleAssignment, ResourceID: userID + "/" + roleID, Before: roleAssignment{UserID: userID, RoleID: roleID}})
+	return nil
+}
+
+// Authorize checks that the principal's roles grant want. Requests made
+// without credentials are refused, unless DEV_MODE lets them through.
+func (s *RBACService) Authorize(ctx context.Context, principal *auth.Principal, want Permission) error {
+	if principal == nil {
+		if s.conf.DevMode {
+			return nil
+		}
+		return fmt.Errorf("%w: %s requires credentials", auth.ErrForbidden, want)
+	}
+	if !principal.IsUser() {
+		return fmt.Errorf("%w: %s requires a user", auth.ErrForbidden, want)
+	}
+
+	rows, err := s.db.Query(ctx, `
+		SELECT r.permissions
+		FROM rbac_users u
+		JOIN rbac_user_roles ur ON ur.user_id = u.id
+		JOIN rbac_roles r ON r.id = ur.role_id
+		WHERE u.active AND (($1 <> '' AND lower(u.email) = lower($1)) OR u.username = $2)`,
+		principal.Email, principal.Subject)
+	if err != nil {
+		return err
+	}
+	grants, err := pgx.CollectRows(rows, pgx.RowTo[[]string])
+	if err != nil {
+		return err
+	}
+	for _, perms := range grants {
+		for _, perm := range perms {
+			p, err := ParsePermission(perm)
+			if err == nil && p.Grants(want) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: %s lacks %s", auth.ErrForbidden, principal.Subject, want)
+}
+
+// EnsureAdmin creates a user for email if none exists and gives it the admin
+// role, so a fresh install has someone who can hand out roles.
+func (s *RBACService) EnsureAdmin(ctx context.Context, email string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var userID string
+	err = tx.QueryRow(ctx,
+		`INSERT INTO rbac_users (id, username, email) VALUES ($1, $2, $2)
+		ON CONFLICT (email) DO UPDATE SET email = EXCLUDED.email
+		RETURNING id::text`,
+		utils.GenerateID(), email).Scan(&userID)
+	if err != nil {
+		return err
+	}
+	tag, err := tx.Exec(ctx,
+		`INSERT INTO rbac_user_roles (user_id, role_id)
+		SELECT $1, id FROM rbac_roles WHERE name = $2
+		ON CONFLICT DO NOTHING`,
+		userID, AdminRole)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		var exists bool
+		if err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM rbac_roles WHERE name = $1)", AdminRole).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("%w: %s", ErrRoleNotFound, AdminRole)
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func scanRole(row pgx.CollectableRow) (*Role, error) {
+	var r Role
+	var id int
+	if err := row.Scan(&id, &r.Name, &r.Description, &r.Permissions, &r.CreatedAt, &r.UpdatedAt); err != nil {
+		return nil, err
+	}
+	r.ID = strconv.Itoa(id)
+	return &r, nil
+}
+
+func scanUser(row pgx.CollectableRow) (*User, error) {
+	var u User
+	if err := row.Scan(&u.ID, &u.Username, &u.Email, &u.FullName, &u.Active, &u.CreatedAt, &u.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func parseRoleID(id string) (int, error) {
+	roleID, err := strconv.Atoi(id)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrRoleNotFound, id)
+	}
+	return roleID, nil
+}
+
+func validateRole(role *Role) error {
+	if strings.TrimSpace(role.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidRole)
+	}
+	if role.Permissions == nil {
+		role.Permissions = []string{}
+	}
+	for i, perm := range role.Permissions {
+		p, err := ParsePermission(perm)
+		if err != nil {
+			return err
+		}
+		role.Permissions[i] = p.String()
+	}
+	return nil
+}
+
+func validateUser(user *User) error {
+	if strings.TrimSpace(user.Username) == "" {
+		return fmt.Errorf("%w: username is required", ErrInvalidUser)
+	}
+	if !strings.Contains(user.Email, "@") {
+		return fmt.Errorf("%w: email %q is not valid", ErrInvalidUser, user.Email)
+	}
+	return nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation
+}
@@ -0,0 +1,136 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var ErrInvalidSchema = errors.New("invalid JSON schema")
+
+// resourceURL names the schema being compiled; it only shows up in $ref
+// resolution and compile errors.
+const resourceURL = "mem:///schema.json"
+
+var printer = message.NewPrinter(language.English)
+
+// Violation is one way a value fails its schema. Field locates the failing
+// part of the value, e.g. value.retries or variations[1].value.color.
+type Violation struct {
+	Field       string `json:"field"`
+	Description string `json:"description"`
+}
+
+// ValidationError lists every violation found in a value.
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		parts[i] = v.Field + ": " + v.Description
+	}
+	return "value does not match its schema: " + strings.Join(parts, "; ")
+}
+
+// Status is the InvalidArgument status for an error wrapping e, carrying the
+// violations as BadRequest details.
+func (e *ValidationError) Status(message string) *status.Status {
+	details := &errdetails.BadRequest{}
+	for _, v := range e.Violations {
+		details.FieldViolations = append(details.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       v.Field,
+			Description: v.Description,
+		})
+	}
+	st := status.New(codes.InvalidArgument, message)
+	if withDetails, err := st.WithDetails(details); err == nil {
+		return withDetails
+	}
+	return st
+}
+
+// Schema is a compiled JSON Schema. Schemas are self-contained: $ref may
+// only point within the schema, never to files or URLs.
+type Schema struct {
+	compiled *jsonschema.Schema
+}
+
+func Compile(raw json.RawMessage) (*Schema, error) {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+	c := jsonschema.NewCompiler()
+	c.UseLoader(jsonschema.SchemeURLLoader{})
+	c.AssertFormat()
+	if err := c.AddResource(resourceURL, doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+	compiled, err := c.Compile(resourceURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+	return &Schema{compiled: compiled}, nil
+}
+
+// Validate checks value against the schema, naming the violations relative
+// to field. It returns a *ValidationError when the value does not match.
+func (s *Schema) Validate(field string, value json.RawMessage) error {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(value))
+	if err != nil {
+		return &ValidationError{Violations: []Violation{{Field: field, Description: "not valid JSON"}}}
+	}
+	err = s.compiled.Validate(doc)
+	var verr *jsonschema.ValidationError
+	if !errors.As(err, &verr) {
+		return err
+	}
+
+	out := &ValidationError{}
+	collect(field, verr, out)
+	return out
+}
+
+// collect appends the leaves of the error tree; the inner nodes only
+// summarize them, e.g. "allOf failed".
+func collect(field string, verr *jsonschema.ValidationError, out *ValidationError) {
+	if len(verr.Causes) == 0 {
+		out.Violations = append(out.Violations, Violation{
+			Field:       fieldPath(field, verr.InstanceLocation),
+			Description: verr.ErrorKind.LocalizedString(printer),
+		})
+	}
+	for _, cause := range verr.Causes {
+		collect(field, cause, out)
+	}
+}
+
+// fieldPath appends a location within the value to field: array indexes in
+// brackets, object members after dots.
+func fieldPath(field string, location []string) string {
+	var sb strings.Builder
+	sb.WriteString(field)
+	for _, token := range location {
+		if _, err := strconv.Atoi(token); err == nil {
+			sb.WriteString("[" + token + "]")
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteByte('.')
+		}
+		sb.WriteString(token)
+	}
+	return sb.String()
+}
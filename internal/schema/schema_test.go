@@ -0,0 +1,189 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+)
+
+// timeoutSchema is attached to a config prefix such as checkout/payments.
+const timeoutSchema = `{
+	"type": "object",
+	"properties": {
+		"timeout": {"type": "integer", "minimum": 1},
+		"mode": {"enum": ["fast", "safe"]},
+		"contact": {"type": "string", "format": "email"}
+	},
+	"required": ["timeout"],
+	"additionalProperties": false
+}`
+
+// bannerSchema is the schema of a json flag whose variations are banners.
+const bannerSchema = `{
+	"$defs": {"color": {"type": "string", "pattern": "^#[0-9a-f]{6}$"}},
+	"type": "object",
+	"properties": {
+		"title": {"type": "string", "minLength": 1},
+		"colors": {"type": "array", "items": {"$ref": "#/$defs/color"}, "maxItems": 3}
+	},
+	"required": ["title"]
+}`
+
+func mustCompile(t *testing.T, raw string) *Schema {
+	t.Helper()
+	s, err := Compile(json.RawMessage(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// fields returns the fields of the violations in err, failing unless err is
+// a *ValidationError.
+func fields(t *testing.T, err error) []string {
+	t.Helper()
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("err = %v; want a *ValidationError", err)
+	}
+	var out []string
+	for _, v := range verr.Violations {
+		if v.Description == "" {
+			t.Errorf("violation of %s has no description", v.Field)
+		}
+		out = append(out, v.Field)
+	}
+	slices.Sort(out)
+	return out
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name  string
+		raw   string
+		valid bool
+	}{
+		{"config entry schema", timeoutSchema, true},
+		{"flag variation schema", bannerSchema, true},
+		{"any value", `{}`, true},
+		{"boolean schema", `true`, true},
+		{"not JSON", `{"type": `, false},
+		{"unknown type", `{"type": "decimal"}`, false},
+		{"wrong keyword type", `{"minimum": "one"}`, false},
+		{"malformed pattern", `{"type": "string", "pattern": "(["}`, false},
+		{"dangling $ref", `{"$ref": "#/$defs/missing"}`, false},
+		{"remote $ref", `{"$ref": "https://example.com/schema.json"}`, false},
+		{"file $ref", `{"$ref": "file:///etc/passwd"}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(json.RawMessage(tt.raw))
+			if tt.valid && err != nil {
+				t.Errorf("Compile = %v; want nil", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidSchema) {
+				t.Errorf("Compile = %v; want ErrInvalidSchema", err)
+			}
+		})
+	}
+}
+
+func TestValidateConfigEntry(t *testing.T) {
+	s := mustCompile(t, timeoutSchema)
+
+	tests := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{"minimal", `{"timeout": 30}`, nil},
+		{"every field", `{"timeout": 1, "mode": "safe", "contact": "ops@example.com"}`, nil},
+		{"missing required", `{"mode": "fast"}`, []string{"value"}},
+		{"below minimum", `{"timeout": 0}`, []string{"value.timeout"}},
+		{"wrong type", `{"timeout": "30s"}`, []string{"value.timeout"}},
+		{"not an integer", `{"timeout": 1.5}`, []string{"value.timeout"}},
+		{"outside enum", `{"timeout": 30, "mode": "slow"}`, []string{"value.mode"}},
+		{"bad format", `{"timeout": 30, "contact": "ops"}`, []string{"value.contact"}},
+		{"unknown field", `{"timeout": 30, "retries": 3}`, []string{"value"}},
+		{"several violations", `{"timeout": -1, "mode": "slow"}`, []string{"value.mode", "value.timeout"}},
+		{"not an object", `[30]`, []string{"value"}},
+		{"not JSON", `{timeout: 30}`, []string{"value"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.Validate("value", json.RawMessage(tt.value))
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("Validate(%s) = %v; want nil", tt.value, err)
+				}
+				return
+			}
+			if got := fields(t, err); !slices.Equal(got, tt.want) {
+				t.Errorf("Validate(%s) violations at %v; want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateFlagVariation(t *testing.T) {
+	s := mustCompile(t, bannerSchema)
+
+	tests := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{"title only", `{"title": "Sale"}`, nil},
+		{"with colors", `{"title": "Sale", "colors": ["#ff0000", "#00ff00"]}`, nil},
+		{"extra fields allowed", `{"title": "Sale", "dismissable": true}`, nil},
+		{"empty title", `{"title": ""}`, []string{"variations[1].value.title"}},
+		{"bad color", `{"title": "Sale", "colors": ["#ff0000", "red"]}`, []string{"variations[1].value.colors[1]"}},
+		{"too many colors", `{"title": "Sale", "colors": ["#000000", "#111111", "#222222", "#333333"]}`, []string{"variations[1].value.colors"}},
+		{"string instead of object", `"Sale"`, []string{"variations[1].value"}},
+		{"null", `null`, []string{"variations[1].value"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.Validate("variations[1].value", json.RawMessage(tt.value))
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("Validate(%s) = %v; want nil", tt.value, err)
+				}
+				return
+			}
+			if got := fields(t, err); !slices.Equal(got, tt.want) {
+				t.Errorf("Validate(%s) violations at %v; want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidationErrorStatus(t *testing.T) {
+	s := mustCompile(t, timeoutSchema)
+	err := s.Validate("value", json.RawMessage(`{"timeout": 0, "mode": "slow"}`))
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("err = %v; want a *ValidationError", err)
+	}
+
+	st := verr.Status("invalid config entry")
+	if st.Code() != codes.InvalidArgument || st.Message() != "invalid config entry" {
+		t.Errorf("status = %v %q; want InvalidArgument with the given message", st.Code(), st.Message())
+	}
+	var got []string
+	for _, d := range st.Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			for _, v := range br.FieldViolations {
+				got = append(got, v.Field)
+			}
+		}
+	}
+	slices.Sort(got)
+	if want := []string{"value.mode", "value.timeout"}; !slices.Equal(got, want) {
+		t.Errorf("BadRequest fields = %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,122 @@
+package segment
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	ffpb "github.com/julianstephens/feature-flag-service/gen/go/grpc/v1/featureflag.v1"
+	"github.com/julianstephens/feature-flag-service/internal/flag"
+)
+
+type SegmentGRPCServer struct {
+	ffpb.UnimplementedSegmentServiceServer
+	Service Service
+}
+
+func (s *SegmentGRPCServer) ListSegments(ctx context.Context, req *ffpb.ListSegmentsRequest) (*ffpb.ListSegmentsResponse, error) {
+	segments, err := s.Service.ListSegments(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	var protoSegments []*ffpb.Segment
+	for _, seg := range segments {
+		protoSegments = append(protoSegments, seg.ToProto())
+	}
+	return &ffpb.ListSegmentsResponse{Segments: protoSegments}, nil
+}
+
+func (s *SegmentGRPCServer) GetSegment(ctx context.Context, req *ffpb.GetSegmentRequest) (*ffpb.Segment, error) {
+	segment, err := s.Service.GetSegment(ctx, req.Key)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return segment.ToProto(), nil
+}
+
+func (s *SegmentGRPCServer) CreateSegment(ctx context.Context, req *ffpb.CreateSegmentRequest) (*ffpb.Segment, error) {
+	segment, err := s.Service.CreateSegment(ctx, &Segment{
+		Key:         req.Key,
+		Name:        req.Name,
+		Description: req.Description,
+		Included:    req.Included,
+		Excluded:    req.Excluded,
+		Rules:       RulesFromProto(req.Rules),
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return segment.ToProto(), nil
+}
+
+func (s *SegmentGRPCServer) UpdateSegment(ctx context.Context, req *ffpb.UpdateSegmentRequest) (*ffpb.Segment, error) {
+	segment, err := s.Service.UpdateSegment(ctx, req.Key, &Segment{
+		Name:        req.Name,
+		Description: req.Description,
+		Included:    req.Included,
+		Excluded:    req.Excluded,
+		Rules:       RulesFromProto(req.Rules),
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return segment.ToProto(), nil
+}
+
+func (s *SegmentGRPCServer) DeleteSegment(ctx context.Context, req *ffpb.DeleteSegmentRequest) (*ffpb.DeleteSegmentResponse, error) {
+	if err := s.Service.DeleteSegment(ctx, req.Key); err != nil {
+		return nil, grpcError(err)
+	}
+	return &ffpb.DeleteSegmentResponse{}, nil
+}
+
+func (s *Segment) ToProto() *ffpb.Segment {
+	segment := &ffpb.Segment{
+		Key:         s.Key,
+		Name:        s.Name,
+		Description: s.Description,
+		Included:    s.Included,
+		Excluded:    s.Excluded,
+		CreatedAt:   s.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:   s.UpdatedAt.Format(time.RFC3339),
+	}
+	for _, r := range s.Rules {
+		segment.Rules = append(segment.Rules, &ffpb.SegmentRule{
+			Id:          r.ID,
+			Description: r.Description,
+			Clauses:     flag.ClausesToProto(r.Clauses),
+		})
+	}
+	return segment
+}
+
+func RulesFromProto(protoRules []*ffpb.SegmentRule) []Rule {
+	var rules []Rule
+	for _, r := range protoRules {
+		rules = append(rules, Rule{
+			ID:          r.Id,
+			Description: r.Description,
+			Clauses:     flag.ClausesFromProto(r.Clauses),
+		})
+	}
+	return rules
+}
+
+// grpcError maps service errors onto gRPC status codes.
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, ErrSegmentNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrSegmentExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, ErrSegmentInUse), errors.Is(err, ErrSegmentConflict):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, ErrInvalidSegment):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return err
+	}
+}
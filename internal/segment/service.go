@@ -0,0 +1,362 @@
+package segment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/julianstephens/feature-flag-service/internal/audit"
+	"github.com/julianstephens/feature-flag-service/internal/config"
+	"github.com/julianstephens/feature-flag-service/internal/flag"
+	"github.com/julianstephens/feature-flag-service/internal/storage"
+	"github.com/julianstephens/feature-flag-service/internal/utils"
+)
+
+var (
+	ErrSegmentNotFound = errors.New("segment not found")
+	ErrSegmentExists   = errors.New("segment already exists")
+	ErrSegmentInUse    = errors.New("segment in use")
+	ErrSegmentConflict = errors.New("segment was changed concurrently")
+	ErrInvalidSegment  = errors.New("invalid segment")
+)
+
+var keyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Segment is a reusable group of contexts that flag rules reference by key
+// through the segmentMatch operator. Included and Excluded list context keys
+// and take precedence over Rules, with Included checked first.
+type Segment struct {
+	Key         string    `json:"key"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Included    []string  `json:"included"`
+	Excluded    []string  `json:"excluded"`
+	Rules       []Rule    `json:"rules"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	// Revision is the store revision the segment was last written at. It is
+	// set on reads and never stored.
+	Revision int64 `json:"revision,omitempty"`
+}
+
+// Rule adds contexts to a segment when all of its clauses match.
+type Rule struct {
+	ID          string        `json:"id"`
+	Description string        `json:"description,omitempty"`
+	Clauses     []flag.Clause `json:"clauses"`
+}
+
+type Service interface {
+	CreateSegment(ctx context.Context, segment *Segment) (*Segment, error)
+	UpdateSegment(ctx context.Context, key string, segment *Segment) (*Segment, error)
+	GetSegment(ctx context.Context, key string) (*Segment, error)
+	DeleteSegment(ctx context.Context, key string) error
+	ListSegments(ctx context.Context) ([]*Segment, error)
+	LoadSegments(ctx context.Context, revision int64) (flag.Segments, error)
+}
+
+type SegmentService struct {
+	conf       *config.Config
+	store      storage.Store
+	prefix     string
+	flagPrefix string
+	audit      audit.Recorder
+}
+
+func NewService(conf *config.Config, store storage.Store, recorder audit.Recorder) Service {
+	return &SegmentService{
+		conf:       conf,
+		store:      store,
+		prefix:     conf.SegmentServicePrefix,
+		flagPrefix: conf.FlagServicePrefix,
+		audit:      recorder,
+	}
+}
+
+func (s *SegmentService) GetKey(key string) string {
+	return s.prefix + key
+}
+
+func (s *SegmentService) ListSegments(ctx context.Context) ([]*Segment, error) {
+	res, err := s.store.List(ctx, s.prefix, storage.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]*Segment, 0, len(res.KVs))
+	for _, kv := range res.KVs {
+		var segment Segment
+		if err := json.Unmarshal([]byte(kv.Value), &segment); err != nil {
+			log.Printf("error unmarshaling segment: %v", err)
+			continue
+		}
+		segment.Revision = kv.ModRevision
+		segments = append(segments, &segment)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].Key < segments[j].Key })
+	return segments, nil
+}
+
+func (s *SegmentService) GetSegment(ctx context.Context, key string) (*Segment, error) {
+	resp, err := s.store.Get(ctx, s.GetKey(key))
+	if err != nil {
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			return nil, ErrSegmentNotFound
+		}
+		return nil, err
+	}
+
+	var segment Segment
+	if err := json.Unmarshal([]byte(resp.Value), &segment); err != nil {
+		return nil, err
+	}
+	segment.Revision = resp.ModRevision
+	return &segment, nil
+}
+
+// CreateSegment stores a new segment under the key chosen by the caller.
+func (s *SegmentService) CreateSegment(ctx context.Context, input *Segment) (*Segment, error) {
+	if !keyPattern.MatchString(input.Key) {
+		return nil, fmt.Errorf("%w: key %q must be letters, digits, '.', '_' or '-'", ErrInvalidSegment, input.Key)
+	}
+
+	now := time.Now()
+	segment := &Segment{
+		Key:         input.Key,
+		Name:        input.Name,
+		Description: input.Description,
+		Included:    input.Included,
+		Excluded:    input.Excluded,
+		Rules:       input.Rules,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := segment.validate(); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(segment)
+	if err != nil {
+		return nil, err
+	}
+
+	key := s.GetKey(segment.Key)
+	resp, err := s.store.Txn(ctx, []storage.Cmp{storage.Absent(key)}, storage.Put(key, string(data)))
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Succeeded {
+		return nil, fmt.Errorf("%w: %s", ErrSegmentExists, segment.Key)
+	}
+	segment.Revision = resp.Revision
+
+	audit.Log(ctx, s.audit, audit.Change{Action: audit.ActionCreate, ResourceType: audit.ResourceSegment, ResourceID: segment.Key, After: segment})
+	return segment, nil
+}
+
+// UpdateSegment replaces the writable fields of a segment. Flags read the
+// segment at evaluation time, so the change applies to every referencing
+// flag at once. It fails with ErrSegmentConflict when the segment was
+// changed while it was being updated.
+func (s *SegmentService) UpdateSegment(ctx context.Context, key string, input *Segment) (*Segment, error) {
+	segment, err := s.GetSegment(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	before := audit.Snapshot(segment)
+
+	segment.Name = input.Name
+	segment.Description = input.Description
+	segment.Included = input.Included
+	segment.Excluded = input.Excluded
+	segment.Rules = input.Rules
+	if err := segment.validate(); err != nil {
+		return nil, err
+	}
+	segment.UpdatedAt = time.Now()
+
+	stored := *segment
+	stored.Revision = 0
+	data, err := json.Marshal(&stored)
+	if err != nil {
+		return nil, err
+	}
+
+	storeKey := s.GetKey(key)
+	resp, err := s.store.Txn(ctx, []storage.Cmp{storage.AtRevision(storeKey, segment.Revision)}, storage.Put(storeKey, string(data)))
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Succeeded {
+		return nil, fmt.Errorf("%w: %s was modified since revision %d", ErrSegmentConflict, key, segment.Revision)
+	}
+	segment.Revision = resp.Revision
+
+	audit.Log(ctx, s.audit, audit.Change{Action: audit.ActionUpdate, ResourceType: audit.ResourceSegment, ResourceID: segment.Key, Before: before, After: segment})
+	return segment, nil
+}
+
+// DeleteSegment removes a segment that no flag references. It claims the
+// segment's guard, which flag writes referencing the segment claim too, so
+// it fails with ErrSegmentConflict when a flag started referencing the
+// segment, or the segment changed, while it was being deleted.
+func (s *SegmentService) DeleteSegment(ctx context.Context, key string) error {
+	guardKey := flag.SegmentGuardKey(s.conf, key)
+	var guardRev int64
+	guard, err := s.store.Get(ctx, guardKey)
+	if err == nil {
+		guardRev = guard.ModRevision
+	} else if !errors.Is(err, storage.ErrKeyNotFound) {
+		return err
+	}
+	segment, err := s.GetSegment(ctx, key)
+	if err != nil {
+		return err
+	}
+	users, err := s.referencingFlags(ctx, key)
+	if err != nil {
+		return err
+	}
+	if len(users) > 0 {
+		return fmt.Errorf("%w: referenced by flags %v", ErrSegmentInUse, users)
+	}
+
+	storeKey := s.GetKey(key)
+	cmps := []storage.Cmp{storage.AtRevision(storeKey, segment.Revision), storage.AtRevision(guardKey, guardRev)}
+	resp, err := s.store.Txn(ctx, cmps, storage.Delete(storeKey), storage.Put(guardKey, key))
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		if _, err := s.store.Get(ctx, storeKey); errors.Is(err, storage.ErrKeyNotFound) {
+			return ErrSegmentNotFound
+		}
+		return fmt.Errorf("%w: %s was modified or referenced while it was deleted", ErrSegmentConflict, key)
+	}
+	audit.Log(ctx, s.audit, audit.Change{Action: audit.ActionDelete, ResourceType: audit.ResourceSegment, ResourceID: key, Before: segment})
+	return nil
+}
+
+// LoadSegments reads every segment as of the given store revision, or the
+// latest revision when it is 0.
+func (s *SegmentService) LoadSegments(ctx context.Context, revision int64) (flag.Segments, error) {
+	res, err := s.store.List(ctx, s.prefix, storage.ListOptions{Revision: revision})
+	if err != nil {
+		return nil, err
+	}
+
+	set := make(Set, len(res.KVs))
+	for _, kv := range res.KVs {
+		var segment Segment
+		if err := json.Unmarshal([]byte(kv.Value), &segment); err != nil {
+			log.Printf("error unmarshaling segment: %v", err)
+			continue
+		}
+		set[segment.Key] = &segment
+	}
+	return set, nil
+}
+
+func (s *SegmentService) referencingFlags(ctx context.Context, key string) ([]string, error) {
+	res, err := s.store.List(ctx, s.flagPrefix, storage.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, kv := range res.KVs {
+		f, err := flag.ParseFlag([]byte(kv.Value))
+		if err != nil {
+			continue
+		}
+		if references(f, key) {
+			ids = append(ids, f.Project+"/"+f.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func references(f *flag.Flag, key string) bool {
+	for _, state := range f.Environments {
+		for _, rule := range state.Rules {
+			for _, c := range rule.Clauses {
+				if c.Operator == flag.OpSegmentMatch && slices.Contains(c.Values, key) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (s *Segment) validate() error {
+	for i := range s.Rules {
+		rule := &s.Rules[i]
+		if rule.ID == "" {
+			rule.ID = utils.GenerateID()
+		}
+		if len(rule.Clauses) == 0 {
+			return fmt.Errorf("%w: rule %d needs at least one clause", ErrInvalidSegment, i)
+		}
+		for j := range rule.Clauses {
+			c := &rule.Clauses[j]
+			// Segments cannot be nested, which keeps membership checks free
+			// of cycles.
+			if c.Operator == flag.OpSegmentMatch {
+				return fmt.Errorf("%w: rule %d cannot reference other segments", ErrInvalidSegment, i)
+			}
+			if err := c.Validate(); err != nil {
+				return fmt.Errorf("%w: rule %d: %v", ErrInvalidSegment, i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Contains reports whether ectx is a member of the segment.
+func (s *Segment) Contains(ectx *flag.EvaluationContext) bool {
+	if ectx.Key != "" {
+		if slices.Contains(s.Included, ectx.Key) {
+			return true
+		}
+		if slices.Contains(s.Excluded, ectx.Key) {
+			return false
+		}
+	}
+	for i := range s.Rules {
+		if s.Rules[i].Matches(ectx) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) Matches(ectx *flag.EvaluationContext) bool {
+	for i := range r.Clauses {
+		if !r.Clauses[i].Matches(ectx, nil) {
+			return false
+		}
+	}
+	return true
+}
+
+// Set holds segments by key and resolves segmentMatch clauses for flag
+// evaluation.
+type Set map[string]*Segment
+
+func (s Set) Has(key string) bool {
+	_, ok := s[key]
+	return ok
+}
+
+func (s Set) Contains(key string, ectx *flag.EvaluationContext) bool {
+	segment, ok := s[key]
+	return ok && segment.Contains(ectx)
+}
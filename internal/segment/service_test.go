@@ -0,0 +1,130 @@
+package segment
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/julianstephens/feature-flag-service/internal/config"
+	"github.com/julianstephens/feature-flag-service/internal/flag"
+	"github.com/julianstephens/feature-flag-service/internal/project"
+	"github.com/julianstephens/feature-flag-service/internal/storage"
+)
+
+// racyStore runs beforeTxn once, just before the first transaction, to
+// stand in for a concurrent write.
+type racyStore struct {
+	storage.Store
+	beforeTxn func()
+}
+
+func (s *racyStore) Txn(ctx context.Context, cmps []storage.Cmp, ops ...storage.Op) (*storage.TxnResult, error) {
+	if hook := s.beforeTxn; hook != nil {
+		s.beforeTxn = nil
+		hook()
+	}
+	return s.Store.Txn(ctx, cmps, ops...)
+}
+
+// newTestServices returns a segment service holding the segment "beta" and a
+// flag service using it, on the same MemoryStore.
+func newTestServices(t *testing.T) (Service, flag.Service, *racyStore) {
+	t.Helper()
+	ctx := context.Background()
+	conf := &config.Config{
+		FlagServicePrefix:    "/featureflags/",
+		FlagHistoryPrefix:    "/featureflag-history/",
+		FlagKeyIndexPrefix:   "/featureflag-keys/",
+		SegmentServicePrefix: "/segments/",
+		ProjectServicePrefix: "/projects/",
+		SDKKeyServicePrefix:  "/sdkkeys/",
+		DefaultProject:       "default",
+		DefaultEnvironment:   "production",
+	}
+	store := &racyStore{Store: storage.NewMemoryStore()}
+	t.Cleanup(func() { store.Close() })
+	projects := project.NewService(conf, store, nil)
+	if _, err := projects.EnsureProject(ctx, conf.DefaultProject); err != nil {
+		t.Fatal(err)
+	}
+	segments := NewService(conf, store, nil)
+	if _, err := segments.CreateSegment(ctx, &Segment{Key: "beta", Included: []string{"user-1"}}); err != nil {
+		t.Fatal(err)
+	}
+	return segments, flag.NewService(conf, store, projects, segments, nil), store
+}
+
+// betaRule targets the members of the segment "beta".
+func betaRule() *flag.FlagEnvironment {
+	return &flag.FlagEnvironment{
+		Enabled:      true,
+		OffVariation: 1,
+		Rules:        []flag.Rule{{Clauses: []flag.Clause{{Operator: flag.OpSegmentMatch, Values: []string{"beta"}}}}},
+	}
+}
+
+func TestUpdateSegmentConflict(t *testing.T) {
+	ctx := context.Background()
+	segments, _, store := newTestServices(t)
+
+	store.beforeTxn = func() {
+		if _, err := segments.UpdateSegment(ctx, "beta", &Segment{Name: "first", Included: []string{"user-2"}}); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := segments.UpdateSegment(ctx, "beta", &Segment{Name: "second"}); !errors.Is(err, ErrSegmentConflict) {
+		t.Fatalf("UpdateSegment racing another: err = %v; want ErrSegmentConflict", err)
+	}
+	segment, err := segments.GetSegment(ctx, "beta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if segment.Name != "first" || len(segment.Included) != 1 || segment.Included[0] != "user-2" {
+		t.Errorf("segment = %+v; want the first update kept", segment)
+	}
+}
+
+func TestDeleteSegmentRacesFlagWrite(t *testing.T) {
+	ctx := context.Background()
+	segments, flags, store := newTestServices(t)
+
+	f, err := flags.CreateFlag(ctx, "", &flag.Flag{Name: "gated"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.beforeTxn = func() {
+		if _, err := flags.UpdateFlagEnvironment(ctx, "", "", f.ID, betaRule()); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := segments.DeleteSegment(ctx, "beta"); !errors.Is(err, ErrSegmentConflict) {
+		t.Fatalf("DeleteSegment racing a referencing flag write: err = %v; want ErrSegmentConflict", err)
+	}
+	if _, err := segments.GetSegment(ctx, "beta"); err != nil {
+		t.Fatalf("segment deleted despite the new reference: %v", err)
+	}
+	if err := segments.DeleteSegment(ctx, "beta"); !errors.Is(err, ErrSegmentInUse) {
+		t.Errorf("retried DeleteSegment: err = %v; want ErrSegmentInUse", err)
+	}
+}
+
+func TestFlagWriteRacesDeleteSegment(t *testing.T) {
+	ctx := context.Background()
+	segments, flags, store := newTestServices(t)
+
+	f, err := flags.CreateFlag(ctx, "", &flag.Flag{Name: "gated"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.beforeTxn = func() {
+		if err := segments.DeleteSegment(ctx, "beta"); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := flags.UpdateFlagEnvironment(ctx, "", "", f.ID, betaRule()); !errors.Is(err, flag.ErrFlagConflict) {
+		t.Fatalf("flag write racing the segment's deletion: err = %v; want ErrFlagConflict", err)
+	}
+	if _, err := flags.UpdateFlagEnvironment(ctx, "", "", f.ID, betaRule()); !errors.Is(err, flag.ErrInvalidFlag) {
+		t.Errorf("retried flag write: err = %v; want ErrInvalidFlag for the unknown segment", err)
+	}
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/julianstephens/go-utils/httputil/response"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/julianstephens/feature-flag-service/internal/audit"
+	"github.com/julianstephens/feature-flag-service/internal/auth"
+)
+
+// AuditReasonHeader carries the free-text reason recorded with a change.
+// gRPC callers send it as lowercase metadata.
+const AuditReasonHeader = "X-Audit-Reason"
+
+// auditActor names the principal in the audit log: a user by email, falling
+// back to the token subject.
+func auditActor(p *auth.Principal) string {
+	switch {
+	case p == nil:
+		return ""
+	case p.Email != "":
+		return p.Email
+	case p.Subject != "":
+		return p.Subject
+	default:
+		return p.Kind
+	}
+}
+
+// auditMetadata attaches who is making the request, and why, for the
+// services to record with any change they make. It runs after authenticate.
+func auditMetadata(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+		ctx := audit.WithMetadata(r.Context(), audit.Metadata{
+			UserID:    auditActor(auth.FromContext(r.Context())),
+			Reason:    r.Header.Get(AuditReasonHeader),
+			UserAgent: r.UserAgent(),
+			IPAddress: ip,
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// auditMetadataGRPC is the unary interceptor counterpart of auditMetadata.
+func auditMetadataGRPC(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	md := audit.Metadata{UserID: auditActor(auth.FromContext(ctx))}
+	if in, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := in.Get(AuditReasonHeader); len(v) > 0 {
+			md.Reason = v[0]
+		}
+		if v := in.Get("user-agent"); len(v) > 0 {
+			md.UserAgent = v[0]
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		md.IPAddress = p.Addr.String()
+		if host, _, err := net.SplitHostPort(md.IPAddress); err == nil {
+			md.IPAddress = host
+		}
+	}
+	return handler(audit.WithMetadata(ctx, md), req)
+}
+
+// registerAuditRoutes serves the audit log.
+func registerAuditRoutes(auditRouter *mux.Router, responder *response.Responder, auditSvc audit.Service) {
+	auditRouter.HandleFunc("", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		query := r.URL.Query()
+
+		filter := audit.Filter{
+			ResourceType: query.Get("resourceType"),
+			ResourceID:   query.Get("resourceId"),
+			UserID:       query.Get("userId"),
+			Action:       query.Get("action"),
+			Project:      query.Get("project"),
+			Environment:  query.Get("environment"),
+		}
+		if flagID := query.Get("flagId"); flagID != "" {
+			filter.ResourceType = audit.ResourceFlag
+			filter.ResourceID = flagID
+		}
+		var err error
+		if filter.Since, err = audit.ParseTime(query.Get("since")); err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		if filter.Until, err = audit.ParseTime(query.Get("until")); err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		for name, dst := range map[string]*int{"limit": &filter.Limit, "offset": &filter.Offset} {
+			if v := query.Get(name); v != "" {
+				if *dst, err = strconv.Atoi(v); err != nil {
+					responder.BadRequest(w, r, err)
+					return
+				}
+			}
+		}
+
+		res, err := auditSvc.ListEntries(ctx, filter)
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, res)
+	}).Methods("GET")
+	auditRouter.HandleFunc("/{auditId}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		res, err := auditSvc.GetEntry(ctx, vars["auditId"])
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, res)
+	}).Methods("GET")
+}
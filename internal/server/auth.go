@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/julianstephens/go-utils/httputil/response"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	ffpb "github.com/julianstephens/feature-flag-service/gen/go/grpc/v1/featureflag.v1"
+	"github.com/julianstephens/feature-flag-service/internal/auth"
+	"github.com/julianstephens/feature-flag-service/internal/config"
+	"github.com/julianstephens/feature-flag-service/internal/rbac"
+)
+
+// sdkMethods are the gRPC methods an SDK key may call.
+var sdkMethods = map[string]bool{
+	ffpb.FlagService_Evaluate_FullMethodName:      true,
+	ffpb.FlagService_EvaluateBatch_FullMethodName: true,
+	ffpb.FlagService_StreamFlags_FullMethodName:   true,
+}
+
+// sdkRoutes returns the REST routes an SDK key may call, as method and path
+// template.
+func sdkRoutes(apiPrefix string) map[string]bool {
+	return map[string]bool{
+		"GET " + apiPrefix + "/checkhealth": true,
+		"POST " + apiPrefix + "/evaluate":   true,
+		"GET " + apiPrefix + "/stream":      true,
+		"GET " + apiPrefix + "/ws":          true,
+	}
+}
+
+// publicRoutes returns the path templates served without credentials even
+// when authentication is required.
+func publicRoutes(apiPrefix string) map[string]bool {
+	return map[string]bool{
+		apiPrefix + "/checkhealth": true,
+	}
+}
+
+// bearerToken returns the token of an Authorization header value.
+func bearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+// authenticate resolves the bearer token of a request into the principal
+// stored in the request context. SDK keys are refused on every route but
+// evaluation and streaming. Requests without credentials are refused unless
+// authentication is optional or the route is public.
+func authenticate(authn *auth.Authentication, responder *response.Responder, apiPrefix string) mux.MiddlewareFunc {
+	allowed := sdkRoutes(apiPrefix)
+	public := publicRoutes(apiPrefix)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var tmpl string
+			if route := mux.CurrentRoute(r); route != nil {
+				tmpl, _ = route.GetPathTemplate()
+			}
+
+			header := r.Header.Get("Authorization")
+			if header == "" {
+				if authn.Required && !public[tmpl] {
+					unauthorized(w, "missing credentials")
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+			token, ok := bearerToken(header)
+			if !ok {
+				unauthorized(w, "malformed Authorization header")
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+			principal, err := authn.Authenticator.Authenticate(ctx, token)
+			cancel()
+			if errors.Is(err, auth.ErrUnauthenticated) {
+				unauthorized(w, err.Error())
+				return
+			}
+			if err != nil {
+				handleError(responder, w, r, err)
+				return
+			}
+
+			if principal.IsSDK() && !allowed[r.Method+" "+tmpl] {
+				http.Error(w, "SDK keys may only evaluate and stream flags", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+// unauthorized rejects a request whose credentials could not be verified.
+// The responder cannot be used here as it always replies 200.
+func unauthorized(w http.ResponseWriter, msg string) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	http.Error(w, msg, http.StatusUnauthorized)
+}
+
+// GRPCServerOptions installs the interceptors that authenticate and
+// authorize gRPC calls the same way the REST API does.
+func GRPCServerOptions(conf *config.Config, authn *auth.Authentication, rbacSvc rbac.Service) []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			ctx, err := authenticateGRPC(ctx, authn, info.FullMethod)
+			if err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}, authorizeGRPC(rbacSvc, conf.DefaultProject, conf.DefaultEnvironment, conf.DevMode), auditMetadataGRPC),
+		grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx, err := authenticateGRPC(ss.Context(), authn, info.FullMethod)
+			if err != nil {
+				return err
+			}
+			return handler(srv, &authStream{ServerStream: ss, ctx: ctx})
+		}, authorizeGRPCStream(rbacSvc, conf.DefaultProject, conf.DefaultEnvironment, conf.DevMode)),
+	}
+}
+
+func authenticateGRPC(ctx context.Context, authn *auth.Authentication, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		if authn.Required {
+			return nil, status.Error(codes.Unauthenticated, "missing credentials")
+		}
+		return ctx, nil
+	}
+	token, ok := bearerToken(values[0])
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "malformed authorization metadata")
+	}
+
+	principal, err := authn.Authenticator.Authenticate(ctx, token)
+	if errors.Is(err, auth.ErrUnauthenticated) {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if principal.IsSDK() && !sdkMethods[method] {
+		return nil, status.Error(codes.PermissionDenied, "SDK keys may only evaluate and stream flags")
+	}
+	return auth.WithPrincipal(ctx, principal), nil
+}
+
+// authStream carries the authenticated context into a stream handler.
+type authStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,240 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/julianstephens/go-utils/httputil/request"
+	"github.com/julianstephens/go-utils/httputil/response"
+
+	"github.com/julianstephens/feature-flag-service/internal/dynconfig"
+)
+
+// registerConfigRoutes serves config entries. Keys contain slashes, so the
+// key route variable matches the rest of the path.
+func registerConfigRoutes(configRouter *mux.Router, responder *response.Responder, configSvc dynconfig.Service) {
+	configRouter.HandleFunc("", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+
+		res, err := configSvc.ListEntries(ctx, r.URL.Query().Get("prefix"))
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, res)
+	}).Methods("GET")
+	configRouter.HandleFunc("", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+
+		var req dynconfig.Entry
+		if err := request.DecodeJSON(r, &req); err != nil {
+			responder.BadRequest(w, r, err)
+			return
+		}
+
+		res, err := configSvc.CreateEntry(ctx, &req)
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.Created(w, r, res)
+	}).Methods("POST")
+	configRouter.HandleFunc("/{key:.+}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		res, err := configSvc.GetEntry(ctx, vars["key"])
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, res)
+	}).Methods("GET")
+	configRouter.HandleFunc("/{key:.+}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		var req dynconfig.EntryUpdate
+		if err := request.DecodeJSON(r, &req); err != nil {
+			responder.BadRequest(w, r, err)
+			return
+		}
+
+		res, err := configSvc.SetEntry(ctx, vars["key"], &req)
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, res)
+	}).Methods("PUT")
+	configRouter.HandleFunc("/{key:.+}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		err := configSvc.DeleteEntry(ctx, vars["key"])
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.NoContent(w, r)
+	}).Methods("DELETE")
+}
+
+// registerConfigSchemaRoutes serves the schemas attached to key prefixes.
+// Prefixes contain slashes, so the prefix route variable matches the rest of
+// the path.
+func registerConfigSchemaRoutes(schemaRouter *mux.Router, responder *response.Responder, configSvc dynconfig.Service) {
+	schemaRouter.HandleFunc("", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+
+		res, err := configSvc.ListSchemas(ctx)
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, res)
+	}).Methods("GET")
+	schemaRouter.HandleFunc("/{prefix:.+}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		res, err := configSvc.GetSchema(ctx, vars["prefix"])
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, res)
+	}).Methods("GET")
+	schemaRouter.HandleFunc("/{prefix:.+}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		var req dynconfig.SchemaUpdate
+		if err := request.DecodeJSON(r, &req); err != nil {
+			responder.BadRequest(w, r, err)
+			return
+		}
+
+		res, err := configSvc.SetSchema(ctx, vars["prefix"], &req)
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, res)
+	}).Methods("PUT")
+	schemaRouter.HandleFunc("/{prefix:.+}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		err := configSvc.DeleteSchema(ctx, vars["prefix"])
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.NoContent(w, r)
+	}).Methods("DELETE")
+}
+
+// registerConfigHistoryRoutes serves the versions of config entries. They
+// sit beside /config rather than below it, as keys may end in any segment.
+func registerConfigHistoryRoutes(apiGrp *mux.Router, responder *response.Responder, configSvc dynconfig.Service) {
+	apiGrp.HandleFunc("/config-versions/{key:.+}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		res, err := configSvc.ListEntryVersions(ctx, vars["key"])
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, res)
+	}).Methods("GET")
+	apiGrp.HandleFunc("/config-rollback/{key:.+}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		var req rollbackRequest
+		if err := request.DecodeJSON(r, &req); err != nil {
+			responder.BadRequest(w, r, err)
+			return
+		}
+
+		res, err := configSvc.RollbackEntry(ctx, vars["key"], req.Version)
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, res)
+	}).Methods("POST")
+}
+
+// streamConfig serves config events under the prefix query parameter as
+// Server-Sent Events. Every connection starts with a snapshot, so clients
+// reconnect without Last-Event-ID.
+func streamConfig(configSvc dynconfig.Service, heartbeat time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		events, err := configSvc.WatchEntries(r.Context(), r.URL.Query().Get("prefix"))
+		if err != nil {
+			log.Printf("error starting config stream: %v", err)
+			http.Error(w, "failed to start stream", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case ev, ok := <-events:
+				if !ok {
+					return
+				}
+				data, err := json.Marshal(ev)
+				if err != nil {
+					log.Printf("error encoding config event: %v", err)
+					return
+				}
+				if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Action, data); err != nil {
+					return
+				}
+				flusher.Flush()
+			case <-ticker.C:
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	}
+}
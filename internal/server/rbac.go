@@ -0,0 +1,537 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/julianstephens/go-utils/httputil/request"
+	"github.com/julianstephens/go-utils/httputil/response"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	ffpb "github.com/julianstephens/feature-flag-service/gen/go/grpc/v1/featureflag.v1"
+	"github.com/julianstephens/feature-flag-service/internal/auth"
+	"github.com/julianstephens/feature-flag-service/internal/rbac"
+)
+
+// errRBACUnavailable refuses requests needing a permission when the API runs
+// without RBAC outside dev mode.
+var errRBACUnavailable = fmt.Errorf("%w: RBAC is not configured", auth.ErrForbidden)
+
+// assignRoleRequest is the body of POST /rbac/users/{userId}/roles.
+type assignRoleRequest struct {
+	RoleID string `json:"roleId"`
+}
+
+// checkPermission authorizes principal for perm. SDK keys are not checked:
+// authentication already limits them to evaluating and streaming flags, and
+// Principal.Scope pins them to their own environment. Without rbacSvc every
+// permission is refused, or granted in dev mode.
+func checkPermission(ctx context.Context, rbacSvc rbac.Service, devMode bool, principal *auth.Principal, perm rbac.Permission) error {
+	if principal.IsSDK() || (rbacSvc == nil && devMode) {
+		return nil
+	}
+	if rbacSvc == nil {
+		return errRBACUnavailable
+	}
+	return rbacSvc.Authorize(ctx, principal, perm)
+}
+
+// restPermissions returns the permission each REST route requires, by
+// method and path template below the API prefix. Routes not listed are open
+// to every authenticated caller; POST /evaluate checks its permission itself
+// as the project and environment are in the body.
+func restPermissions(defaultProject, defaultEnvironment string) map[string]func(r *http.Request) rbac.Permission {
+	orDefault := func(key, def string) string {
+		if key == "" {
+			return def
+		}
+		return key
+	}
+	global := func(resource, action string) func(*http.Request) rbac.Permission {
+		return func(*http.Request) rbac.Permission {
+			return rbac.Permission{Resource: resource, Action: action}
+		}
+	}
+	project := func(resource, action string) func(*http.Request) rbac.Permission {
+		return func(r *http.Request) rbac.Permission {
+			return rbac.Permission{Resource: resource, Action: action, Project: orDefault(mux.Vars(r)["projectKey"], defaultProject)}
+		}
+	}
+	environment := func(resource, action string) func(*http.Request) rbac.Permission {
+		return func(r *http.Request) rbac.Permission {
+			vars := mux.Vars(r)
+			return rbac.Permission{Resource: resource, Action: action, Project: vars["projectKey"], Environment: orDefault(vars["envKey"], defaultEnvironment)}
+		}
+	}
+	// stream serves the flag streams, which name their project in the query.
+	stream := func(r *http.Request) rbac.Permission {
+		return rbac.Permission{Resource: rbac.ResourceFlags, Action: rbac.ActionRead, Project: orDefault(r.URL.Query().Get("project"), defaultProject)}
+	}
+
+	return map[string]func(*http.Request) rbac.Permission{
+		"GET /projects":                                                                 global(rbac.ResourceProjects, rbac.ActionRead),
+		"POST /projects":                                                                global(rbac.ResourceProjects, rbac.ActionWrite),
+		"GET /projects/{projectKey}":                                                    project(rbac.ResourceProjects, rbac.ActionRead),
+		"PUT /projects/{projectKey}":                                                    project(rbac.ResourceProjects, rbac.ActionWrite),
+		"DELETE /projects/{projectKey}":                                                 project(rbac.ResourceProjects, rbac.ActionWrite),
+		"GET /projects/{projectKey}/environments":                                       project(rbac.ResourceProjects, rbac.ActionRead),
+		"POST /projects/{projectKey}/environments":                                      project(rbac.ResourceProjects, rbac.ActionWrite),
+		"GET /projects/{projectKey}/environments/{envKey}":                              project(rbac.ResourceProjects, rbac.ActionRead),
+		"PUT /projects/{projectKey}/environments/{envKey}":                              project(rbac.ResourceProjects, rbac.ActionWrite),
+		"DELETE /projects/{projectKey}/environments/{envKey}":                           project(rbac.ResourceProjects, rbac.ActionWrite),
+		"GET /projects/{projectKey}/environments/{envKey}/flags/{flagKey}":              environment(rbac.ResourceFlags, rbac.ActionRead),
+		"PUT /projects/{projectKey}/environments/{envKey}/flags/{flagKey}":              environment(rbac.ResourceFlags, rbac.ActionWrite),
+		"GET /projects/{projectKey}/environments/{envKey}/flags/{flagKey}/dependencies": environment(rbac.ResourceFlags, rbac.ActionRead),
+		"GET /projects/{projectKey}/environments/{envKey}/sdkkeys":                      environment(rbac.ResourceSDKKeys, rbac.ActionRead),
+		"POST /projects/{projectKey}/environments/{envKey}/sdkkeys":                     environment(rbac.ResourceSDKKeys, rbac.ActionWrite),
+		"POST /projects/{projectKey}/environments/{envKey}/sdkkeys/rotate":              environment(rbac.ResourceSDKKeys, rbac.ActionWrite),
+		"DELETE /projects/{projectKey}/environments/{envKey}/sdkkeys/{keyId}":           environment(rbac.ResourceSDKKeys, rbac.ActionWrite),
+
+		"GET /flags":                                     project(rbac.ResourceFlags, rbac.ActionRead),
+		"POST /flags":                                    project(rbac.ResourceFlags, rbac.ActionWrite),
+		"GET /flags/{flagKey}":                           project(rbac.ResourceFlags, rbac.ActionRead),
+		"PUT /flags/{flagKey}":                           project(rbac.ResourceFlags, rbac.ActionWrite),
+		"DELETE /flags/{flagKey}":                        project(rbac.ResourceFlags, rbac.ActionWrite),
+		"POST /flags/{flagKey}/salt":                     project(rbac.ResourceFlags, rbac.ActionWrite),
+		"GET /flags/{flagKey}/versions":                  project(rbac.ResourceFlags, rbac.ActionRead),
+		"GET /flags/{flagKey}/versions/{version:[0-9]+}": project(rbac.ResourceFlags, rbac.ActionRead),
+		"POST /flags/{flagKey}/rollback":                 project(rbac.ResourceFlags, rbac.ActionWrite),
+		"GET /flags/{flagKey}/dependencies":              project(rbac.ResourceFlags, rbac.ActionRead),
+
+		"GET /projects/{projectKey}/flags":                                     project(rbac.ResourceFlags, rbac.ActionRead),
+		"POST /projects/{projectKey}/flags":                                    project(rbac.ResourceFlags, rbac.ActionWrite),
+		"GET /projects/{projectKey}/flags/{flagKey}":                           project(rbac.ResourceFlags, rbac.ActionRead),
+		"PUT /projects/{projectKey}/flags/{flagKey}":                           project(rbac.ResourceFlags, rbac.ActionWrite),
+		"DELETE /projects/{projectKey}/flags/{flagKey}":                        project(rbac.ResourceFlags, rbac.ActionWrite),
+		"POST /projects/{projectKey}/flags/{flagKey}/salt":                     project(rbac.ResourceFlags, rbac.ActionWrite),
+		"GET /projects/{projectKey}/flags/{flagKey}/versions":                  project(rbac.ResourceFlags, rbac.ActionRead),
+		"GET /projects/{projectKey}/flags/{flagKey}/versions/{version:[0-9]+}": project(rbac.ResourceFlags, rbac.ActionRead),
+		"POST /projects/{projectKey}/flags/{flagKey}/rollback":                 project(rbac.ResourceFlags, rbac.ActionWrite),
+		"GET /projects/{projectKey}/flags/{flagKey}/dependencies":              project(rbac.ResourceFlags, rbac.ActionRead),
+
+		"GET /stream": stream,
+		"GET /ws":     stream,
+
+		"GET /segments":                 global(rbac.ResourceSegments, rbac.ActionRead),
+		"POST /segments":                global(rbac.ResourceSegments, rbac.ActionWrite),
+		"GET /segments/{segmentKey}":    global(rbac.ResourceSegments, rbac.ActionRead),
+		"PUT /segments/{segmentKey}":    global(rbac.ResourceSegments, rbac.ActionWrite),
+		"DELETE /segments/{segmentKey}": global(rbac.ResourceSegments, rbac.ActionWrite),
+
+		"GET /audit":           global(rbac.ResourceAudit, rbac.ActionRead),
+		"GET /audit/{auditId}": global(rbac.ResourceAudit, rbac.ActionRead),
+
+		"GET /config":                        global(rbac.ResourceConfig, rbac.ActionRead),
+		"POST /config":                       global(rbac.ResourceConfig, rbac.ActionWrite),
+		"GET /config/{key:.+}":               global(rbac.ResourceConfig, rbac.ActionRead),
+		"PUT /config/{key:.+}":               global(rbac.ResourceConfig, rbac.ActionWrite),
+		"DELETE /config/{key:.+}":            global(rbac.ResourceConfig, rbac.ActionWrite),
+		"GET /config-schemas":                global(rbac.ResourceConfig, rbac.ActionRead),
+		"GET /config-schemas/{prefix:.+}":    global(rbac.ResourceConfig, rbac.ActionRead),
+		"PUT /config-schemas/{prefix:.+}":    global(rbac.ResourceConfig, rbac.ActionWrite),
+		"DELETE /config-schemas/{prefix:.+}": global(rbac.ResourceConfig, rbac.ActionWrite),
+		"GET /config-versions/{key:.+}":      global(rbac.ResourceConfig, rbac.ActionRead),
+		"POST /config-rollback/{key:.+}":     global(rbac.ResourceConfig, rbac.ActionWrite),
+		"GET /stream/config":                 global(rbac.ResourceConfig, rbac.ActionRead),
+
+		"GET /rbac/roles":                            global(rbac.ResourceRBAC, rbac.ActionRead),
+		"POST /rbac/roles":                           global(rbac.ResourceRBAC, rbac.ActionWrite),
+		"GET /rbac/roles/{roleId}":                   global(rbac.ResourceRBAC, rbac.ActionRead),
+		"PUT /rbac/roles/{roleId}":                   global(rbac.ResourceRBAC, rbac.ActionWrite),
+		"DELETE /rbac/roles/{roleId}":                global(rbac.ResourceRBAC, rbac.ActionWrite),
+		"GET /rbac/users":                            global(rbac.ResourceRBAC, rbac.ActionRead),
+		"POST /rbac/users":                           global(rbac.ResourceRBAC, rbac.ActionWrite),
+		"GET /rbac/users/{userId}":                   global(rbac.ResourceRBAC, rbac.ActionRead),
+		"PUT /rbac/users/{userId}":                   global(rbac.ResourceRBAC, rbac.ActionWrite),
+		"DELETE /rbac/users/{userId}":                global(rbac.ResourceRBAC, rbac.ActionWrite),
+		"GET /rbac/users/{userId}/roles":             global(rbac.ResourceRBAC, rbac.ActionRead),
+		"POST /rbac/users/{userId}/roles":            global(rbac.ResourceRBAC, rbac.ActionWrite),
+		"DELETE /rbac/users/{userId}/roles/{roleId}": global(rbac.ResourceRBAC, rbac.ActionWrite),
+	}
+}
+
+// authorize checks the route's permission against the roles of the
+// principal authenticate stored in the request context.
+func authorize(rbacSvc rbac.Service, responder *response.Responder, apiPrefix, defaultProject, defaultEnvironment string, devMode bool) mux.MiddlewareFunc {
+	perms := restPermissions(defaultProject, defaultEnvironment)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := mux.CurrentRoute(r)
+			if route == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			tmpl, _ := route.GetPathTemplate()
+			perm, ok := perms[r.Method+" "+strings.TrimPrefix(tmpl, apiPrefix)]
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+			err := checkPermission(ctx, rbacSvc, devMode, auth.FromContext(r.Context()), perm(r))
+			cancel()
+			if errors.Is(err, auth.ErrForbidden) {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			if err != nil {
+				handleError(responder, w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type projectRequest interface{ GetProject() string }
+
+type environmentRequest interface {
+	GetProject() string
+	GetEnvironment() string
+}
+
+// grpcPermissions returns the permission each gRPC method requires, checked
+// against the request or, for streams, the first message the client sends.
+// Methods not listed are open to every authenticated caller.
+func grpcPermissions(defaultProject, defaultEnvironment string) map[string]func(req any) rbac.Permission {
+	global := func(resource, action string) func(any) rbac.Permission {
+		return func(any) rbac.Permission {
+			return rbac.Permission{Resource: resource, Action: action}
+		}
+	}
+	project := func(resource, action string, key func(req any) string) func(any) rbac.Permission {
+		return func(req any) rbac.Permission {
+			p := key(req)
+			if p == "" {
+				p = defaultProject
+			}
+			return rbac.Permission{Resource: resource, Action: action, Project: p}
+		}
+	}
+	environment := func(resource, action string) func(any) rbac.Permission {
+		return func(req any) rbac.Permission {
+			r := req.(environmentRequest)
+			p, env := r.GetProject(), r.GetEnvironment()
+			if p == "" {
+				p = defaultProject
+			}
+			if env == "" {
+				env = defaultEnvironment
+			}
+			return rbac.Permission{Resource: resource, Action: action, Project: p, Environment: env}
+		}
+	}
+	projectField := func(req any) string { return req.(projectRequest).GetProject() }
+	keyField := func(req any) string { return req.(interface{ GetKey() string }).GetKey() }
+
+	return map[string]func(any) rbac.Permission{
+		ffpb.FlagService_GetFlag_FullMethodName:                   project(rbac.ResourceFlags, rbac.ActionRead, projectField),
+		ffpb.FlagService_ListFlags_FullMethodName:                 project(rbac.ResourceFlags, rbac.ActionRead, projectField),
+		ffpb.FlagService_ListFlagVersions_FullMethodName:          project(rbac.ResourceFlags, rbac.ActionRead, projectField),
+		ffpb.FlagService_GetFlagVersion_FullMethodName:            project(rbac.ResourceFlags, rbac.ActionRead, projectField),
+		ffpb.FlagService_GetFlagDependencies_FullMethodName:       environment(rbac.ResourceFlags, rbac.ActionRead),
+		ffpb.FlagService_Evaluate_FullMethodName:                  environment(rbac.ResourceFlags, rbac.ActionRead),
+		ffpb.FlagService_EvaluateBatch_FullMethodName:             environment(rbac.ResourceFlags, rbac.ActionRead),
+		ffpb.FlagService_StreamFlags_FullMethodName:               project(rbac.ResourceFlags, rbac.ActionRead, projectField),
+		ffpb.FlagService_CreateFlag_FullMethodName:                project(rbac.ResourceFlags, rbac.ActionWrite, projectField),
+		ffpb.FlagService_UpdateFlag_FullMethodName:                project(rbac.ResourceFlags, rbac.ActionWrite, projectField),
+		ffpb.FlagService_DeleteFlag_FullMethodName:                project(rbac.ResourceFlags, rbac.ActionWrite, projectField),
+		ffpb.FlagService_ResetFlagSalt_FullMethodName:             project(rbac.ResourceFlags, rbac.ActionWrite, projectField),
+		ffpb.FlagService_RollbackFlag_FullMethodName:              project(rbac.ResourceFlags, rbac.ActionWrite, projectField),
+		ffpb.FlagService_UpdateFlagEnvironment_FullMethodName:     environment(rbac.ResourceFlags, rbac.ActionWrite),
+		ffpb.ProjectService_GetProject_FullMethodName:             project(rbac.ResourceProjects, rbac.ActionRead, keyField),
+		ffpb.ProjectService_ListProjects_FullMethodName:           global(rbac.ResourceProjects, rbac.ActionRead),
+		ffpb.ProjectService_CreateProject_FullMethodName:          global(rbac.ResourceProjects, rbac.ActionWrite),
+		ffpb.ProjectService_UpdateProject_FullMethodName:          project(rbac.ResourceProjects, rbac.ActionWrite, keyField),
+		ffpb.ProjectService_DeleteProject_FullMethodName:          project(rbac.ResourceProjects, rbac.ActionWrite, keyField),
+		ffpb.ProjectService_CreateEnvironment_FullMethodName:      project(rbac.ResourceProjects, rbac.ActionWrite, projectField),
+		ffpb.ProjectService_UpdateEnvironment_FullMethodName:      project(rbac.ResourceProjects, rbac.ActionWrite, projectField),
+		ffpb.ProjectService_DeleteEnvironment_FullMethodName:      project(rbac.ResourceProjects, rbac.ActionWrite, projectField),
+		ffpb.SDKKeyService_ListSDKKeys_FullMethodName:             environment(rbac.ResourceSDKKeys, rbac.ActionRead),
+		ffpb.SDKKeyService_CreateSDKKey_FullMethodName:            environment(rbac.ResourceSDKKeys, rbac.ActionWrite),
+		ffpb.SDKKeyService_RotateSDKKeys_FullMethodName:           environment(rbac.ResourceSDKKeys, rbac.ActionWrite),
+		ffpb.SDKKeyService_RevokeSDKKey_FullMethodName:            environment(rbac.ResourceSDKKeys, rbac.ActionWrite),
+		ffpb.SegmentService_GetSegment_FullMethodName:             global(rbac.ResourceSegments, rbac.ActionRead),
+		ffpb.SegmentService_ListSegments_FullMethodName:           global(rbac.ResourceSegments, rbac.ActionRead),
+		ffpb.SegmentService_CreateSegment_FullMethodName:          global(rbac.ResourceSegments, rbac.ActionWrite),
+		ffpb.SegmentService_UpdateSegment_FullMethodName:          global(rbac.ResourceSegments, rbac.ActionWrite),
+		ffpb.SegmentService_DeleteSegment_FullMethodName:          global(rbac.ResourceSegments, rbac.ActionWrite),
+		ffpb.AuditService_ListAuditLogs_FullMethodName:            global(rbac.ResourceAudit, rbac.ActionRead),
+		ffpb.AuditService_GetAuditLog_FullMethodName:              global(rbac.ResourceAudit, rbac.ActionRead),
+		ffpb.ConfigService_GetConfigEntry_FullMethodName:          global(rbac.ResourceConfig, rbac.ActionRead),
+		ffpb.ConfigService_ListConfigEntries_FullMethodName:       global(rbac.ResourceConfig, rbac.ActionRead),
+		ffpb.ConfigService_ListConfigEntryVersions_FullMethodName: global(rbac.ResourceConfig, rbac.ActionRead),
+		ffpb.ConfigService_ListConfigSchemas_FullMethodName:       global(rbac.ResourceConfig, rbac.ActionRead),
+		ffpb.ConfigService_GetConfigSchema_FullMethodName:         global(rbac.ResourceConfig, rbac.ActionRead),
+		ffpb.ConfigService_WatchConfigEntries_FullMethodName:      global(rbac.ResourceConfig, rbac.ActionRead),
+		ffpb.ConfigService_CreateConfigEntry_FullMethodName:       global(rbac.ResourceConfig, rbac.ActionWrite),
+		ffpb.ConfigService_SetConfigEntry_FullMethodName:          global(rbac.ResourceConfig, rbac.ActionWrite),
+		ffpb.ConfigService_DeleteConfigEntry_FullMethodName:       global(rbac.ResourceConfig, rbac.ActionWrite),
+		ffpb.ConfigService_SetConfigSchema_FullMethodName:         global(rbac.ResourceConfig, rbac.ActionWrite),
+		ffpb.ConfigService_DeleteConfigSchema_FullMethodName:      global(rbac.ResourceConfig, rbac.ActionWrite),
+		ffpb.ConfigService_RollbackConfigEntry_FullMethodName:     global(rbac.ResourceConfig, rbac.ActionWrite),
+		ffpb.RBACService_ListRoles_FullMethodName:                 global(rbac.ResourceRBAC, rbac.ActionRead),
+		ffpb.RBACService_GetRole_FullMethodName:                   global(rbac.ResourceRBAC, rbac.ActionRead),
+		ffpb.RBACService_ListUsers_FullMethodName:                 global(rbac.ResourceRBAC, rbac.ActionRead),
+		ffpb.RBACService_GetUser_FullMethodName:                   global(rbac.ResourceRBAC, rbac.ActionRead),
+		ffpb.RBACService_ListUserRoles_FullMethodName:             global(rbac.ResourceRBAC, rbac.ActionRead),
+		ffpb.RBACService_CreateRole_FullMethodName:                global(rbac.ResourceRBAC, rbac.ActionWrite),
+		ffpb.RBACService_UpdateRole_FullMethodName:                global(rbac.ResourceRBAC, rbac.ActionWrite),
+		ffpb.RBACService_DeleteRole_FullMethodName:                global(rbac.ResourceRBAC, rbac.ActionWrite),
+		ffpb.RBACService_CreateUser_FullMethodName:                global(rbac.ResourceRBAC, rbac.ActionWrite),
+		ffpb.RBACService_UpdateUser_FullMethodName:                global(rbac.ResourceRBAC, rbac.ActionWrite),
+		ffpb.RBACService_DeleteUser_FullMethodName:                global(rbac.ResourceRBAC, rbac.ActionWrite),
+		ffpb.RBACService_AssignRole_FullMethodName:                global(rbac.ResourceRBAC, rbac.ActionWrite),
+		ffpb.RBACService_RemoveRole_FullMethodName:                global(rbac.ResourceRBAC, rbac.ActionWrite),
+	}
+}
+
+// grpcAuthError converts a checkPermission error to a gRPC status.
+func grpcAuthError(err error) error {
+	if errors.Is(err, auth.ErrForbidden) {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// authorizeGRPC is the unary interceptor counterpart of authorize. It runs
+// after authentication has stored the principal in ctx.
+func authorizeGRPC(rbacSvc rbac.Service, defaultProject, defaultEnvironment string, devMode bool) grpc.UnaryServerInterceptor {
+	perms := grpcPermissions(defaultProject, defaultEnvironment)
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		perm, ok := perms[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+		if err := checkPermission(ctx, rbacSvc, devMode, auth.FromContext(ctx), perm(req)); err != nil {
+			return nil, grpcAuthError(err)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// authorizeGRPCStream is the stream interceptor counterpart of authorize.
+// The streams served here take a single request, so the permission is
+// checked against the first message the handler receives.
+func authorizeGRPCStream(rbacSvc rbac.Service, defaultProject, defaultEnvironment string, devMode bool) grpc.StreamServerInterceptor {
+	perms := grpcPermissions(defaultProject, defaultEnvironment)
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		perm, ok := perms[info.FullMethod]
+		if !ok {
+			return handler(srv, ss)
+		}
+		return handler(srv, &authorizedStream{ServerStream: ss, authorize: func(req any) error {
+			return checkPermission(ss.Context(), rbacSvc, devMode, auth.FromContext(ss.Context()), perm(req))
+		}})
+	}
+}
+
+// authorizedStream authorizes the first message received on a stream before
+// handing it to the handler.
+type authorizedStream struct {
+	grpc.ServerStream
+	authorize func(req any) error
+}
+
+func (s *authorizedStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if authorize := s.authorize; authorize != nil {
+		s.authorize = nil
+		if err := authorize(m); err != nil {
+			return grpcAuthError(err)
+		}
+	}
+	return nil
+}
+
+// registerRBACRoutes serves users, roles and role assignments.
+func registerRBACRoutes(rbacRouter *mux.Router, responder *response.Responder, rbacSvc rbac.Service) {
+	rbacRouter.HandleFunc("/roles", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+
+		res, err := rbacSvc.ListRoles(ctx)
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, res)
+	}).Methods("GET")
+	rbacRouter.HandleFunc("/roles", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+
+		var req rbac.Role
+		if err := request.DecodeJSON(r, &req); err != nil {
+			responder.BadRequest(w, r, err)
+			return
+		}
+
+		res, err := rbacSvc.CreateRole(ctx, &req)
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.Created(w, r, res)
+	}).Methods("POST")
+	rbacRouter.HandleFunc("/roles/{roleId}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		res, err := rbacSvc.GetRole(ctx, vars["roleId"])
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, res)
+	}).Methods("GET")
+	rbacRouter.HandleFunc("/roles/{roleId}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		var req rbac.RoleUpdate
+		if err := request.DecodeJSON(r, &req); err != nil {
+			responder.BadRequest(w, r, err)
+			return
+		}
+
+		res, err := rbacSvc.UpdateRole(ctx, vars["roleId"], &req)
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, res)
+	}).Methods("PUT")
+	rbacRouter.HandleFunc("/roles/{roleId}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		if err := rbacSvc.DeleteRole(ctx, vars["roleId"]); err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.NoContent(w, r)
+	}).Methods("DELETE")
+
+	rbacRouter.HandleFunc("/users", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+
+		res, err := rbacSvc.ListUsers(ctx)
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, res)
+	}).Methods("GET")
+	rbacRouter.HandleFunc("/users", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+
+		req := rbac.User{Active: true}
+		if err := request.DecodeJSON(r, &req); err != nil {
+			responder.BadRequest(w, r, err)
+			return
+		}
+
+		res, err := rbacSvc.CreateUser(ctx, &req)
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.Created(w, r, res)
+	}).Methods("POST")
+	rbacRouter.HandleFunc("/users/{userId}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		res, err := rbacSvc.GetUser(ctx, vars["userId"])
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, res)
+	}).Methods("GET")
+	rbacRouter.HandleFunc("/users/{userId}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		var req rbac.UserUpdate
+		if err := request.DecodeJSON(r, &req); err != nil {
+			responder.BadRequest(w, r, err)
+			return
+		}
+
+		res, err := rbacSvc.UpdateUser(ctx, vars["userId"], &req)
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, res)
+	}).Methods("PUT")
+	rbacRouter.HandleFunc("/users/{userId}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		if err := rbacSvc.DeleteUser(ctx, vars["userId"]); err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.NoContent(w, r)
+	}).Methods("DELETE")
+	rbacRouter.HandleFunc("/users/{userId}/roles", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		res, err := rbacSvc.ListUserRoles(ctx, vars["userId"])
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, res)
+	}).Methods("GET")
+	rbacRouter.HandleFunc("/users/{userId}/roles", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		var req assignRoleRequest
+		if err := request.DecodeJSON(r, &req); err != nil {
+			responder.BadRequest(w, r, err)
+			return
+		}
+
+		if err := rbacSvc.AssignRole(ctx, vars["userId"], req.RoleID); err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.NoContent(w, r)
+	}).Methods("POST")
+	rbacRouter.HandleFunc("/users/{userId}/roles/{roleId}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		if err := rbacSvc.RemoveRole(ctx, vars["userId"], vars["roleId"]); err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.NoContent(w, r)
+	}).Methods("DELETE")
+}
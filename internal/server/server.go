@@ -2,17 +2,29 @@ package server
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
-	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
 	"google.golang.org/grpc"
 
 	ffpb "github.com/julianstephens/feature-flag-service/gen/go/grpc/v1/featureflag.v1"
+	"github.com/julianstephens/feature-flag-service/internal/audit"
+	"github.com/julianstephens/feature-flag-service/internal/auth"
 	"github.com/julianstephens/feature-flag-service/internal/config"
+	"github.com/julianstephens/feature-flag-service/internal/dynconfig"
 	"github.com/julianstephens/feature-flag-service/internal/flag"
+	"github.com/julianstephens/feature-flag-service/internal/project"
+	"github.com/julianstephens/feature-flag-service/internal/rbac"
+	"github.com/julianstephens/feature-flag-service/internal/schema"
+	"github.com/julianstephens/feature-flag-service/internal/segment"
+	"github.com/julianstephens/feature-flag-service/internal/storage"
 	"github.com/julianstephens/go-utils/httputil/request"
 	"github.com/julianstephens/go-utils/httputil/response"
 )
@@ -22,6 +34,33 @@ const (
 	DEFAULT_TIMEOUT = 30 * time.Second
 )
 
+// evaluateRequest evaluates Flags, or every flag when empty, for Context in
+// the given project and environment, or the configured defaults.
+type evaluateRequest struct {
+	Project     string                 `json:"project,omitempty"`
+	Environment string                 `json:"environment,omitempty"`
+	Context     flag.EvaluationContext `json:"context"`
+	Flags       []string               `json:"flags,omitempty"`
+}
+
+type evaluateResponse struct {
+	Results []*flag.Evaluation `json:"results"`
+}
+
+// flagEnvironmentResponse is the state of a flag in one environment.
+type flagEnvironmentResponse struct {
+	FlagID      string                `json:"flagId"`
+	FlagKey     string                `json:"flagKey,omitempty"`
+	Project     string                `json:"project"`
+	Environment string                `json:"environment"`
+	State       *flag.FlagEnvironment `json:"state"`
+}
+
+// rollbackRequest names the version a flag or config entry is restored to.
+type rollbackRequest struct {
+	Version int64 `json:"version"`
+}
+
 func StartREST(addr string, conf *config.Config, services ...any) error {
 	responder := response.NewWithLogging()
 	router := mux.NewRouter()
@@ -35,90 +74,409 @@ func StartREST(addr string, conf *config.Config, services ...any) error {
 		switch s := svc.(type) {
 		case flag.Service:
 			servicesMap["flagService"] = s
-		// case config.Service: --- IGNORE ---
-		// 	servicesMap["configService"] = s --- IGNORE ---
-		// case audit.Service: --- IGNORE ---
-		// 	servicesMap["auditService"] = s --- IGNORE ---
-		// case rbac.Service: --- IGNORE ---
-		// 	servicesMap["rbacService"] = s --- IGNORE ---
+		case segment.Service:
+			servicesMap["segmentService"] = s
+		case project.Service:
+			servicesMap["projectService"] = s
+		case auth.Service:
+			servicesMap["sdkKeyService"] = s
+		case *auth.Authentication:
+			servicesMap["authentication"] = s
+		case dynconfig.Service:
+			servicesMap["configService"] = s
+		case audit.Service:
+			servicesMap["auditService"] = s
+		case rbac.Service:
+			servicesMap["rbacService"] = s
 		default:
 			log.Printf("Warning: Unknown service type %T provided to StartREST", s)
 		}
 	}
 
-	
-	flagSvc := servicesMap["flagService"].(flag.Service)
-	flags := apiGrp.PathPrefix("/flags").Subrouter()
-	flags.HandleFunc("", func(w http.ResponseWriter, r *http.Request) {
-		ctx, cancel := context.WithTimeout(context.Background(), DEFAULT_TIMEOUT)
+	authn := servicesMap["authentication"].(*auth.Authentication)
+	router.Use(authenticate(authn, responder, "/api/"+conf.APIVersion))
+	rbacSvc, _ := servicesMap["rbacService"].(rbac.Service)
+	router.Use(authorize(rbacSvc, responder, "/api/"+conf.APIVersion, conf.DefaultProject, conf.DefaultEnvironment, conf.DevMode))
+	router.Use(auditMetadata)
+
+	projectSvc := servicesMap["projectService"].(project.Service)
+	projects := apiGrp.PathPrefix("/projects").Subrouter()
+	projects.HandleFunc("", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
 		defer cancel()
 
-		res, err := flagSvc.ListFlags(ctx)
+		res, err := projectSvc.ListProjects(ctx)
 		if err != nil {
 			handleError(responder, w, r, err)
 			return
 		}
 		responder.OK(w, r, res)
 	}).Methods("GET")
-	flags.HandleFunc("", func(w http.ResponseWriter, r *http.Request) {
-		ctx, cancel := context.WithTimeout(context.Background(), DEFAULT_TIMEOUT)
+	projects.HandleFunc("", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
 		defer cancel()
 
-		var req ffpb.CreateFlagRequest
+		var req project.Project
 		if err := request.DecodeJSON(r, &req); err != nil {
 			responder.BadRequest(w, r, err)
 			return
 		}
 
-		res, err := flagSvc.CreateFlag(ctx, req.Name, req.Description, req.Enabled)
+		res, err := projectSvc.CreateProject(ctx, &req)
 		if err != nil {
 			handleError(responder, w, r, err)
 			return
 		}
 		responder.Created(w, r, res)
 	}).Methods("POST")
-	flags.HandleFunc("/{flagKey}", func(w http.ResponseWriter, r *http.Request) {
-		ctx, cancel := context.WithTimeout(context.Background(), DEFAULT_TIMEOUT)
+	projects.HandleFunc("/{projectKey}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+		projectKey := vars["projectKey"]
+
+		res, err := projectSvc.GetProject(ctx, projectKey)
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, res)
+	}).Methods("GET")
+	projects.HandleFunc("/{projectKey}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
 		defer cancel()
+		vars := mux.Vars(r)
+		projectKey := vars["projectKey"]
 
+		var req project.Project
+		if err := request.DecodeJSON(r, &req); err != nil {
+			responder.BadRequest(w, r, err)
+			return
+		}
+
+		res, err := projectSvc.UpdateProject(ctx, projectKey, &req)
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, res)
+	}).Methods("PUT")
+	projects.HandleFunc("/{projectKey}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+		projectKey := vars["projectKey"]
+
+		err := projectSvc.DeleteProject(ctx, projectKey)
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.NoContent(w, r)
+	}).Methods("DELETE")
+	projects.HandleFunc("/{projectKey}/environments", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+		projectKey := vars["projectKey"]
+
+		res, err := projectSvc.GetProject(ctx, projectKey)
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, res.Environments)
+	}).Methods("GET")
+	projects.HandleFunc("/{projectKey}/environments", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
 		vars := mux.Vars(r)
-		flagKey := vars["flagKey"]
+		projectKey := vars["projectKey"]
+
+		var req project.Environment
+		if err := request.DecodeJSON(r, &req); err != nil {
+			responder.BadRequest(w, r, err)
+			return
+		}
 
-		res, err := flagSvc.GetFlag(ctx, flagKey)
+		res, err := projectSvc.CreateEnvironment(ctx, projectKey, &req)
 		if err != nil {
 			handleError(responder, w, r, err)
 			return
 		}
+		responder.Created(w, r, res)
+	}).Methods("POST")
+	projects.HandleFunc("/{projectKey}/environments/{envKey}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
 
+		res, err := projectSvc.GetEnvironment(ctx, vars["projectKey"], vars["envKey"])
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
 		responder.OK(w, r, res)
 	}).Methods("GET")
-	flags.HandleFunc("/{flagKey}", func(w http.ResponseWriter, r *http.Request) {
-		ctx, cancel := context.WithTimeout(context.Background(), DEFAULT_TIMEOUT)
+	projects.HandleFunc("/{projectKey}/environments/{envKey}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
 		defer cancel()
 		vars := mux.Vars(r)
-		flagKey := vars["flagKey"]
 
-		var req ffpb.UpdateFlagRequest
+		var req project.Environment
 		if err := request.DecodeJSON(r, &req); err != nil {
 			responder.BadRequest(w, r, err)
 			return
 		}
-		
-		res, err := flagSvc.UpdateFlag(ctx, flagKey, req.Name, req.Description, req.Enabled)
+
+		res, err := projectSvc.UpdateEnvironment(ctx, vars["projectKey"], vars["envKey"], &req)
 		if err != nil {
 			handleError(responder, w, r, err)
 			return
 		}
+		responder.OK(w, r, res)
+	}).Methods("PUT")
+	projects.HandleFunc("/{projectKey}/environments/{envKey}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
 
+		err := projectSvc.DeleteEnvironment(ctx, vars["projectKey"], vars["envKey"])
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.NoContent(w, r)
+	}).Methods("DELETE")
+
+	keySvc := servicesMap["sdkKeyService"].(auth.Service)
+	projects.HandleFunc("/{projectKey}/environments/{envKey}/sdkkeys", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		res, err := keySvc.ListSDKKeys(ctx, vars["projectKey"], vars["envKey"])
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
 		responder.OK(w, r, res)
+	}).Methods("GET")
+	projects.HandleFunc("/{projectKey}/environments/{envKey}/sdkkeys", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		res, err := keySvc.CreateSDKKey(ctx, vars["projectKey"], vars["envKey"])
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.Created(w, r, res)
+	}).Methods("POST")
+	projects.HandleFunc("/{projectKey}/environments/{envKey}/sdkkeys/rotate", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		var grace *time.Duration
+		if v := r.URL.Query().Get("gracePeriod"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				responder.BadRequest(w, r, errors.New("gracePeriod must be a non-negative duration"))
+				return
+			}
+			grace = &d
+		}
+
+		res, err := keySvc.RotateSDKKeys(ctx, vars["projectKey"], vars["envKey"], grace)
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.Created(w, r, res)
+	}).Methods("POST")
+	projects.HandleFunc("/{projectKey}/environments/{envKey}/sdkkeys/{keyId}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		err := keySvc.RevokeSDKKey(ctx, vars["projectKey"], vars["envKey"], vars["keyId"])
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.NoContent(w, r)
+	}).Methods("DELETE")
+
+	flagSvc := servicesMap["flagService"].(flag.Service)
+	// The unscoped flag routes predate projects and act on the default
+	// project.
+	registerFlagRoutes(apiGrp.PathPrefix("/flags").Subrouter(), responder, flagSvc)
+	registerFlagRoutes(projects.PathPrefix("/{projectKey}/flags").Subrouter(), responder, flagSvc)
+	projects.HandleFunc("/{projectKey}/environments/{envKey}/flags/{flagKey}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		if _, err := projectSvc.GetEnvironment(ctx, vars["projectKey"], vars["envKey"]); err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		res, err := flagSvc.GetFlag(ctx, vars["projectKey"], vars["flagKey"])
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, flagEnvironmentResponse{
+			FlagID:      res.ID,
+			FlagKey:     res.Key,
+			Project:     res.Project,
+			Environment: vars["envKey"],
+			State:       res.Environment(vars["envKey"]),
+		})
+	}).Methods("GET")
+	projects.HandleFunc("/{projectKey}/environments/{envKey}/flags/{flagKey}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		var req flag.FlagEnvironment
+		if err := request.DecodeJSON(r, &req); err != nil {
+			responder.BadRequest(w, r, err)
+			return
+		}
+
+		res, err := flagSvc.UpdateFlagEnvironment(ctx, vars["projectKey"], vars["envKey"], vars["flagKey"], &req)
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, flagEnvironmentResponse{
+			FlagID:      res.ID,
+			FlagKey:     res.Key,
+			Project:     res.Project,
+			Environment: vars["envKey"],
+			State:       res.Environment(vars["envKey"]),
+		})
 	}).Methods("PUT")
-	flags.HandleFunc("/{flagKey}", func(w http.ResponseWriter, r *http.Request) {
-		ctx, cancel := context.WithTimeout(context.Background(), DEFAULT_TIMEOUT)
+	projects.HandleFunc("/{projectKey}/environments/{envKey}/flags/{flagKey}/dependencies", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		res, err := flagSvc.GetFlagDependencies(ctx, vars["projectKey"], vars["envKey"], vars["flagKey"])
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, res)
+	}).Methods("GET")
+	apiGrp.HandleFunc("/evaluate", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+
+		var req evaluateRequest
+		if err := request.DecodeJSON(r, &req); err != nil {
+			responder.BadRequest(w, r, err)
+			return
+		}
+
+		principal := auth.FromContext(r.Context())
+		projectKey, env, err := principal.Scope(req.Project, req.Environment)
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		perm := rbac.Permission{Resource: rbac.ResourceFlags, Action: rbac.ActionRead, Project: projectKey, Environment: env}
+		if perm.Project == "" {
+			perm.Project = conf.DefaultProject
+		}
+		if perm.Environment == "" {
+			perm.Environment = conf.DefaultEnvironment
+		}
+		if err := checkPermission(ctx, rbacSvc, conf.DevMode, principal, perm); err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+
+		res, err := flagSvc.EvaluateFlags(ctx, projectKey, env, req.Flags, &req.Context)
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, evaluateResponse{Results: res})
+	}).Methods("POST")
+
+	segmentSvc := servicesMap["segmentService"].(segment.Service)
+	segments := apiGrp.PathPrefix("/segments").Subrouter()
+	segments.HandleFunc("", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+
+		res, err := segmentSvc.ListSegments(ctx)
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, res)
+	}).Methods("GET")
+	segments.HandleFunc("", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+
+		var req segment.Segment
+		if err := request.DecodeJSON(r, &req); err != nil {
+			responder.BadRequest(w, r, err)
+			return
+		}
+
+		res, err := segmentSvc.CreateSegment(ctx, &req)
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.Created(w, r, res)
+	}).Methods("POST")
+	segments.HandleFunc("/{segmentKey}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+		segmentKey := vars["segmentKey"]
+
+		res, err := segmentSvc.GetSegment(ctx, segmentKey)
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, res)
+	}).Methods("GET")
+	segments.HandleFunc("/{segmentKey}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
 		defer cancel()
 		vars := mux.Vars(r)
-		flagKey := vars["flagKey"]
+		segmentKey := vars["segmentKey"]
+
+		var req segment.Segment
+		if err := request.DecodeJSON(r, &req); err != nil {
+			responder.BadRequest(w, r, err)
+			return
+		}
 
-		err := flagSvc.DeleteFlag(ctx, flagKey)
+		res, err := segmentSvc.UpdateSegment(ctx, segmentKey, &req)
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, res)
+	}).Methods("PUT")
+	segments.HandleFunc("/{segmentKey}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+		segmentKey := vars["segmentKey"]
+
+		err := segmentSvc.DeleteSegment(ctx, segmentKey)
 		if err != nil {
 			handleError(responder, w, r, err)
 			return
@@ -126,6 +484,24 @@ func StartREST(addr string, conf *config.Config, services ...any) error {
 		responder.NoContent(w, r)
 	}).Methods("DELETE")
 
+	// RBAC, audit and config are backed by Postgres and left out when the
+	// API runs without it.
+	if rbacSvc != nil {
+		registerRBACRoutes(apiGrp.PathPrefix("/rbac").Subrouter(), responder, rbacSvc)
+	}
+	if auditSvc, ok := servicesMap["auditService"].(audit.Service); ok {
+		registerAuditRoutes(apiGrp.PathPrefix("/audit").Subrouter(), responder, auditSvc)
+	}
+
+	apiGrp.HandleFunc("/stream", streamFlags(flagSvc, conf.StreamHeartbeat)).Methods("GET")
+	apiGrp.HandleFunc("/ws", streamFlagsWS(flagSvc, conf.StreamHeartbeat)).Methods("GET")
+	if configSvc, ok := servicesMap["configService"].(dynconfig.Service); ok {
+		registerConfigRoutes(apiGrp.PathPrefix("/config").Subrouter(), responder, configSvc)
+		registerConfigSchemaRoutes(apiGrp.PathPrefix("/config-schemas").Subrouter(), responder, configSvc)
+		registerConfigHistoryRoutes(apiGrp, responder, configSvc)
+		apiGrp.HandleFunc("/stream/config", streamConfig(configSvc, conf.StreamHeartbeat)).Methods("GET")
+	}
+
 	srv := &http.Server{
 		Addr:    addr,
 		Handler: router,
@@ -134,21 +510,313 @@ func StartREST(addr string, conf *config.Config, services ...any) error {
 	return srv.ListenAndServe()
 }
 
-func RegisterGRPC(grpcServer *grpc.Server, flagSvc flag.Service) {
-	ffpb.RegisterFlagServiceServer(grpcServer, &flag.FlagGRPCServer{
-		UnimplementedFlagServiceServer: ffpb.UnimplementedFlagServiceServer{},
-		Service:                        flagSvc,
-	})
+// registerFlagRoutes serves the flags of the project named by the projectKey
+// route variable, or of the default project when the route has none.
+func registerFlagRoutes(flags *mux.Router, responder *response.Responder, flagSvc flag.Service) {
+	flags.HandleFunc("", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		res, err := flagSvc.ListFlags(ctx, vars["projectKey"])
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, res)
+	}).Methods("GET")
+	flags.HandleFunc("", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		var req flag.Flag
+		if err := request.DecodeJSON(r, &req); err != nil {
+			responder.BadRequest(w, r, err)
+			return
+		}
+
+		res, err := flagSvc.CreateFlag(ctx, vars["projectKey"], &req)
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.Created(w, r, res)
+	}).Methods("POST")
+	flags.HandleFunc("/{flagKey}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		res, err := flagSvc.GetFlag(ctx, vars["projectKey"], vars["flagKey"])
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		w.Header().Set("ETag", flagETag(res))
+		responder.OK(w, r, res)
+	}).Methods("GET")
+	// PUT and DELETE honour If-Match; on PUT it takes precedence over the
+	// revision in the body.
+	flags.HandleFunc("/{flagKey}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		var req flag.Flag
+		if err := request.DecodeJSON(r, &req); err != nil {
+			responder.BadRequest(w, r, err)
+			return
+		}
+		revision, err := ifMatch(r)
+		if err != nil {
+			responder.BadRequest(w, r, err)
+			return
+		}
+		if revision != 0 {
+			req.Revision = revision
+		}
+
+		res, err := flagSvc.UpdateFlag(ctx, vars["projectKey"], vars["flagKey"], &req)
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		w.Header().Set("ETag", flagETag(res))
+		responder.OK(w, r, res)
+	}).Methods("PUT")
+	flags.HandleFunc("/{flagKey}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		revision, err := ifMatch(r)
+		if err != nil {
+			responder.BadRequest(w, r, err)
+			return
+		}
+
+		err = flagSvc.DeleteFlag(ctx, vars["projectKey"], vars["flagKey"], revision)
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.NoContent(w, r)
+	}).Methods("DELETE")
+	flags.HandleFunc("/{flagKey}/salt", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		res, err := flagSvc.ResetFlagSalt(ctx, vars["projectKey"], vars["flagKey"])
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, res)
+	}).Methods("POST")
+	flags.HandleFunc("/{flagKey}/versions", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		res, err := flagSvc.ListFlagVersions(ctx, vars["projectKey"], vars["flagKey"])
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, res)
+	}).Methods("GET")
+	flags.HandleFunc("/{flagKey}/versions/{version:[0-9]+}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		version, err := strconv.ParseInt(vars["version"], 10, 64)
+		if err != nil {
+			responder.BadRequest(w, r, err)
+			return
+		}
+
+		res, err := flagSvc.GetFlagVersion(ctx, vars["projectKey"], vars["flagKey"], version)
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, res)
+	}).Methods("GET")
+	flags.HandleFunc("/{flagKey}/rollback", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		var req rollbackRequest
+		if err := request.DecodeJSON(r, &req); err != nil {
+			responder.BadRequest(w, r, err)
+			return
+		}
+
+		res, err := flagSvc.RollbackFlag(ctx, vars["projectKey"], vars["flagKey"], req.Version)
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, res)
+	}).Methods("POST")
+	// Dependencies are per environment; ?environment= picks one other than
+	// the default.
+	flags.HandleFunc("/{flagKey}/dependencies", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DEFAULT_TIMEOUT)
+		defer cancel()
+		vars := mux.Vars(r)
+
+		res, err := flagSvc.GetFlagDependencies(ctx, vars["projectKey"], r.URL.Query().Get("environment"), vars["flagKey"])
+		if err != nil {
+			handleError(responder, w, r, err)
+			return
+		}
+		responder.OK(w, r, res)
+	}).Methods("GET")
+}
+
+// flagETag is the entity tag of a flag: its revision, quoted.
+func flagETag(f *flag.Flag) string {
+	return strconv.Quote(strconv.FormatInt(f.Revision, 10))
+}
+
+// ifMatch returns the flag revision the If-Match header requires, or zero
+// when there is no header or it is "*". Only a single strong entity tag as
+// sent in ETag is accepted.
+func ifMatch(r *http.Request) (int64, error) {
+	tag := strings.TrimSpace(r.Header.Get("If-Match"))
+	if tag == "" || tag == "*" {
+		return 0, nil
+	}
+	unquoted, err := strconv.Unquote(tag)
+	if err != nil {
+		return 0, fmt.Errorf("invalid If-Match header %s", tag)
+	}
+	revision, err := strconv.ParseInt(unquoted, 10, 64)
+	if err != nil || revision <= 0 {
+		return 0, fmt.Errorf("invalid If-Match header %s", tag)
+	}
+	return revision, nil
+}
+
+func RegisterGRPC(grpcServer *grpc.Server, services ...any) {
+	for _, svc := range services {
+		switch s := svc.(type) {
+		case flag.Service:
+			ffpb.RegisterFlagServiceServer(grpcServer, &flag.FlagGRPCServer{
+				UnimplementedFlagServiceServer: ffpb.UnimplementedFlagServiceServer{},
+				Service:                        s,
+			})
+		case segment.Service:
+			ffpb.RegisterSegmentServiceServer(grpcServer, &segment.SegmentGRPCServer{
+				UnimplementedSegmentServiceServer: ffpb.UnimplementedSegmentServiceServer{},
+				Service:                           s,
+			})
+		case project.Service:
+			ffpb.RegisterProjectServiceServer(grpcServer, &project.ProjectGRPCServer{
+				UnimplementedProjectServiceServer: ffpb.UnimplementedProjectServiceServer{},
+				Service:                           s,
+			})
+		case auth.Service:
+			ffpb.RegisterSDKKeyServiceServer(grpcServer, &auth.SDKKeyGRPCServer{
+				UnimplementedSDKKeyServiceServer: ffpb.UnimplementedSDKKeyServiceServer{},
+				Service:                          s,
+			})
+		case rbac.Service:
+			ffpb.RegisterRBACServiceServer(grpcServer, &rbac.RBACGRPCServer{
+				UnimplementedRBACServiceServer: ffpb.UnimplementedRBACServiceServer{},
+				Service:                        s,
+			})
+		case audit.Service:
+			ffpb.RegisterAuditServiceServer(grpcServer, &audit.AuditGRPCServer{
+				UnimplementedAuditServiceServer: ffpb.UnimplementedAuditServiceServer{},
+				Service:                         s,
+			})
+		case dynconfig.Service:
+			ffpb.RegisterConfigServiceServer(grpcServer, &dynconfig.ConfigGRPCServer{
+				UnimplementedConfigServiceServer: ffpb.UnimplementedConfigServiceServer{},
+				Service:                          s,
+			})
+		default:
+			log.Printf("Warning: Unknown service type %T provided to RegisterGRPC", s)
+		}
+	}
+}
+
+// errorResponse is the Error schema of the REST API.
+type errorResponse struct {
+	Message string `json:"message"`
+	Code    string `json:"code,omitempty"`
+	Details any    `json:"details,omitempty"`
+}
+
+// writeError sends an error response. Unlike the responder it sets the
+// status before writing the body, so the status reaches the client.
+func writeError(w http.ResponseWriter, status int, res *errorResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		log.Printf("error writing error response: %v", err)
+	}
 }
 
 func handleError(responder *response.Responder, w http.ResponseWriter, r *http.Request, err error) {
-	switch err {
-	case context.Canceled:
+	var verr *schema.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		writeError(w, http.StatusBadRequest, &errorResponse{
+			Message: err.Error(),
+			Code:    "SCHEMA_VALIDATION_FAILED",
+			Details: map[string]any{"violations": verr.Violations},
+		})
+	case errors.Is(err, context.Canceled):
 		responder.Error(w, r, err)
-	case context.DeadlineExceeded:
+	case errors.Is(err, context.DeadlineExceeded):
 		responder.Error(w, r, err)
-	case rpctypes.ErrEmptyKey:
+	case errors.Is(err, storage.ErrEmptyKey):
+		responder.BadRequest(w, r, err)
+	case errors.Is(err, flag.ErrInvalidFlag), errors.Is(err, flag.ErrFlagHasDependents):
+		responder.BadRequest(w, r, err)
+	case errors.Is(err, flag.ErrFlagKeyExists):
+		writeError(w, http.StatusConflict, &errorResponse{Message: err.Error(), Code: "CONFLICT"})
+	case errors.Is(err, flag.ErrFlagNotFound), errors.Is(err, flag.ErrFlagVersionNotFound):
+		responder.NotFound(w, r, err)
+	case errors.Is(err, flag.ErrFlagConflict):
+		writeError(w, http.StatusPreconditionFailed, &errorResponse{Message: err.Error(), Code: "PRECONDITION_FAILED"})
+	case errors.Is(err, segment.ErrInvalidSegment), errors.Is(err, segment.ErrSegmentExists), errors.Is(err, segment.ErrSegmentInUse):
+		responder.BadRequest(w, r, err)
+	case errors.Is(err, segment.ErrSegmentNotFound):
+		responder.NotFound(w, r, err)
+	case errors.Is(err, segment.ErrSegmentConflict):
+		writeError(w, http.StatusConflict, &errorResponse{Message: err.Error(), Code: "CONFLICT"})
+	case errors.Is(err, project.ErrInvalidProject), errors.Is(err, project.ErrProjectExists), errors.Is(err, project.ErrProjectNotEmpty), errors.Is(err, project.ErrEnvironmentExists):
+		responder.BadRequest(w, r, err)
+	case errors.Is(err, project.ErrProjectNotFound), errors.Is(err, project.ErrEnvironmentNotFound):
+		responder.NotFound(w, r, err)
+	case errors.Is(err, project.ErrProjectConflict):
+		writeError(w, http.StatusConflict, &errorResponse{Message: err.Error(), Code: "CONFLICT"})
+	case errors.Is(err, auth.ErrSDKKeyNotFound):
+		responder.NotFound(w, r, err)
+	case errors.Is(err, rbac.ErrInvalidRole), errors.Is(err, rbac.ErrRoleExists), errors.Is(err, rbac.ErrInvalidUser), errors.Is(err, rbac.ErrUserExists):
+		responder.BadRequest(w, r, err)
+	case errors.Is(err, rbac.ErrRoleNotFound), errors.Is(err, rbac.ErrUserNotFound):
+		responder.NotFound(w, r, err)
+	case errors.Is(err, audit.ErrInvalidFilter):
+		responder.BadRequest(w, r, err)
+	case errors.Is(err, audit.ErrEntryNotFound):
+		responder.NotFound(w, r, err)
+	case errors.Is(err, dynconfig.ErrInvalidEntry), errors.Is(err, dynconfig.ErrEntryExists), errors.Is(err, schema.ErrInvalidSchema):
 		responder.BadRequest(w, r, err)
+	case errors.Is(err, dynconfig.ErrEntryNotFound), errors.Is(err, dynconfig.ErrEntryVersionNotFound), errors.Is(err, dynconfig.ErrSchemaNotFound):
+		responder.NotFound(w, r, err)
+	case errors.Is(err, auth.ErrUnauthenticated):
+		responder.Unauthorized(w, r, err)
+	case errors.Is(err, auth.ErrForbidden):
+		responder.Forbidden(w, r, err)
 	default:
 		responder.Error(w, r, err)
 	}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julianstephens/feature-flag-service/internal/auth"
+	"github.com/julianstephens/feature-flag-service/internal/flag"
+	"github.com/julianstephens/feature-flag-service/internal/project"
+)
+
+// flagFilter narrows a flag event feed down to the flags a client asked for,
+// by key or ID. An empty filter matches every flag.
+type flagFilter struct {
+	keys map[string]bool
+	tags map[string]bool
+}
+
+func newFlagFilter(keys, tags []string) *flagFilter {
+	f := &flagFilter{keys: make(map[string]bool), tags: make(map[string]bool)}
+	for _, k := range keys {
+		f.keys[k] = true
+	}
+	for _, t := range tags {
+		f.tags[t] = true
+	}
+	return f
+}
+
+func (f *flagFilter) Match(ev *flag.FlagEvent) bool {
+	if ev.Flag == nil {
+		// Resync markers apply to every subscriber.
+		return true
+	}
+	if len(f.keys) == 0 && len(f.tags) == 0 {
+		return true
+	}
+	if f.keys[ev.Flag.Key] || f.keys[ev.Flag.ID] {
+		return true
+	}
+	for _, t := range ev.Flag.Tags {
+		if f.tags[t] {
+			return true
+		}
+	}
+	return false
+}
+
+// streamFlags serves flag events as Server-Sent Events for the project named
+// by the project query parameter, or the default project. Clients may filter
+// by repeating the key and tag query parameters and resume with
+// Last-Event-ID.
+func streamFlags(flagSvc flag.Service, heartbeat time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		var revision int64
+		if lastID := r.Header.Get("Last-Event-ID"); lastID != "" {
+			rev, err := strconv.ParseInt(lastID, 10, 64)
+			if err != nil || rev < 0 {
+				http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+				return
+			}
+			revision = rev
+		}
+
+		query := r.URL.Query()
+		filter := newFlagFilter(query["key"], query["tag"])
+
+		principal := auth.FromContext(r.Context())
+		projectKey, _, err := principal.Scope(query.Get("project"), "")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		events, err := flagSvc.WatchFlags(r.Context(), projectKey, revision)
+		if errors.Is(err, project.ErrProjectNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("error starting flag stream: %v", err)
+			http.Error(w, "failed to start stream", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case ev, ok := <-events:
+				if !ok {
+					return
+				}
+				if !filter.Match(ev) {
+					continue
+				}
+				if principal.IsSDK() {
+					ev = ev.Scoped(principal.Environment)
+				}
+				if err := writeEvent(w, ev); err != nil {
+					log.Printf("error writing flag event: %v", err)
+					return
+				}
+				flusher.Flush()
+			case <-ticker.C:
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, ev *flag.FlagEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	// Snapshot entries share a single revision, so only deltas advance the
+	// client's Last-Event-ID. A client dropped mid-snapshot starts over.
+	if ev.Action != flag.ActionSnapshot && ev.Action != flag.ActionResync {
+		if _, err := fmt.Fprintf(w, "id: %d\n", ev.Revision); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Action, data)
+	return err
+}
@@ -0,0 +1,258 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/julianstephens/feature-flag-service/internal/auth"
+	"github.com/julianstephens/feature-flag-service/internal/flag"
+)
+
+const (
+	wsSubscribe   = "subscribe"
+	wsUnsubscribe = "unsubscribe"
+	wsSubscribed  = "subscribed"
+	wsError       = "error"
+
+	wsWriteTimeout = 10 * time.Second
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// wsRequest is sent by clients to change the set of flags they receive.
+// Flags are matched by key or ID and prefixes by flag key.
+type wsRequest struct {
+	Type     string   `json:"type"`
+	Flags    []string `json:"flags"`
+	Prefixes []string `json:"prefixes"`
+
+	err error
+}
+
+// wsResponse acknowledges a subscription change or reports a bad request.
+// Flag updates themselves are sent as bare flag events.
+type wsResponse struct {
+	Type     string   `json:"type"`
+	Flags    []string `json:"flags,omitempty"`
+	Prefixes []string `json:"prefixes,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+type wsSubscription struct {
+	flags    map[string]bool
+	prefixes map[string]bool
+}
+
+func (s *wsSubscription) Match(f *flag.Flag) bool {
+	if s.flags[f.Key] || s.flags[f.ID] {
+		return true
+	}
+	for p := range s.prefixes {
+		if strings.HasPrefix(f.Key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *wsSubscription) Empty() bool {
+	return len(s.flags) == 0 && len(s.prefixes) == 0
+}
+
+func (s *wsSubscription) Response() *wsResponse {
+	res := &wsResponse{Type: wsSubscribed}
+	for id := range s.flags {
+		res.Flags = append(res.Flags, id)
+	}
+	for p := range s.prefixes {
+		res.Prefixes = append(res.Prefixes, p)
+	}
+	sort.Strings(res.Flags)
+	sort.Strings(res.Prefixes)
+	return res
+}
+
+// streamFlagsWS serves flag events over a WebSocket for the project named by
+// the project query parameter, or the default project. Clients start with no
+// subscriptions and send subscribe/unsubscribe requests at any time; newly
+// matched flags are sent as snapshot events straight away.
+func streamFlagsWS(flagSvc flag.Service, heartbeat time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal := auth.FromContext(r.Context())
+		projectKey, _, err := principal.Scope(r.URL.Query().Get("project"), "")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// Upgrade has already replied to the client.
+			log.Printf("error upgrading websocket: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		events, err := flagSvc.WatchFlags(ctx, projectKey, 0)
+		if err != nil {
+			log.Printf("error starting flag stream: %v", err)
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "failed to start stream"), time.Now().Add(wsWriteTimeout))
+			return
+		}
+
+		requests := make(chan *wsRequest)
+		go readWSRequests(ctx, cancel, conn, heartbeat, requests)
+
+		sub := &wsSubscription{flags: make(map[string]bool), prefixes: make(map[string]bool)}
+		// current tracks the latest state of every flag so new subscriptions
+		// can be answered without waiting for the next change.
+		current := make(map[string]*flag.FlagEvent)
+
+		ping := time.NewTicker(heartbeat)
+		defer ping.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-events:
+				if !ok {
+					return
+				}
+				if principal.IsSDK() {
+					ev = ev.Scoped(principal.Environment)
+				}
+				if ev.Flag != nil {
+					if ev.Action == flag.ActionDeleted {
+						delete(current, ev.Flag.ID)
+					} else {
+						current[ev.Flag.ID] = ev
+					}
+				}
+				if sub.Empty() || (ev.Flag != nil && !sub.Match(ev.Flag)) {
+					continue
+				}
+				if err := writeWS(conn, ev); err != nil {
+					return
+				}
+			case req := <-requests:
+				if req.err != nil {
+					if err := writeWS(conn, &wsResponse{Type: wsError, Error: req.err.Error()}); err != nil {
+						return
+					}
+					continue
+				}
+
+				matched := make(map[string]bool)
+				for id, ev := range current {
+					matched[id] = sub.Match(ev.Flag)
+				}
+
+				switch req.Type {
+				case wsSubscribe:
+					for _, id := range req.Flags {
+						sub.flags[id] = true
+					}
+					for _, p := range req.Prefixes {
+						sub.prefixes[p] = true
+					}
+				case wsUnsubscribe:
+					for _, id := range req.Flags {
+						delete(sub.flags, id)
+					}
+					for _, p := range req.Prefixes {
+						delete(sub.prefixes, p)
+					}
+				default:
+					if err := writeWS(conn, &wsResponse{Type: wsError, Error: "unknown request type: " + req.Type}); err != nil {
+						return
+					}
+					continue
+				}
+
+				if err := writeWS(conn, sub.Response()); err != nil {
+					return
+				}
+				for _, id := range sortedEventKeys(current) {
+					ev := current[id]
+					if matched[id] || !sub.Match(ev.Flag) {
+						continue
+					}
+					snapshot := &flag.FlagEvent{Action: flag.ActionSnapshot, Flag: ev.Flag, Revision: ev.Revision}
+					if err := writeWS(conn, snapshot); err != nil {
+						return
+					}
+				}
+			case <-ping.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// readWSRequests owns the read side of the connection. It cancels the stream
+// once the client goes away or stops answering pings.
+func readWSRequests(ctx context.Context, cancel context.CancelFunc, conn *websocket.Conn, heartbeat time.Duration, requests chan<- *wsRequest) {
+	defer cancel()
+
+	pongWait := 2 * heartbeat
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("error reading websocket: %v", err)
+			}
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+
+		var req wsRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			req.err = err
+		}
+
+		select {
+		case requests <- &req:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func writeWS(conn *websocket.Conn, v any) error {
+	conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if err := conn.WriteJSON(v); err != nil {
+		log.Printf("error writing websocket message: %v", err)
+		return err
+	}
+	return nil
+}
+
+func sortedEventKeys(m map[string]*flag.FlagEvent) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
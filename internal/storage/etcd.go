@@ -2,8 +2,11 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"time"
 
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
@@ -28,62 +31,177 @@ func NewEtcdStore(endpoints []string, keyPrefix string) (*EtcdStore, error) {
 	}, nil
 }
 
-func (e *EtcdStore) Connect() error {
-	// The etcd client connects on creation, so we can just return nil here.
-	return nil
-}
-
 func (e *EtcdStore) Close() error {
 	return e.Client.Close()
 }
 
-func (e *EtcdStore) List(ctx context.Context, key string, opts ...clientv3.OpOption) (map[string]string, error) {
-	resp, err := e.Client.Get(ctx, key, append([]clientv3.OpOption{clientv3.WithPrefix()}, opts...)...)
+func (e *EtcdStore) Get(ctx context.Context, key string) (*KeyValue, error) {
+	resp, err := e.Client.Get(ctx, key)
 	if err != nil {
-		return nil, err
+		return nil, etcdError(err)
 	}
 
 	if len(resp.Kvs) == 0 {
 		return nil, ErrKeyNotFound
 	}
-	
-	result := make(map[string]string)
+
+	return etcdKeyValue(resp.Kvs[0]), nil
+}
+
+func (e *EtcdStore) List(ctx context.Context, prefix string, opts ListOptions) (*ListResult, error) {
+	start := prefix
+	if opts.After != "" && opts.After >= prefix {
+		start = opts.After + "\x00"
+	}
+	getOpts := []clientv3.OpOption{
+		clientv3.WithRange(clientv3.GetPrefixRangeEnd(prefix)),
+		clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend),
+	}
+	if opts.Revision > 0 {
+		getOpts = append(getOpts, clientv3.WithRev(opts.Revision))
+	}
+	if opts.Limit > 0 {
+		getOpts = append(getOpts, clientv3.WithLimit(int64(opts.Limit)))
+	}
+
+	resp, err := e.Client.Get(ctx, start, getOpts...)
+	if err != nil {
+		return nil, etcdError(err)
+	}
+
+	result := &ListResult{
+		KVs:      make([]*KeyValue, 0, len(resp.Kvs)),
+		Revision: resp.Header.Revision,
+		More:     resp.More,
+	}
 	for _, kv := range resp.Kvs {
-		result[string(kv.Key)] = string(kv.Value)
+		result.KVs = append(result.KVs, etcdKeyValue(kv))
 	}
 	return result, nil
 }
 
-func (e *EtcdStore) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (string, error) {
-	resp, err := e.Client.Get(ctx, key, opts...)
+func (e *EtcdStore) Put(ctx context.Context, key, value string, opts ...OpOption) (int64, error) {
+	res, err := e.Txn(ctx, nil, Put(key, value, opts...))
 	if err != nil {
-		return "", err
+		return 0, err
 	}
+	return res.Revision, nil
+}
 
-	if len(resp.Kvs) == 0 {
-		return "", ErrKeyNotFound
+func (e *EtcdStore) Delete(ctx context.Context, key string) error {
+	resp, err := e.Client.Delete(ctx, key)
+	if err != nil {
+		return etcdError(err)
 	}
-	
-	return string(resp.Kvs[0].Value), nil
+	if resp.Deleted == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
 }
 
-func (e *EtcdStore) Put(ctx context.Context, key, value string, opts ...clientv3.OpOption) (string, error) {
-	_, err := e.Client.Put(ctx, key, value, opts...)
-	return "", err
+// Txn maps comparisons onto etcd mod revisions, which are zero for keys that
+// are not set. Puts with a TTL are attached to a lease granted first, one per
+// distinct TTL.
+func (e *EtcdStore) Txn(ctx context.Context, cmps []Cmp, ops ...Op) (*TxnResult, error) {
+	conds := make([]clientv3.Cmp, 0, len(cmps))
+	for _, c := range cmps {
+		conds = append(conds, clientv3.Compare(clientv3.ModRevision(c.Key), "=", c.ModRevision))
+	}
+
+	leases := make(map[time.Duration]clientv3.LeaseID)
+	thens := make([]clientv3.Op, 0, len(ops))
+	for _, op := range ops {
+		switch op.Type {
+		case OpPut:
+			var putOpts []clientv3.OpOption
+			if op.TTL > 0 {
+				lease, ok := leases[op.TTL]
+				if !ok {
+					// etcd counts lease TTLs in whole seconds.
+					grant, err := e.Client.Grant(ctx, int64((op.TTL+time.Second-1)/time.Second))
+					if err != nil {
+						return nil, err
+					}
+					lease = grant.ID
+					leases[op.TTL] = lease
+				}
+				putOpts = append(putOpts, clientv3.WithLease(lease))
+			}
+			thens = append(thens, clientv3.OpPut(op.Key, op.Value, putOpts...))
+		case OpDelete:
+			thens = append(thens, clientv3.OpDelete(op.Key))
+		}
+	}
+
+	resp, err := e.Client.Txn(ctx).If(conds...).Then(thens...).Commit()
+	if err != nil {
+		return nil, etcdError(err)
+	}
+	return &TxnResult{Succeeded: resp.Succeeded, Revision: resp.Header.Revision}, nil
 }
 
-func (e *EtcdStore) Post(ctx context.Context, key, value string, opts ...clientv3.OpOption) (string, error) {
-	return "", ErrNotImplemented
+func (e *EtcdStore) Watch(ctx context.Context, prefix string, rev int64) <-chan WatchResponse {
+	opts := []clientv3.OpOption{clientv3.WithPrefix(), clientv3.WithPrevKV()}
+	if rev > 0 {
+		opts = append(opts, clientv3.WithRev(rev))
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	watch := e.Client.Watch(clientv3.WithRequireLeader(ctx), prefix, opts...)
+
+	out := make(chan WatchResponse)
+	go func() {
+		defer close(out)
+		defer cancel()
+		for resp := range watch {
+			res := WatchResponse{CompactRevision: resp.CompactRevision, Err: resp.Err()}
+			if res.CompactRevision != 0 {
+				res.Err = nil
+			}
+			for _, ev := range resp.Events {
+				event := &Event{Type: EventPut, KV: etcdKeyValue(ev.Kv)}
+				if ev.Type == mvccpb.DELETE {
+					event.Type = EventDelete
+				}
+				if ev.PrevKv != nil {
+					event.PrevKV = etcdKeyValue(ev.PrevKv)
+				}
+				res.Events = append(res.Events, event)
+			}
+			select {
+			case out <- res:
+			case <-ctx.Done():
+				return
+			}
+			if res.CompactRevision != 0 || res.Err != nil {
+				return
+			}
+		}
+	}()
+	return out
 }
 
-func (e *EtcdStore) Delete(ctx context.Context, key string, opts ...clientv3.OpOption) error {
-	resp, err := e.Client.Delete(ctx, key, opts...)
-	if err != nil {
+// etcdError maps the etcd errors the Store interface defines its own errors
+// for.
+func etcdError(err error) error {
+	switch {
+	case errors.Is(err, rpctypes.ErrCompacted):
+		return ErrCompacted
+	case errors.Is(err, rpctypes.ErrEmptyKey):
+		return ErrEmptyKey
+	case errors.Is(err, rpctypes.ErrDuplicateKey):
+		return ErrDuplicateKey
+	case errors.Is(err, rpctypes.ErrFutureRev):
+		return ErrFutureRevision
+	default:
 		return err
 	}
-	if resp.Deleted == 0 {
-		return ErrKeyNotFound
-	}
-	return nil
 }
 
+func etcdKeyValue(kv *mvccpb.KeyValue) *KeyValue {
+	return &KeyValue{
+		Key:            string(kv.Key),
+		Value:          string(kv.Value),
+		CreateRevision: kv.CreateRevision,
+		ModRevision:    kv.ModRevision,
+	}
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// FileStore is a MemoryStore that saves its keys to a JSON file after every
+// write and loads them again when opened, for single-instance deployments
+// without etcd or Postgres. Only the latest state is saved: after a restart
+// the store continues from the saved revision, and reads and watches from
+// earlier revisions fail as compacted. Every write rewrites the whole file.
+type FileStore struct {
+	*MemoryStore
+	path string
+}
+
+// fileState is the content of a FileStore's file.
+type fileState struct {
+	Revision int64     `json:"revision"`
+	Keys     []fileKey `json:"keys"`
+}
+
+type fileKey struct {
+	Key            string     `json:"key"`
+	Value          string     `json:"value"`
+	CreateRevision int64      `json:"createRevision"`
+	ModRevision    int64      `json:"modRevision"`
+	ExpiresAt      *time.Time `json:"expiresAt,omitempty"`
+}
+
+// NewFileStore opens the store saved at path, or an empty one when the file
+// does not exist yet. Keys whose TTL ran out while the store was closed are
+// dropped.
+func NewFileStore(path string) (*FileStore, error) {
+	f := &FileStore{MemoryStore: NewMemoryStore(), path: path}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		var state fileState
+		if err := json.Unmarshal(data, &state); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		f.restore(&state)
+	}
+	f.persist = f.save
+	return f, nil
+}
+
+func (f *FileStore) restore(state *fileState) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rev = state.Revision
+	f.compacted = state.Revision
+	for _, k := range state.Keys {
+		v := &memoryVersion{kv: KeyValue{Key: k.Key, Value: k.Value, CreateRevision: k.CreateRevision, ModRevision: k.ModRevision}}
+		if k.ExpiresAt != nil {
+			if time.Now().After(*k.ExpiresAt) {
+				continue
+			}
+			v.expiresAt = *k.ExpiresAt
+		}
+		f.versions[k.Key] = []*memoryVersion{v}
+		f.schedule(k.Key)
+	}
+}
+
+// save writes the live keys to the file, replacing it only once the new
+// content is complete. Callers hold mu.
+func (f *FileStore) save() error {
+	state := &fileState{Revision: f.rev, Keys: make([]fileKey, 0, len(f.versions))}
+	for key := range f.versions {
+		v := f.current(key)
+		if v == nil {
+			continue
+		}
+		k := fileKey{Key: key, Value: v.kv.Value, CreateRevision: v.kv.CreateRevision, ModRevision: v.kv.ModRevision}
+		if !v.expiresAt.IsZero() {
+			expiresAt := v.expiresAt
+			k.ExpiresAt = &expiresAt
+		}
+		state.Keys = append(state.Keys, k)
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("saving %s: %w", f.path, err)
+	}
+	if err := os.Rename(tmp, f.path); err != nil {
+		return fmt.Errorf("saving %s: %w", f.path, err)
+	}
+	return nil
+}
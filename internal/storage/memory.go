@@ -0,0 +1,396 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps every key in process memory with the semantics of the
+// etcd store: a single store revision advanced by each write, create and mod
+// revisions per key, reads at past revisions, conditional transactions, TTLs
+// and watches that replay from a revision. Past versions are kept for the
+// last DefaultMemoryHistory revisions, or until Compact drops them. Nothing
+// survives the process, which suits tests and local runs.
+type MemoryStore struct {
+	mu        sync.Mutex
+	rev       int64
+	compacted int64
+	// versions holds the history of every key, oldest first. A deleted key
+	// ends in a tombstone.
+	versions map[string][]*memoryVersion
+	events   []*Event
+	timers   map[string]*time.Timer
+	watchers map[*memoryWatcher]struct{}
+	// history is the number of past revisions kept before older ones are
+	// compacted away; zero keeps them all.
+	history int64
+	// persist, when set, is called with mu held after every write. FileStore
+	// saves the keys with it.
+	persist func() error
+}
+
+type memoryVersion struct {
+	kv        KeyValue
+	deleted   bool
+	expiresAt time.Time
+}
+
+// DefaultMemoryHistory is the number of revisions a MemoryStore keeps for
+// reads at past revisions and watch replays.
+const DefaultMemoryHistory = 10000
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		versions: make(map[string][]*memoryVersion),
+		timers:   make(map[string]*time.Timer),
+		watchers: make(map[*memoryWatcher]struct{}),
+		history:  DefaultMemoryHistory,
+	}
+}
+
+func (s *MemoryStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, timer := range s.timers {
+		timer.Stop()
+		delete(s.timers, key)
+	}
+	return nil
+}
+
+// current returns the live version of key, or nil when it is not set.
+func (s *MemoryStore) current(key string) *memoryVersion {
+	versions := s.versions[key]
+	if len(versions) == 0 {
+		return nil
+	}
+	v := versions[len(versions)-1]
+	if v.deleted {
+		return nil
+	}
+	return v
+}
+
+// at returns the version of key as of rev, or nil when it was not set then.
+func (s *MemoryStore) at(key string, rev int64) *memoryVersion {
+	versions := s.versions[key]
+	i := sort.Search(len(versions), func(i int) bool { return versions[i].kv.ModRevision > rev })
+	if i == 0 || versions[i-1].deleted {
+		return nil
+	}
+	return versions[i-1]
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (*KeyValue, error) {
+	if key == "" {
+		return nil, ErrEmptyKey
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v := s.current(key)
+	if v == nil {
+		return nil, ErrKeyNotFound
+	}
+	kv := v.kv
+	return &kv, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, prefix string, opts ListOptions) (*ListResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rev := s.rev
+	if opts.Revision > 0 {
+		if opts.Revision > s.rev {
+			return nil, fmt.Errorf("%w: revision %d, store revision %d", ErrFutureRevision, opts.Revision, s.rev)
+		}
+		if opts.Revision < s.compacted {
+			return nil, ErrCompacted
+		}
+		rev = opts.Revision
+	}
+
+	keys := make([]string, 0)
+	for key := range s.versions {
+		if strings.HasPrefix(key, prefix) && key > opts.After {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	result := &ListResult{KVs: make([]*KeyValue, 0), Revision: rev}
+	for _, key := range keys {
+		v := s.at(key, rev)
+		if v == nil {
+			continue
+		}
+		if opts.Limit > 0 && len(result.KVs) == opts.Limit {
+			result.More = true
+			break
+		}
+		kv := v.kv
+		result.KVs = append(result.KVs, &kv)
+	}
+	return result, nil
+}
+
+func (s *MemoryStore) Put(ctx context.Context, key, value string, opts ...OpOption) (int64, error) {
+	res, err := s.Txn(ctx, nil, Put(key, value, opts...))
+	if err != nil {
+		return 0, err
+	}
+	return res.Revision, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	if key == "" {
+		return ErrEmptyKey
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current(key) == nil {
+		return ErrKeyNotFound
+	}
+	return s.apply([]Op{Delete(key)})
+}
+
+func (s *MemoryStore) Txn(ctx context.Context, cmps []Cmp, ops ...Op) (*TxnResult, error) {
+	if err := checkOps(ops); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range cmps {
+		var rev int64
+		if v := s.current(c.Key); v != nil {
+			rev = v.kv.ModRevision
+		}
+		if rev != c.ModRevision {
+			return &TxnResult{Revision: s.rev}, nil
+		}
+	}
+	if err := s.apply(ops); err != nil {
+		return nil, err
+	}
+	return &TxnResult{Succeeded: true, Revision: s.rev}, nil
+}
+
+// apply writes ops at the next revision. The revision is only taken if an op
+// changes something. An error means the write was made but not persisted.
+// Callers hold mu.
+func (s *MemoryStore) apply(ops []Op) error {
+	rev := s.rev + 1
+	var events []*Event
+	var touched []string
+	for _, op := range ops {
+		prev := s.current(op.Key)
+		var next *memoryVersion
+		switch op.Type {
+		case OpPut:
+			next = &memoryVersion{kv: KeyValue{Key: op.Key, Value: op.Value, CreateRevision: rev, ModRevision: rev}}
+			if prev != nil {
+				next.kv.CreateRevision = prev.kv.CreateRevision
+			}
+			if op.TTL > 0 {
+				next.expiresAt = time.Now().Add(op.TTL)
+			}
+		case OpDelete:
+			if prev == nil {
+				continue
+			}
+			next = &memoryVersion{kv: KeyValue{Key: op.Key, ModRevision: rev}, deleted: true}
+		}
+
+		event := &Event{Type: EventPut, KV: &KeyValue{}}
+		if next.deleted {
+			event.Type = EventDelete
+		}
+		*event.KV = next.kv
+		if prev != nil {
+			prevKV := prev.kv
+			event.PrevKV = &prevKV
+		}
+		s.versions[op.Key] = append(s.versions[op.Key], next)
+		touched = append(touched, op.Key)
+		events = append(events, event)
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	s.rev = rev
+	for _, key := range touched {
+		s.schedule(key)
+	}
+	s.events = append(s.events, events...)
+	for w := range s.watchers {
+		w.send(events)
+	}
+	if s.history > 0 && s.rev-s.compacted > s.history {
+		s.compact(s.rev - s.history)
+	}
+	if s.persist != nil {
+		return s.persist()
+	}
+	return nil
+}
+
+// schedule replaces the expiry timer of key with one for its current
+// version. Callers hold mu.
+func (s *MemoryStore) schedule(key string) {
+	if timer, ok := s.timers[key]; ok {
+		timer.Stop()
+		delete(s.timers, key)
+	}
+	v := s.current(key)
+	if v == nil || v.expiresAt.IsZero() {
+		return
+	}
+	rev := v.kv.ModRevision
+	s.timers[key] = time.AfterFunc(time.Until(v.expiresAt), func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if v := s.current(key); v != nil && v.kv.ModRevision == rev {
+			delete(s.timers, key)
+			if err := s.apply([]Op{Delete(key)}); err != nil {
+				log.Printf("error expiring %s: %v", key, err)
+			}
+		}
+	})
+}
+
+// Compact drops the versions and events older than rev. Reads at earlier
+// revisions then fail with ErrCompacted and watches from them are cut short,
+// as after an etcd compaction.
+func (s *MemoryStore) Compact(rev int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.compact(rev)
+}
+
+// compact is Compact for callers holding mu.
+func (s *MemoryStore) compact(rev int64) {
+	if rev > s.rev {
+		rev = s.rev
+	}
+	if rev <= s.compacted {
+		return
+	}
+	s.compacted = rev
+
+	for key, versions := range s.versions {
+		i := sort.Search(len(versions), func(i int) bool { return versions[i].kv.ModRevision > rev })
+		if i > 0 {
+			i--
+		}
+		versions = versions[i:]
+		if len(versions) == 1 && versions[0].deleted && versions[0].kv.ModRevision <= rev {
+			delete(s.versions, key)
+			continue
+		}
+		s.versions[key] = versions
+	}
+	i := sort.Search(len(s.events), func(i int) bool { return s.events[i].KV.ModRevision >= rev })
+	s.events = append([]*Event(nil), s.events[i:]...)
+}
+
+func (s *MemoryStore) Watch(ctx context.Context, prefix string, rev int64) <-chan WatchResponse {
+	out := make(chan WatchResponse)
+	w := &memoryWatcher{prefix: prefix, wake: make(chan struct{}, 1)}
+
+	s.mu.Lock()
+	switch {
+	case rev > 0 && rev < s.compacted:
+		w.queue = append(w.queue, WatchResponse{CompactRevision: s.compacted})
+	case rev > s.rev+1:
+		// Like List, refuse revisions the store has not reached; the next
+		// write is the furthest a watch can start from.
+		w.queue = append(w.queue, WatchResponse{Err: fmt.Errorf("%w: revision %d, store revision %d", ErrFutureRevision, rev, s.rev)})
+	default:
+		if rev > 0 {
+			i := sort.Search(len(s.events), func(i int) bool { return s.events[i].KV.ModRevision >= rev })
+			w.send(s.events[i:])
+		}
+		s.watchers[w] = struct{}{}
+	}
+	s.mu.Unlock()
+
+	go func() {
+		defer close(out)
+		defer func() {
+			s.mu.Lock()
+			delete(s.watchers, w)
+			s.mu.Unlock()
+		}()
+		for {
+			for {
+				res, ok := w.next()
+				if !ok {
+					break
+				}
+				select {
+				case out <- res:
+				case <-ctx.Done():
+					return
+				}
+				if res.CompactRevision != 0 || res.Err != nil {
+					return
+				}
+			}
+			select {
+			case <-w.wake:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// memoryWatcher queues the responses of one watch so writers never wait for
+// a slow reader.
+type memoryWatcher struct {
+	prefix string
+	mu     sync.Mutex
+	queue  []WatchResponse
+	wake   chan struct{}
+}
+
+// send queues the events under the watcher's prefix, one response per
+// revision.
+func (w *memoryWatcher) send(events []*Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var res *WatchResponse
+	for _, ev := range events {
+		if !strings.HasPrefix(ev.KV.Key, w.prefix) {
+			continue
+		}
+		if res == nil || res.Events[0].KV.ModRevision != ev.KV.ModRevision {
+			w.queue = append(w.queue, WatchResponse{})
+			res = &w.queue[len(w.queue)-1]
+		}
+		res.Events = append(res.Events, ev)
+	}
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *memoryWatcher) next() (WatchResponse, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.queue) == 0 {
+		return WatchResponse{}, false
+	}
+	res := w.queue[0]
+	w.queue = w.queue[1:]
+	return res, true
+}
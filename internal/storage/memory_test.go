@@ -0,0 +1,318 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreRevisions(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+
+	rev1, err := s.Put(ctx, "/a", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rev2, err := s.Put(ctx, "/a", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev1 != 1 || rev2 != 2 {
+		t.Fatalf("revisions = %d, %d; want 1, 2", rev1, rev2)
+	}
+
+	kv, err := s.Get(ctx, "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kv.Value != "2" || kv.CreateRevision != 1 || kv.ModRevision != 2 {
+		t.Errorf("Get = %+v; want value 2 created at 1, modified at 2", kv)
+	}
+
+	if err := s.Delete(ctx, "/a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, "/a"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Get after Delete: err = %v; want ErrKeyNotFound", err)
+	}
+	if err := s.Delete(ctx, "/a"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("second Delete: err = %v; want ErrKeyNotFound", err)
+	}
+
+	old, err := s.List(ctx, "/", ListOptions{Revision: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(old.KVs) != 1 || old.KVs[0].Value != "1" || old.Revision != 1 {
+		t.Errorf("List at revision 1 = %+v; want /a=1", old)
+	}
+	if _, err := s.List(ctx, "/", ListOptions{Revision: 4}); !errors.Is(err, ErrFutureRevision) {
+		t.Errorf("List ahead of the store: err = %v; want ErrFutureRevision", err)
+	}
+}
+
+func TestMemoryStoreListPages(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	for _, key := range []string{"/p/b", "/p/a", "/p/c", "/q/a"} {
+		if _, err := s.Put(ctx, key, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var keys []string
+	opts := ListOptions{Limit: 2}
+	for {
+		res, err := s.List(ctx, "/p/", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, kv := range res.KVs {
+			keys = append(keys, kv.Key)
+		}
+		if !res.More {
+			break
+		}
+		opts.After = res.KVs[len(res.KVs)-1].Key
+	}
+	if want := []string{"/p/a", "/p/b", "/p/c"}; !equal(keys, want) {
+		t.Errorf("paged keys = %v; want %v", keys, want)
+	}
+}
+
+func TestMemoryStoreTxn(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+
+	res, err := s.Txn(ctx, []Cmp{Absent("/a")}, Put("/a", "1"), Put("/b", "1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Succeeded || res.Revision != 1 {
+		t.Fatalf("create Txn = %+v; want success at revision 1", res)
+	}
+
+	res, err = s.Txn(ctx, []Cmp{Absent("/a")}, Put("/a", "2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Succeeded {
+		t.Error("Txn requiring /a to be absent succeeded")
+	}
+
+	res, err = s.Txn(ctx, []Cmp{AtRevision("/a", 1)}, Put("/a", "2"), Delete("/b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Succeeded || res.Revision != 2 {
+		t.Fatalf("Txn at revision 1 = %+v; want success at revision 2", res)
+	}
+	if _, err := s.Get(ctx, "/b"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("/b after delete in Txn: err = %v; want ErrKeyNotFound", err)
+	}
+
+	res, err = s.Txn(ctx, []Cmp{AtRevision("/a", 1)}, Put("/a", "3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Succeeded || res.Revision != 2 {
+		t.Errorf("stale Txn = %+v; want failure reporting revision 2", res)
+	}
+
+	if _, err := s.Txn(ctx, nil, Put("/c", "1"), Delete("/c")); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("Txn writing /c twice: err = %v; want ErrDuplicateKey", err)
+	}
+	if _, err := s.Txn(ctx, nil, Put("", "1")); !errors.Is(err, ErrEmptyKey) {
+		t.Errorf("Txn writing an empty key: err = %v; want ErrEmptyKey", err)
+	}
+	if kv, _ := s.Get(ctx, "/a"); kv.Value != "2" {
+		t.Errorf("/a = %q after rejected Txns; want 2", kv.Value)
+	}
+}
+
+func TestMemoryStoreTTL(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	defer s.Close()
+
+	events := s.Watch(ctx, "/", 0)
+	if _, err := s.Put(ctx, "/lease", "1", WithTTL(20*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, "/lease"); err != nil {
+		t.Fatalf("Get before expiry: %v", err)
+	}
+
+	put := next(t, events)
+	if put.Events[0].Type != EventPut {
+		t.Fatalf("first event = %v; want a put", put.Events[0].Type)
+	}
+	expired := next(t, events)
+	if ev := expired.Events[0]; ev.Type != EventDelete || ev.PrevKV == nil || ev.PrevKV.Value != "1" {
+		t.Errorf("expiry event = %+v; want a delete of /lease=1", ev)
+	}
+	if _, err := s.Get(ctx, "/lease"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Get after expiry: err = %v; want ErrKeyNotFound", err)
+	}
+}
+
+func TestMemoryStoreWatchReplay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := NewMemoryStore()
+
+	s.Put(ctx, "/w/a", "1")
+	s.Put(ctx, "/other", "1")
+	s.Txn(ctx, nil, Put("/w/a", "2"), Put("/w/b", "1"))
+
+	events := s.Watch(ctx, "/w/", 2)
+	res := next(t, events)
+	if len(res.Events) != 2 || res.Events[0].KV.ModRevision != 3 {
+		t.Fatalf("replay = %+v; want the two writes of revision 3", res.Events)
+	}
+	if res.Events[0].IsCreate() || !res.Events[1].IsCreate() {
+		t.Error("replayed /w/a should be an update and /w/b a creation")
+	}
+
+	s.Put(ctx, "/w/c", "1")
+	if res := next(t, events); res.Events[0].KV.Key != "/w/c" || res.Events[0].KV.ModRevision != 4 {
+		t.Errorf("live event = %+v; want /w/c at revision 4", res.Events[0].KV)
+	}
+
+	// The next write is the furthest a watch may start from.
+	ahead := next(t, s.Watch(ctx, "/w/", 6))
+	if !errors.Is(ahead.Err, ErrFutureRevision) {
+		t.Errorf("watch ahead of the store: err = %v; want ErrFutureRevision", ahead.Err)
+	}
+	upcoming := s.Watch(ctx, "/w/", 5)
+	s.Put(ctx, "/w/d", "1")
+	if res := next(t, upcoming); res.Events[0].KV.ModRevision != 5 {
+		t.Errorf("watch from the next revision got revision %d; want 5", res.Events[0].KV.ModRevision)
+	}
+}
+
+func TestMemoryStoreCompact(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	for _, value := range []string{"1", "2", "3"} {
+		s.Put(ctx, "/a", value)
+	}
+	s.Put(ctx, "/b", "1")
+	s.Delete(ctx, "/b")
+
+	s.Compact(3)
+	if _, err := s.List(ctx, "/", ListOptions{Revision: 2}); !errors.Is(err, ErrCompacted) {
+		t.Errorf("List below the compaction: err = %v; want ErrCompacted", err)
+	}
+	res, err := s.List(ctx, "/", ListOptions{Revision: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.KVs) != 1 || res.KVs[0].Value != "3" {
+		t.Errorf("List at the compaction revision = %+v; want /a=3", res.KVs)
+	}
+
+	cut := next(t, s.Watch(ctx, "/", 2))
+	if cut.CompactRevision != 3 {
+		t.Errorf("watch below the compaction = %+v; want CompactRevision 3", cut)
+	}
+	replay := next(t, s.Watch(ctx, "/", 3))
+	if len(replay.Events) != 1 || replay.Events[0].KV.ModRevision != 3 {
+		t.Errorf("watch from the compaction = %+v; want the write of revision 3", replay.Events)
+	}
+}
+
+func TestMemoryStoreHistoryLimit(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	s.history = 2
+	for _, value := range []string{"1", "2", "3", "4", "5"} {
+		s.Put(ctx, "/a", value)
+	}
+
+	if n := len(s.versions["/a"]); n > 3 {
+		t.Errorf("kept %d versions of /a; want at most 3", n)
+	}
+	if _, err := s.List(ctx, "/", ListOptions{Revision: 2}); !errors.Is(err, ErrCompacted) {
+		t.Errorf("List beyond the history: err = %v; want ErrCompacted", err)
+	}
+	res, err := s.List(ctx, "/", ListOptions{Revision: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.KVs[0].Value != "3" {
+		t.Errorf("List at revision 3 = %q; want 3", res.KVs[0].Value)
+	}
+}
+
+func TestFileStoreReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "store.json")
+
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put(ctx, "/a", "1")
+	s.Put(ctx, "/a", "2")
+	s.Put(ctx, "/b", "1")
+	s.Delete(ctx, "/b")
+	s.Put(ctx, "/lease", "1", WithTTL(time.Hour))
+	s.Close()
+
+	s, err = NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	kv, err := s.Get(ctx, "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kv.Value != "2" || kv.CreateRevision != 1 || kv.ModRevision != 2 {
+		t.Errorf("reopened /a = %+v; want value 2 created at 1, modified at 2", kv)
+	}
+	if _, err := s.Get(ctx, "/b"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("reopened /b: err = %v; want ErrKeyNotFound", err)
+	}
+	if _, err := s.Get(ctx, "/lease"); err != nil {
+		t.Errorf("reopened /lease: %v", err)
+	}
+	if rev, _ := s.Put(ctx, "/c", "1"); rev != 6 {
+		t.Errorf("first write after reopening at revision %d; want 6", rev)
+	}
+	if _, err := s.List(ctx, "/", ListOptions{Revision: 4}); !errors.Is(err, ErrCompacted) {
+		t.Errorf("List before the reopen: err = %v; want ErrCompacted", err)
+	}
+}
+
+// next returns the next watch response, failing the test if none arrives
+// within a second.
+func next(t *testing.T, events <-chan WatchResponse) WatchResponse {
+	t.Helper()
+	select {
+	case res, ok := <-events:
+		if !ok {
+			t.Fatal("watch closed")
+		}
+		return res
+	case <-time.After(time.Second):
+		t.Fatal("no watch response")
+	}
+	return WatchResponse{}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
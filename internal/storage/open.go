@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Storage backends selectable with Open.
+const (
+	BackendEtcd     = "etcd"
+	BackendPostgres = "postgres"
+	BackendMemory   = "memory"
+	BackendFile     = "file"
+)
+
+var ErrUnknownBackend = errors.New("unknown storage backend")
+
+// Options hold what the backends need to connect. Only the fields of the
+// selected backend are used.
+type Options struct {
+	EtcdEndpoints []string
+	// Pool is shared with the Postgres services and stays open after the
+	// store is closed.
+	Pool          *pgxpool.Pool
+	PostgresTable string
+	// FilePath is the file the file backend saves its keys in.
+	FilePath string
+}
+
+// Open returns the store of the named backend.
+func Open(backend string, opts Options) (Store, error) {
+	switch backend {
+	case BackendEtcd:
+		return NewEtcdStore(opts.EtcdEndpoints, "")
+	case BackendPostgres:
+		if opts.Pool == nil {
+			return nil, errors.New("the postgres storage backend needs POSTGRES_URL")
+		}
+		return NewPostgresStore(opts.Pool, opts.PostgresTable), nil
+	case BackendMemory:
+		return NewMemoryStore(), nil
+	case BackendFile:
+		return NewFileStore(opts.FilePath)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownBackend, backend)
+	}
+}
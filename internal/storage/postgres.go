@@ -2,109 +2,370 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"strings"
-	"sync"
+	"time"
 
 	"github.com/jackc/pgx/v5"
-
-	"github.com/julianstephens/feature-flag-service/internal/config"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-var (
-	dbConn *pgx.Conn
-	once   sync.Once
-)
+// DefaultPostgresTable is the key-value table created by the migrations.
+const DefaultPostgresTable = "kv_store"
+
+// postgresWriteLock is the advisory lock serializing writes, so revisions
+// are committed in order and a watch never skips one.
+const postgresWriteLock = 0x6b765f73746f7265
+
+const postgresWatchInterval = 250 * time.Millisecond
 
+// postgresDeleteAttempts bounds how often Delete retries a key that keeps
+// being rewritten between its read and its delete.
+const postgresDeleteAttempts = 5
+
+// PostgresStore keeps keys and values in a table with key and value columns,
+// giving services written against Store an alternative to etcd. Every write
+// takes the next value of the table's revision sequence and is logged, value
+// included, in its events table, which serves reads at past revisions and
+// watches. The log is never compacted.
 type PostgresStore struct {
-	TableName string
-	Columns   []string
-	IdxKey    string
+	Pool  *pgxpool.Pool
+	Table string
 }
 
-type PostgresOption struct {
-	TableName   string
-	Columns     []string
-	IdxKey      string
+// NewPostgresStore returns a store on table, or DefaultPostgresTable when
+// table is empty. The pool is shared and not closed by Close.
+func NewPostgresStore(pool *pgxpool.Pool, table string) *PostgresStore {
+	if table == "" {
+		table = DefaultPostgresTable
+	}
+	return &PostgresStore{
+		Pool:  pool,
+		Table: table,
+	}
 }
 
-func NewPostgresStore(opts PostgresOption) *PostgresStore {
-	return &PostgresStore{
-		TableName: opts.TableName,
-		Columns:   opts.Columns,
-		IdxKey:    opts.IdxKey,
+// NewPostgresPool opens a connection pool on url and checks that the
+// database is reachable.
+func NewPostgresPool(ctx context.Context, url string) (*pgxpool.Pool, error) {
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		return nil, err
 	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return pool, nil
 }
 
-func Connect() error {
-	var err error
-	once.Do(func() {
-		conf := config.LoadConfig()
-		conn, e := pgx.Connect(context.Background(), conf.PostgresURL)
-		if e != nil {
-			err = e
-		}
-		dbConn = conn
-	})
-	return err
+func (s *PostgresStore) Close() error {
+	// The pool belongs to the caller, who may share it with other services.
+	return nil
+}
+
+func (s *PostgresStore) table() string {
+	return pgx.Identifier{s.Table}.Sanitize()
 }
 
-func Close() error {
-	if dbConn != nil {
-		return dbConn.Close(context.Background())
+func (s *PostgresStore) events() string {
+	return pgx.Identifier{s.Table + "_events"}.Sanitize()
+}
+
+func (s *PostgresStore) sequence() string {
+	return pgx.Identifier{s.Table + "_revision"}.Sanitize()
+}
+
+const liveRow = "(expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)"
+
+func (s *PostgresStore) Get(ctx context.Context, key string) (*KeyValue, error) {
+	if key == "" {
+		return nil, ErrEmptyKey
 	}
-	return nil
+	kv := &KeyValue{}
+	err := s.Pool.QueryRow(ctx,
+		"SELECT key, value, create_revision, mod_revision FROM "+s.table()+" WHERE key = $1 AND "+liveRow, key).
+		Scan(&kv.Key, &kv.Value, &kv.CreateRevision, &kv.ModRevision)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return kv, nil
 }
 
+// List reads the current keys from the table and past revisions from the
+// events table. Writers are held off for the duration, so the keys match the
+// reported revision.
+func (s *PostgresStore) List(ctx context.Context, prefix string, opts ListOptions) (*ListResult, error) {
+	tx, err := s.Pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
 
-func (s *PostgresStore) List(ctx context.Context, prefix string, opts ...any) (map[string]string, error) {
-	if dbConn == nil {
-		if err := Connect(); err != nil {
-			return nil, err
-		}
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock_shared($1)", postgresWriteLock); err != nil {
+		return nil, err
+	}
+	current, err := s.revision(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Revision > current {
+		return nil, fmt.Errorf("%w: revision %d, store revision %d", ErrFutureRevision, opts.Revision, current)
+	}
+
+	limit := "ALL"
+	if opts.Limit > 0 {
+		limit = fmt.Sprint(opts.Limit + 1)
+	}
+	var query string
+	args := []any{likePrefix(prefix), opts.After}
+	if opts.Revision > 0 && opts.Revision < current {
+		query = "SELECT key, value, create_revision, revision FROM (" +
+			"SELECT DISTINCT ON (key) key, type, value, create_revision, revision FROM " + s.events() +
+			` WHERE key LIKE $1 ESCAPE '\' AND key > $2 AND revision <= $3 ORDER BY key, revision DESC` +
+			") h WHERE type = 'put' ORDER BY key LIMIT " + limit
+		args = append(args, opts.Revision)
+	} else {
+		query = "SELECT key, value, create_revision, mod_revision FROM " + s.table() +
+			` WHERE key LIKE $1 ESCAPE '\' AND key > $2 AND ` + liveRow + " ORDER BY key LIMIT " + limit
 	}
 
-	query := "SELECT " + strings.Join(s.Columns, ",") + " FROM " + s.TableName
-	args := []interface{}{}
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	kvs, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*KeyValue, error) {
+		kv := &KeyValue{}
+		return kv, row.Scan(&kv.Key, &kv.Value, &kv.CreateRevision, &kv.ModRevision)
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	if prefix != "" {
-		query += " WHERE " + s.IdxKey + " LIKE $1"
-		args = append(args, prefix+"%")
+	result := &ListResult{KVs: kvs, Revision: current}
+	if opts.Revision > 0 {
+		result.Revision = opts.Revision
+	}
+	if opts.Limit > 0 && len(kvs) > opts.Limit {
+		result.KVs, result.More = kvs[:opts.Limit], true
 	}
+	return result, nil
+}
 
-	rows, err := dbConn.Query(ctx, query, args...)
+func (s *PostgresStore) Put(ctx context.Context, key, value string, opts ...OpOption) (int64, error) {
+	res, err := s.Txn(ctx, nil, Put(key, value, opts...))
 	if err != nil {
+		return 0, err
+	}
+	return res.Revision, nil
+}
+
+func (s *PostgresStore) Delete(ctx context.Context, key string) error {
+	for range postgresDeleteAttempts {
+		kv, err := s.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		res, err := s.Txn(ctx, []Cmp{AtRevision(key, kv.ModRevision)}, Delete(key))
+		if err != nil {
+			return err
+		}
+		if res.Succeeded {
+			return nil
+		}
+		// Changed in between; try again against the new state.
+	}
+	return fmt.Errorf("deleting %s: key changed on each of %d attempts", key, postgresDeleteAttempts)
+}
+
+// Txn checks the comparisons and applies the ops under the write lock.
+// Expired keys are removed, as deletions, by the next successful write.
+func (s *PostgresStore) Txn(ctx context.Context, cmps []Cmp, ops ...Op) (*TxnResult, error) {
+	if err := checkOps(ops); err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	tx, err := s.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
 
-	result := make(map[string]string)
-	for rows.Next() {
-		var key, value string
-		if err := rows.Scan(&key, &value); err != nil {
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", postgresWriteLock); err != nil {
+		return nil, err
+	}
+	ok, err := s.compare(ctx, tx, cmps)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		rev, err := s.revision(ctx, tx)
+		if err != nil {
 			return nil, err
 		}
-		result[key] = value
+		return &TxnResult{Revision: rev}, nil
 	}
 
-	if err := rows.Err(); err != nil {
+	var rev int64
+	if err := tx.QueryRow(ctx, "SELECT nextval($1::regclass)", s.sequence()).Scan(&rev); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx,
+		"WITH expired AS (DELETE FROM "+s.table()+" WHERE NOT "+liveRow+" RETURNING key, value, create_revision) "+
+			"INSERT INTO "+s.events()+" (revision, key, type, value, create_revision) SELECT $1, key, 'delete', value, create_revision FROM expired",
+		rev); err != nil {
 		return nil, err
 	}
 
-	return result, nil
+	for _, op := range ops {
+		switch op.Type {
+		case OpPut:
+			_, err = tx.Exec(ctx,
+				"WITH put AS ("+
+					"INSERT INTO "+s.table()+" (key, value, create_revision, mod_revision, expires_at) "+
+					"VALUES ($1, $2, $3, $3, CASE WHEN $4::bigint > 0 THEN CURRENT_TIMESTAMP + $4 * INTERVAL '1 millisecond' END) "+
+					"ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, mod_revision = EXCLUDED.mod_revision, expires_at = EXCLUDED.expires_at, updated_at = CURRENT_TIMESTAMP "+
+					"RETURNING key, value, create_revision) "+
+					"INSERT INTO "+s.events()+" (revision, key, type, value, create_revision) SELECT $3, key, 'put', value, create_revision FROM put "+
+					"ON CONFLICT (revision, key) DO UPDATE SET type = EXCLUDED.type, value = EXCLUDED.value",
+				op.Key, op.Value, rev, op.TTL.Milliseconds())
+		case OpDelete:
+			_, err = tx.Exec(ctx,
+				"WITH deleted AS (DELETE FROM "+s.table()+" WHERE key = $1 RETURNING key, value, create_revision) "+
+					"INSERT INTO "+s.events()+" (revision, key, type, value, create_revision) SELECT $2, key, 'delete', value, create_revision FROM deleted "+
+					"ON CONFLICT (revision, key) DO UPDATE SET type = EXCLUDED.type, value = EXCLUDED.value",
+				op.Key, rev)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return &TxnResult{Succeeded: true, Revision: rev}, nil
+}
+
+func (s *PostgresStore) compare(ctx context.Context, tx pgx.Tx, cmps []Cmp) (bool, error) {
+	if len(cmps) == 0 {
+		return true, nil
+	}
+	keys := make([]string, 0, len(cmps))
+	for _, c := range cmps {
+		keys = append(keys, c.Key)
+	}
+	rows, err := tx.Query(ctx, "SELECT key, mod_revision FROM "+s.table()+" WHERE key = ANY($1) AND "+liveRow, keys)
+	if err != nil {
+		return false, err
+	}
+	revisions := make(map[string]int64, len(keys))
+	var key string
+	var rev int64
+	if _, err := pgx.ForEachRow(rows, []any{&key, &rev}, func() error {
+		revisions[key] = rev
+		return nil
+	}); err != nil {
+		return false, err
+	}
+
+	for _, c := range cmps {
+		if revisions[c.Key] != c.ModRevision {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// revision returns the last revision taken. Callers hold the write lock, so
+// it has been committed.
+func (s *PostgresStore) revision(ctx context.Context, tx pgx.Tx) (int64, error) {
+	var rev int64
+	err := tx.QueryRow(ctx, "SELECT CASE WHEN is_called THEN last_value ELSE 0 END FROM "+s.sequence()).Scan(&rev)
+	return rev, err
 }
 
-func Get(ctx context.Context, prefix string, opts ...any) (string, error) {
-	return "", nil
+// Watch polls the events table. Writes commit in revision order, so every
+// revision up to the last one seen is complete.
+func (s *PostgresStore) Watch(ctx context.Context, prefix string, rev int64) <-chan WatchResponse {
+	out := make(chan WatchResponse)
+	go func() {
+		defer close(out)
+
+		if rev == 0 {
+			if err := s.Pool.QueryRow(ctx, "SELECT CASE WHEN is_called THEN last_value ELSE 0 END + 1 FROM "+s.sequence()).Scan(&rev); err != nil {
+				sendWatchError(ctx, out, err)
+				return
+			}
+		}
+
+		for {
+			events, err := s.eventsSince(ctx, prefix, rev)
+			if err != nil {
+				sendWatchError(ctx, out, err)
+				return
+			}
+			for len(events) > 0 {
+				n := 1
+				for n < len(events) && events[n].KV.ModRevision == events[0].KV.ModRevision {
+					n++
+				}
+				select {
+				case out <- WatchResponse{Events: events[:n]}:
+				case <-ctx.Done():
+					return
+				}
+				rev = events[0].KV.ModRevision + 1
+				events = events[n:]
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(postgresWatchInterval):
+			}
+		}
+	}()
+	return out
 }
 
-func Post(ctx context.Context, prefix string, opts ...any) (string, error) {
-	return "", nil
+func sendWatchError(ctx context.Context, out chan<- WatchResponse, err error) {
+	select {
+	case out <- WatchResponse{Err: err}:
+	case <-ctx.Done():
+	}
 }
 
-func Put(ctx context.Context, prefix string, opts ...any) (string, error) {
-	return "", nil
+func (s *PostgresStore) eventsSince(ctx context.Context, prefix string, rev int64) ([]*Event, error) {
+	rows, err := s.Pool.Query(ctx,
+		"SELECT revision, key, type, value, create_revision FROM "+s.events()+
+			` WHERE key LIKE $1 ESCAPE '\' AND revision >= $2 ORDER BY revision, key`,
+		likePrefix(prefix), rev)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (*Event, error) {
+		var eventType string
+		kv := &KeyValue{}
+		if err := row.Scan(&kv.ModRevision, &kv.Key, &eventType, &kv.Value, &kv.CreateRevision); err != nil {
+			return nil, err
+		}
+		if eventType == "put" {
+			return &Event{Type: EventPut, KV: kv}, nil
+		}
+		return &Event{
+			Type:   EventDelete,
+			KV:     &KeyValue{Key: kv.Key, ModRevision: kv.ModRevision},
+			PrevKV: &KeyValue{Key: kv.Key, Value: kv.Value, CreateRevision: kv.CreateRevision},
+		}, nil
+	})
 }
 
-func Delete(ctx context.Context, prefix string, opts ...any) error {
-	return nil
-}
\ No newline at end of file
+// likePrefix returns a LIKE pattern matching every string starting with
+// prefix, escaping the wildcards prefix may contain.
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix) + "%"
+}
@@ -3,18 +3,183 @@ package storage
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 )
 
+var (
+	ErrKeyNotFound    = errors.New("key not found")
+	ErrEmptyKey       = errors.New("key is empty")
+	ErrDuplicateKey   = errors.New("key written twice in one transaction")
+	ErrFutureRevision = errors.New("revision is ahead of the store")
+)
 
-var ErrKeyNotFound = errors.New("key not found")
-var ErrNotImplemented = errors.New("not implemented")
+// ErrCompacted is returned for reads and watches at a revision the backend
+// no longer keeps.
+var ErrCompacted = errors.New("revision has been compacted")
 
-type Store[T any] interface {
-	Connect() error
+// Store is a revisioned key-value store. Every write advances the store
+// revision, which is stamped on the keys it touched; reads report the
+// revision they were served at so a watch can resume right after them.
+// Keys are ordered bytewise and listed by prefix.
+type Store interface {
 	Close() error
-	List(ctx context.Context, prefix string, opts ...T) (map[string]string, error)
-	Get(ctx context.Context, key string, opts ...T) (string, error)
-	Post(ctx context.Context, key, value string, opts ...T) (string, error)
-	Put(ctx context.Context, key, value string, opts ...T) (string, error)
-	Delete(ctx context.Context, key string, opts ...T) error
-}
\ No newline at end of file
+	// Get fails with ErrKeyNotFound when key is not set.
+	Get(ctx context.Context, key string) (*KeyValue, error)
+	List(ctx context.Context, prefix string, opts ListOptions) (*ListResult, error)
+	// Put sets key and returns the revision of the write.
+	Put(ctx context.Context, key, value string, opts ...OpOption) (int64, error)
+	// Delete fails with ErrKeyNotFound when key is not set.
+	Delete(ctx context.Context, key string) error
+	// Txn applies ops atomically, at a single new revision, if every
+	// comparison holds.
+	Txn(ctx context.Context, cmps []Cmp, ops ...Op) (*TxnResult, error)
+	// Watch streams every change under prefix from revision rev on, or from
+	// the next write when rev is zero, until ctx is done. A watch from a
+	// compacted revision ends with a response carrying CompactRevision.
+	Watch(ctx context.Context, prefix string, rev int64) <-chan WatchResponse
+}
+
+// KeyValue is a key as of its last write. CreateRevision is the revision the
+// key was created at and ModRevision the one it was last modified at.
+type KeyValue struct {
+	Key            string
+	Value          string
+	CreateRevision int64
+	ModRevision    int64
+}
+
+// ListOptions narrow a prefix listing. Pages are read by passing the last
+// key of the previous page as After.
+type ListOptions struct {
+	// Revision reads the keys as they were at that revision instead of the
+	// latest state.
+	Revision int64
+	// Limit caps the number of keys returned; zero returns every key.
+	Limit int
+	// After skips keys up to and including it.
+	After string
+}
+
+// ListResult holds the keys of a listing in key order and the revision it
+// was served at. More is set when Limit cut the listing short.
+type ListResult struct {
+	KVs      []*KeyValue
+	Revision int64
+	More     bool
+}
+
+// Values returns the listed values keyed by key.
+func (r *ListResult) Values() map[string]string {
+	values := make(map[string]string, len(r.KVs))
+	for _, kv := range r.KVs {
+		values[kv.Key] = kv.Value
+	}
+	return values
+}
+
+// Cmp requires Key to be at ModRevision when a transaction runs. A
+// ModRevision of zero requires the key not to be set.
+type Cmp struct {
+	Key         string
+	ModRevision int64
+}
+
+// Absent requires key not to be set.
+func Absent(key string) Cmp {
+	return Cmp{Key: key}
+}
+
+// AtRevision requires key to have last been modified at rev, or not to be
+// set when rev is zero.
+func AtRevision(key string, rev int64) Cmp {
+	return Cmp{Key: key, ModRevision: rev}
+}
+
+type OpType int
+
+const (
+	OpPut OpType = iota
+	OpDelete
+)
+
+// Op is a write in a transaction. Deleting a key that is not set is not an
+// error within a transaction.
+type Op struct {
+	Type  OpType
+	Key   string
+	Value string
+	// TTL expires a put key after the given time; zero keeps it forever.
+	TTL time.Duration
+}
+
+type OpOption func(*Op)
+
+// WithTTL expires a put key after ttl.
+func WithTTL(ttl time.Duration) OpOption {
+	return func(op *Op) { op.TTL = ttl }
+}
+
+func Put(key, value string, opts ...OpOption) Op {
+	op := Op{Type: OpPut, Key: key, Value: value}
+	for _, opt := range opts {
+		opt(&op)
+	}
+	return op
+}
+
+func Delete(key string) Op {
+	return Op{Type: OpDelete, Key: key}
+}
+
+// checkOps rejects the ops of a transaction that write an empty key or the
+// same key twice, as etcd does.
+func checkOps(ops []Op) error {
+	seen := make(map[string]bool, len(ops))
+	for _, op := range ops {
+		if op.Key == "" {
+			return ErrEmptyKey
+		}
+		if seen[op.Key] {
+			return fmt.Errorf("%w: %s", ErrDuplicateKey, op.Key)
+		}
+		seen[op.Key] = true
+	}
+	return nil
+}
+
+// TxnResult reports whether a transaction's comparisons held and, if so,
+// the revision its writes were applied at.
+type TxnResult struct {
+	Succeeded bool
+	Revision  int64
+}
+
+type EventType int
+
+const (
+	EventPut EventType = iota
+	EventDelete
+)
+
+// Event is a single change seen by a watch. For deletions KV carries only
+// the key and the revision of the deletion, and PrevKV the deleted value
+// when the backend still has it.
+type Event struct {
+	Type   EventType
+	KV     *KeyValue
+	PrevKV *KeyValue
+}
+
+// IsCreate reports whether a put created its key.
+func (e *Event) IsCreate() bool {
+	return e.Type == EventPut && e.KV.CreateRevision == e.KV.ModRevision
+}
+
+// WatchResponse is a batch of events in revision order. A watch ends after a
+// response with CompactRevision or Err set.
+type WatchResponse struct {
+	Events          []*Event
+	CompactRevision int64
+	Err             error
+}
@@ -0,0 +1,9 @@
+ALTER TABLE rbac_users
+    DROP COLUMN updated_at,
+    DROP COLUMN active,
+    DROP COLUMN username;
+
+ALTER TABLE rbac_roles
+    DROP COLUMN updated_at,
+    DROP COLUMN created_at,
+    DROP COLUMN permissions;
\ No newline at end of file
@@ -0,0 +1,17 @@
+ALTER TABLE rbac_roles
+    ADD COLUMN permissions TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+ALTER TABLE rbac_users
+    ADD COLUMN username TEXT UNIQUE,
+    ADD COLUMN active BOOLEAN NOT NULL DEFAULT TRUE,
+    ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+UPDATE rbac_users SET username = email WHERE username IS NULL;
+ALTER TABLE rbac_users ALTER COLUMN username SET NOT NULL;
+
+INSERT INTO rbac_roles (name, description, permissions) VALUES
+    ('admin', 'Full access', '{*}'),
+    ('editor', 'Manage flags, segments, projects and SDK keys', '{flags:write,segments:write,projects:write,sdkkeys:write}'),
+    ('viewer', 'Read-only access', '{flags:read,segments:read,projects:read}')
+ON CONFLICT (name) DO NOTHING;
\ No newline at end of file
@@ -0,0 +1,12 @@
+DROP INDEX audit_logs_timestamp_idx;
+DROP INDEX audit_logs_user_idx;
+DROP INDEX audit_logs_resource_idx;
+
+ALTER TABLE audit_logs
+    DROP COLUMN ip_address,
+    DROP COLUMN user_agent,
+    DROP COLUMN environment,
+    DROP COLUMN project,
+    ALTER COLUMN timestamp TYPE TIMESTAMP USING timestamp AT TIME ZONE 'UTC';
+
+ALTER TABLE audit_logs RENAME COLUMN reason TO description;
\ No newline at end of file
@@ -0,0 +1,12 @@
+ALTER TABLE audit_logs RENAME COLUMN description TO reason;
+
+ALTER TABLE audit_logs
+    ALTER COLUMN timestamp TYPE TIMESTAMPTZ USING timestamp AT TIME ZONE 'UTC',
+    ADD COLUMN project TEXT,
+    ADD COLUMN environment TEXT,
+    ADD COLUMN user_agent TEXT,
+    ADD COLUMN ip_address TEXT;
+
+CREATE INDEX audit_logs_resource_idx ON audit_logs (resource_type, resource_id, timestamp DESC);
+CREATE INDEX audit_logs_user_idx ON audit_logs (user_id, timestamp DESC);
+CREATE INDEX audit_logs_timestamp_idx ON audit_logs (timestamp DESC);
\ No newline at end of file
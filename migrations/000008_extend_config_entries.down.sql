@@ -0,0 +1,10 @@
+UPDATE rbac_roles SET permissions = array_remove(permissions, 'config:read') WHERE name = 'viewer';
+UPDATE rbac_roles SET permissions = array_remove(permissions, 'config:write') WHERE name = 'editor';
+
+DROP TRIGGER config_entries_notify ON config_entries;
+DROP FUNCTION notify_config_entry_change();
+
+ALTER TABLE config_entries
+    ALTER COLUMN updated_at TYPE TIMESTAMP USING updated_at AT TIME ZONE 'UTC',
+    ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE 'UTC',
+    DROP COLUMN description;
\ No newline at end of file
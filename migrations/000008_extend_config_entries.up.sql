@@ -0,0 +1,25 @@
+ALTER TABLE config_entries
+    ADD COLUMN description TEXT,
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'UTC',
+    ALTER COLUMN updated_at TYPE TIMESTAMPTZ USING updated_at AT TIME ZONE 'UTC';
+
+-- Watchers LISTEN on config_entries and read the changed entry by key, as
+-- notification payloads are too small to carry values.
+CREATE FUNCTION notify_config_entry_change() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('config_entries', json_build_object(
+        'op', TG_OP,
+        'key', CASE WHEN TG_OP = 'DELETE' THEN OLD.key ELSE NEW.key END
+    )::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER config_entries_notify
+    AFTER INSERT OR UPDATE OR DELETE ON config_entries
+    FOR EACH ROW EXECUTE FUNCTION notify_config_entry_change();
+
+UPDATE rbac_roles SET permissions = array_append(permissions, 'config:write')
+    WHERE name = 'editor' AND NOT 'config:write' = ANY(permissions);
+UPDATE rbac_roles SET permissions = array_append(permissions, 'config:read')
+    WHERE name = 'viewer' AND NOT 'config:read' = ANY(permissions);
\ No newline at end of file
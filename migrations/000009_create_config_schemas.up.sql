@@ -0,0 +1,8 @@
+-- Values of config entries whose key starts with prefix must match schema.
+CREATE TABLE config_schemas (
+    prefix TEXT PRIMARY KEY,
+    schema JSONB NOT NULL,
+    description TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
\ No newline at end of file
@@ -0,0 +1,3 @@
+DROP TABLE config_entry_versions;
+
+ALTER TABLE config_entries DROP COLUMN version;
\ No newline at end of file
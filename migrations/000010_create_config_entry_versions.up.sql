@@ -0,0 +1,17 @@
+ALTER TABLE config_entries ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
+
+-- Every write of a config entry, kept after the entry is deleted. Versions
+-- continue from the last one when a deleted key is created again.
+CREATE TABLE config_entry_versions (
+    key TEXT NOT NULL,
+    version BIGINT NOT NULL,
+    value JSONB NOT NULL,
+    description TEXT,
+    author TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (key, version)
+);
+
+-- Existing entries start their history at version 1.
+INSERT INTO config_entry_versions (key, version, value, description, author, created_at)
+    SELECT key, 1, value, description, 'system', updated_at FROM config_entries;
\ No newline at end of file
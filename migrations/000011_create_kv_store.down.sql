@@ -0,0 +1,5 @@
+DROP TABLE kv_store_events;
+
+DROP TABLE kv_store;
+
+DROP SEQUENCE kv_store_revision;
\ No newline at end of file
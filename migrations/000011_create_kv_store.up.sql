@@ -0,0 +1,27 @@
+-- Keys and values of services stored in Postgres instead of etcd. Revisions
+-- are taken by the store, one per transaction, like etcd's. Keys use the C
+-- collation so they sort and compare bytewise, as Store promises for List.
+CREATE SEQUENCE kv_store_revision;
+
+CREATE TABLE kv_store (
+    key TEXT COLLATE "C" PRIMARY KEY,
+    value TEXT NOT NULL,
+    create_revision BIGINT NOT NULL,
+    mod_revision BIGINT NOT NULL,
+    expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Every write, keyed by revision, serving reads at past revisions and
+-- watches. Deletions keep the deleted value.
+CREATE TABLE kv_store_events (
+    revision BIGINT NOT NULL,
+    key TEXT COLLATE "C" NOT NULL,
+    type TEXT NOT NULL CHECK (type IN ('put', 'delete')),
+    value TEXT NOT NULL,
+    create_revision BIGINT NOT NULL,
+    PRIMARY KEY (revision, key)
+);
+
+CREATE INDEX kv_store_events_key ON kv_store_events (key, revision);
\ No newline at end of file